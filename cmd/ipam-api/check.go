@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	i "github.com/gerolf-vent/ipam-api/v2/internal"
+)
+
+// Exit status of the check subcommand, if the address is rejected
+const exitCodeRejected = 2
+
+// Runs the check subcommand, which prints how the address policies decide for
+// an address without changing anything, and returns the exit status
+func runCheck(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	argConfig := flags.String("config", "config.json", "Path to configuration file")
+	argIdentity := flags.String("identity", "", "Comma-separated identity of the client (e.g. \"cn:client,ou:team-a\")")
+	argAddress := flags.String("address", "", "CIDR address to check")
+	argInterface := flags.String("interface", "", "Name of the interface")
+	argNetns := flags.String("netns", "", "Network namespace (empty for the server's own)")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if *argAddress == "" || *argInterface == "" {
+		fmt.Fprintln(stderr, "The flags -address and -interface are required")
+		return 1
+	}
+
+	identity, err := i.ParseClientIdentity(*argIdentity)
+	if err != nil {
+		fmt.Fprintf(stderr, "Invalid identity: %v\n", err)
+		return 1
+	}
+
+	explanation, err := i.CheckPolicies(*argConfig, identity, *argNetns, *argInterface, *argAddress)
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to check address policies: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprint(stdout, explanation.PlainText())
+
+	if !explanation.Decision.Allowed {
+		return exitCodeRejected
+	}
+	return 0
+}
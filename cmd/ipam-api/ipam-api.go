@@ -11,6 +11,11 @@ import (
 func main() {
 	var err error
 
+	// Check the address policies without running the server
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		os.Exit(runCheck(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	// Parse cli flags
 	argConfig := flag.String("config", "config.json", "Path to configuration file")
 	argDevMode := flag.Bool("dev-mode", false, "Whether to run in dev mode")
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"net/http"
 	"io/ioutil"
 	"time"
 	"os"
+	"strings"
 	"testing"
 
 	"gotest.tools/assert"
@@ -56,8 +59,12 @@ func TestUnauthorizedRequest(t *testing.T) {
 		t.Fatalf("Failed to read response body: %v", err)
 	}
 
+	var response i.Response
+	assert.NilError(t, json.Unmarshal(body, &response))
+
 	assert.Equal(t, resp.StatusCode, http.StatusUnauthorized)
-	assert.Equal(t, string(body), "Unauthorized\n")
+	assert.Equal(t, response.Error.Code, i.ErrorCodeUnauthorized)
+	assert.Equal(t, response.Message, "Unauthorized")
 }
 
 func TestInvalidAuthorizationRequest(t *testing.T) {
@@ -93,8 +100,12 @@ func TestInvalidAuthorizationRequest(t *testing.T) {
 		t.Fatalf("Failed to read response body: %v", err)
 	}
 
+	var response i.Response
+	assert.NilError(t, json.Unmarshal(body, &response))
+
 	assert.Equal(t, resp.StatusCode, http.StatusForbidden)
-	assert.Equal(t, string(body), "Access denied\n")
+	assert.Equal(t, response.Error.Code, i.ErrorCodeAccessDenied)
+	assert.Equal(t, response.Message, "Access denied")
 }
 
 func TestValidAuthorizationRequest(t *testing.T) {
@@ -130,8 +141,12 @@ func TestValidAuthorizationRequest(t *testing.T) {
 		t.Fatalf("Failed to read response body: %v", err)
 	}
 
+	var response i.Response
+	assert.NilError(t, json.Unmarshal(body, &response))
+
 	assert.Equal(t, resp.StatusCode, http.StatusNotFound)
-	assert.Equal(t, string(body), "Path not found\n")
+	assert.Equal(t, response.Error.Code, i.ErrorCodePathNotFound)
+	assert.Equal(t, response.Message, "Path not found")
 }
 
 func TestHealthz(t *testing.T) {
@@ -161,6 +176,58 @@ func TestHealthz(t *testing.T) {
 		t.Fatalf("Failed to read response body: %v", err)
 	}
 
+	var response i.Response
+	assert.NilError(t, json.Unmarshal(body, &response))
+
 	assert.Equal(t, resp.StatusCode, http.StatusOK)
-	assert.Equal(t, string(body), "Server is healthy and ready to serve\n")
+	assert.Equal(t, response.Success, true)
+	assert.Equal(t, response.Message, "Server is healthy and ready to serve")
+}
+
+func TestHealthzListener(t *testing.T) {
+	serverCA, err := ioutil.ReadFile("../../test/server.crt")
+	if err != nil {
+		t.Fatalf("Failed to read server CA certificate: %v", err)
+	}
+	serverCAPool := x509.NewCertPool()
+	serverCAPool.AppendCertsFromPEM(serverCA)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:            serverCAPool,
+			},
+		},
+	}
+
+	resp, err := client.Get("https://localhost:44814/healthz")
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, resp.StatusCode, http.StatusOK)
+
+	// Nothing else is served without client certificate
+	resp, err = client.Get("https://localhost:44814/addresses")
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, resp.StatusCode, http.StatusNotFound)
+}
+
+func TestCheckSubcommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	code := runCheck([]string{"-config", "../../test/config.json", "-identity", "cn:client", "-address", "fd69:decd:7b66:8220::7/64", "-interface", "lo"}, &stdout, &stderr)
+	assert.Equal(t, code, 0, stderr.String())
+	assert.Assert(t, strings.HasSuffix(stdout.String(), "decision: allowed (it's allowed by policy \"fd69:decd:7b66:8220::/64\")\n"), stdout.String())
+
+	stdout.Reset()
+	code = runCheck([]string{"-config", "../../test/config.json", "-address", "fd69:decd:7b66:8221::7/64", "-interface", "lo"}, &stdout, &stderr)
+	assert.Equal(t, code, exitCodeRejected)
+	assert.Assert(t, strings.Contains(stdout.String(), "network=no"), stdout.String())
+
+	code = runCheck([]string{"-config", "../../test/config.json", "-interface", "lo"}, &stdout, &stderr)
+	assert.Equal(t, code, 1)
 }
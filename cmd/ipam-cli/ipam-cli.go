@@ -64,7 +64,7 @@ func main() {
 
 	switch argOperation {
 	case "add":
-		if err := i.AddAddress(link, address); err != nil {
+		if err := i.AddAddress(link, address, i.Advertisement{}); err != nil {
 			// The error was already logged in the function
 			os.Exit(1)
 		}
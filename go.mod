@@ -5,14 +5,15 @@ go 1.22.4
 require (
 	github.com/google/gopacket v1.1.19
 	github.com/vishvananda/netlink v1.1.0
+	github.com/vishvananda/netns v0.0.0-20191106174202-0a2b9b5464df
 	go.uber.org/zap v1.27.0
-	golang.org/x/sys v0.0.0-20190606203320-7fc4e5ec1444
+	golang.org/x/crypto v0.31.0
+	golang.org/x/sys v0.28.0
 	gotest.tools v2.2.0+incompatible
 )
 
 require (
 	github.com/google/go-cmp v0.6.0 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
-	github.com/vishvananda/netns v0.0.0-20191106174202-0a2b9b5464df // indirect
 	go.uber.org/multierr v1.10.0 // indirect
 )
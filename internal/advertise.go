@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// Holds the request data of an advertisement of an existing address
+type AdvertiseRequestData struct {
+	Address string `json:"address"`
+	InterfaceName string `json:"interface_name"`
+	Count int `json:"count"`
+	Interval Duration `json:"interval"`
+	Netns string `json:"netns"`
+}
+
+// Handles an authenticated request for advertising an existing address again
+func (s *Server) handleAdvertiseRequest(w http.ResponseWriter, r *http.Request, policy []AddressPolicy) {
+	if !checkRequestMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var rd AdvertiseRequestData
+	if !decodeRequestBody(w, r, "advertise", &rd) {
+		return
+	}
+
+	if rd.Address == "" {
+		zap.L().Error("Validation of request body failed: Address is missing in request",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "advertise"),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Address (\"address\") is missing in request", nil, Response{})
+		return
+	}
+
+	if rd.InterfaceName == "" {
+		zap.L().Error("Validation of request body failed: Interface name is missing in request",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "advertise"),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Interface name (\"interface_name\") is missing in request", nil, Response{})
+		return
+	}
+
+	if rd.Count < 0 || rd.Count > maxAdvertisementCount || rd.Interval.Duration < 0 {
+		zap.L().Error("Validation of request body failed: Invalid advertisement count or interval",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "advertise"),
+			zap.Int("count", rd.Count),
+			zap.Duration("interval", rd.Interval.Duration),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, fmt.Sprintf("Invalid advertisement count (expected 0 to %d) or interval", maxAdvertisementCount), nil, Response{
+			InterfaceName: rd.InterfaceName,
+		})
+		return
+	}
+
+	address, err := ParseAddress(rd.Address)
+	if err != nil {
+		zap.L().Error("Failed to parse cidr address",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "advertise"),
+			zap.String("address", rd.Address),
+			zap.Error(err),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeAddressParseError, "Failed to parse cidr address", err, Response{
+			InterfaceName: rd.InterfaceName,
+		})
+		return
+	}
+
+	ns, policy, ok := openRequestNamespace(w, r, "advertise", policy, rd.Netns, Response{
+		Address: address.IPNet.String(),
+		InterfaceName: rd.InterfaceName,
+		Netns: rd.Netns,
+	})
+	if !ok {
+		return
+	}
+	defer ns.Close()
+
+	if decision := checkAddressPolicies(r, "advertise", policiesBeforeLink(policy), rd.InterfaceName, address); !decision.Allowed {
+		writeError(w, r, http.StatusForbidden, ErrorCodePolicyDenied, "Rejected cidr address for interface, because " + decision.Reason(), nil, Response{
+			Address: address.IPNet.String(),
+			InterfaceName: rd.InterfaceName,
+			Netns: rd.Netns,
+		})
+		return
+	}
+
+	link, err := ns.LinkByName(rd.InterfaceName)
+	if err != nil {
+		zap.L().Error("Failed to retreive interface",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "advertise"),
+			zap.String("interface-name", rd.InterfaceName),
+			zap.String("netns", rd.Netns),
+			zap.Error(err),
+		)
+		writeError(w, r, linkErrorStatus(err), linkErrorCode(err), "Failed to retreive interface", err, Response{
+			Address: address.IPNet.String(),
+			InterfaceName: rd.InterfaceName,
+			Netns: rd.Netns,
+		})
+		return
+	}
+
+	response := Response{
+		Address: address.IPNet.String(),
+		InterfaceName: (*link).Attrs().Name,
+		InterfaceIndex: (*link).Attrs().Index,
+		Netns: rd.Netns,
+	}
+
+	policy, ok = checkLinkPolicies(w, r, "advertise", policy, link, address, response)
+	if !ok {
+		return
+	}
+
+	addressExists, err := AddressExists(link, address)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, ErrorCodeNetlinkFailure, "Failed to retreive addresses of interface", err, response)
+		return
+	}
+
+	if !addressExists {
+		zap.L().Error("Failed to advertise address, because it isn't present on interface",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("interface-name", rd.InterfaceName),
+			zap.String("address", rd.Address),
+		)
+		writeError(w, r, http.StatusNotFound, ErrorCodeAddressNotFound, "Failed to advertise address, because it isn't present on interface", nil, response)
+		return
+	}
+
+	// The settings of the policy can be overridden by the request
+	advertisement := advertisementFor(policy, rd.InterfaceName, address)
+	if rd.Count != 0 {
+		advertisement.Count = rd.Count
+	}
+	if rd.Interval.Duration != 0 {
+		advertisement.Interval = rd.Interval
+	}
+
+	if err := AnnounceAddress(link, address, advertisement); err != nil {
+		writeError(w, r, http.StatusInternalServerError, ErrorCodeAdvertiseFailed, "Failed to advertise address on interface", err, response)
+		return
+	}
+
+	response.Message = fmt.Sprintf("Successfully started advertisement of address on interface (%d packets)", advertisement.PacketCount())
+	writeSuccess(w, r, response)
+}
@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestAdvertiseAddress(t *testing.T) {
+	assert.Assert(t, os.Getenv("NET_LINK") != "")
+
+	link, err := LinkByName(os.Getenv("NET_LINK"))
+	assert.NilError(t, err)
+
+	_, policyIPNetwork, err := net.ParseCIDR("198.51.100.0/24")
+	assert.NilError(t, err)
+
+	server := &Server{AddressPolicies: []AddressPolicy{
+		AddressPolicy{IPNetwork: IPNetwork{*policyIPNetwork}, InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")}},
+	}}
+
+	rd := AdvertiseRequestData{Address: "198.51.100.1/24", InterfaceName: os.Getenv("NET_LINK"), Count: 2, Interval: Duration{10 * time.Millisecond}}
+
+	code, response := sendPostRequest(t, server, "/advertise", rd)
+	assert.Equal(t, code, http.StatusNotFound)
+	assert.Equal(t, response.Error.Code, ErrorCodeAddressNotFound)
+
+	address, err := ParseAddress(rd.Address)
+	assert.NilError(t, err)
+	assert.NilError(t, AddAddress(link, address, Advertisement{}))
+
+	code, response = sendPostRequest(t, server, "/advertise", rd)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, response.Address, "198.51.100.1/24")
+
+	rd.Count = maxAdvertisementCount + 1
+	code, response = sendPostRequest(t, server, "/advertise", rd)
+	assert.Equal(t, code, http.StatusBadRequest)
+	assert.Equal(t, response.Error.Code, ErrorCodeInvalidRequest)
+
+	code, response = sendPostRequest(t, server, "/advertise", AdvertiseRequestData{Address: "192.0.2.1/24", InterfaceName: os.Getenv("NET_LINK")})
+	assert.Equal(t, code, http.StatusForbidden)
+	assert.Equal(t, response.Error.Code, ErrorCodePolicyDenied)
+
+	assert.NilError(t, DeleteAddress(link, address))
+}
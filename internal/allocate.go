@@ -0,0 +1,521 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+)
+
+// Holds the request data of an allocation
+type AllocateRequestData struct {
+	InterfaceName string `json:"interface_name"`
+	Pool string `json:"pool"`
+	Family string `json:"family"`
+	LeaseDuration int `json:"lease_duration"`
+	Netns string `json:"netns"`
+	AddressOptions
+}
+
+// Holds the outcome of an allocation
+type AllocationResult struct {
+	Pool string `json:"pool"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Converts an ip network to a prefix
+func networkPrefix(ipNetwork IPNetwork) netip.Prefix {
+	ip, _ := netip.AddrFromSlice(ipNetwork.IP)
+	ones, _ := ipNetwork.Mask.Size()
+	return netip.PrefixFrom(ip.Unmap(), ones).Masked()
+}
+
+// Returns the last address of a prefix
+func lastAddress(prefix netip.Prefix) netip.Addr {
+	b := prefix.Masked().Addr().AsSlice()
+	for i := prefix.Bits(); i < len(b) * 8; i++ {
+		b[i / 8] |= 1 << (7 - i % 8)
+	}
+	address, _ := netip.AddrFromSlice(b)
+	return address
+}
+
+// Checks whether an address policy is an address pool of the given name and
+// family, that can be allocated from for an interface
+func (ap AddressPolicy) isPoolFor(interfaceName string, pool string, family int) bool {
+	if ap.IsDeny() || pool != "" && ap.Name != pool {
+		return false
+	}
+
+	if family == netlink.FAMILY_V4 && ap.IPNetwork.IP.To4() == nil ||
+		family == netlink.FAMILY_V6 && ap.IPNetwork.IP.To4() != nil {
+		return false
+	}
+
+	return ap.InterfaceNameRegex.MatchString(interfaceName)
+}
+
+// Picks the lowest host address of the network of an address policy, which is
+// neither excluded, denied nor used (the network and broadcast addresses are
+// skipped for networks with more than two addresses)
+func (ap AddressPolicy) nextFreeAddress(used map[netip.Addr]bool, denied []IPNetwork) (netip.Addr, bool) {
+	prefix := networkPrefix(ap.IPNetwork)
+	first, last := prefix.Addr(), lastAddress(prefix)
+
+	if prefix.Bits() < first.BitLen() - 1 {
+		first = first.Next()
+		if first.Is4() {
+			last = last.Prev()
+		}
+	}
+
+	var excludedPrefixes []netip.Prefix
+	for _, en := range append(append([]IPNetwork{}, ap.ExcludedNetworks...), denied...) {
+		excludedPrefixes = append(excludedPrefixes, networkPrefix(en))
+	}
+
+	address := first
+	for address.IsValid() && address.Compare(last) <= 0 {
+		excluded := false
+		for _, ep := range excludedPrefixes {
+			if ep.Contains(address) {
+				// Skip the whole excluded network at once
+				address = lastAddress(ep).Next()
+				excluded = true
+				break
+			}
+		}
+		if excluded {
+			continue
+		}
+
+		if !used[address] {
+			return address, true
+		}
+
+		address = address.Next()
+	}
+
+	return netip.Addr{}, false
+}
+
+// Reserves an allocated address until it's added, so other allocations don't
+// pick it in the meantime (the mutex of the server must be held)
+func (s *Server) reserveAddress(ns *Namespace, address CIDRAddress) {
+	if ip, ok := netip.AddrFromSlice(address.IP); ok {
+		if s.reserved == nil {
+			s.reserved = make(map[string]map[netip.Addr]bool)
+		}
+		if s.reserved[ns.String()] == nil {
+			s.reserved[ns.String()] = make(map[netip.Addr]bool)
+		}
+		s.reserved[ns.String()][ip.Unmap()] = true
+	}
+}
+
+// Releases the reservation of an allocated address
+func (s *Server) unreserveAddress(ns *Namespace, address CIDRAddress) {
+	if ip, ok := netip.AddrFromSlice(address.IP); ok {
+		s.mutex.Lock()
+		delete(s.reserved[ns.String()], ip.Unmap())
+		s.mutex.Unlock()
+	}
+}
+
+// Returns the addresses, that are in use on any network link of a network
+// namespace, reserved by allocations or recorded in the store (for the
+// server's namespace)
+func (s *Server) usedAddresses(ns *Namespace) (map[netip.Addr]bool, error) {
+	used := make(map[netip.Addr]bool)
+
+	for ip := range s.reserved[ns.String()] {
+		used[ip] = true
+	}
+
+	links, err := ns.ListLinks()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, link := range links {
+		addresses, err := ListAddresses(link, netlink.FAMILY_ALL)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, address := range addresses {
+			if ip, ok := netip.AddrFromSlice(address.IP); ok {
+				used[ip.Unmap()] = true
+			}
+		}
+	}
+
+	if ns != nil {
+		return used, nil
+	}
+
+	// Recorded addresses may be missing temporarily (e.g. on links, that are down)
+	for _, record := range s.Store.Records() {
+		if address, err := ParseAddress(record.Address); err == nil {
+			if ip, ok := netip.AddrFromSlice(address.IP); ok {
+				used[ip.Unmap()] = true
+			}
+		}
+	}
+
+	return used, nil
+}
+
+// Handles an authenticated request for allocating a free address from a pool
+func (s *Server) handleAllocateRequest(w http.ResponseWriter, r *http.Request, policy []AddressPolicy) {
+	if !checkRequestMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var rd AllocateRequestData
+	if !decodeRequestBody(w, r, "allocate", &rd) {
+		return
+	}
+
+	if rd.InterfaceName == "" {
+		zap.L().Error("Validation of request body failed: Interface name is missing in request",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "allocate"),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Interface name (\"interface_name\") is missing in request", nil, Response{})
+		return
+	}
+
+	family, err := ParseAddressFamily(rd.Family)
+	if err != nil {
+		zap.L().Error("Validation of request body failed: Invalid address family",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "allocate"),
+			zap.String("family", rd.Family),
+			zap.Error(err),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Failed to parse address family", err, Response{
+			InterfaceName: rd.InterfaceName,
+		})
+		return
+	}
+
+	expiresAt, ok := s.leaseExpiry(w, r, "allocate", rd.LeaseDuration, rd.AddressOptions, Response{InterfaceName: rd.InterfaceName, Netns: rd.Netns})
+	if !ok {
+		return
+	}
+
+	ns, policy, ok := openRequestNamespace(w, r, "allocate", policy, rd.Netns, Response{
+		InterfaceName: rd.InterfaceName,
+		Netns: rd.Netns,
+	})
+	if !ok {
+		return
+	}
+	defer ns.Close()
+
+	var pools []AddressPolicy
+	for _, p := range policy {
+		if p.isPoolFor(rd.InterfaceName, rd.Pool, family) && p.AllowsOptions(rd.AddressOptions) {
+			pools = append(pools, p)
+		}
+	}
+
+	if len(pools) == 0 {
+		zap.L().Error("Rejected allocation for interface, because no matching pool was found",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("interface-name", rd.InterfaceName),
+			zap.String("pool", rd.Pool),
+		)
+		writeError(w, r, http.StatusForbidden, ErrorCodePolicyDenied, "Rejected allocation for interface, because no matching pool was found", nil, Response{
+			InterfaceName: rd.InterfaceName,
+			Netns: rd.Netns,
+		})
+		return
+	}
+
+	link, err := ns.LinkByName(rd.InterfaceName)
+	if err != nil {
+		zap.L().Error("Failed to retreive interface",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "allocate"),
+			zap.String("interface-name", rd.InterfaceName),
+			zap.String("netns", rd.Netns),
+			zap.Error(err),
+		)
+		writeError(w, r, linkErrorStatus(err), linkErrorCode(err), "Failed to retreive interface", err, Response{
+			InterfaceName: rd.InterfaceName,
+			Netns: rd.Netns,
+		})
+		return
+	}
+
+	response := Response{
+		InterfaceName: (*link).Attrs().Name,
+		InterfaceIndex: (*link).Attrs().Index,
+		Netns: rd.Netns,
+	}
+
+	// Pools, that don't match the attributes of the interface, are left out
+	policy = PoliciesForLink(policy, link)
+	pools = PoliciesForLink(pools, link)
+	if len(pools) == 0 {
+		zap.L().Error("Rejected allocation for interface, because no matching pool was found",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("interface-name", rd.InterfaceName),
+			zap.String("pool", rd.Pool),
+		)
+		writeError(w, r, http.StatusForbidden, ErrorCodePolicyDenied, "Rejected allocation for interface, because no matching pool was found", nil, response)
+		return
+	}
+
+	// Picking an address must not interleave with other allocations, the picked
+	// address is reserved until it's added
+	s.mutex.Lock()
+	locked := true
+	defer func() {
+		if locked {
+			s.mutex.Unlock()
+		}
+	}()
+
+	used, err := s.usedAddresses(ns)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, ErrorCodeNetlinkFailure, "Failed to retreive addresses in use", err, response)
+		return
+	}
+
+	owner := requestIdentity(r).String()
+
+	// Addresses denied by a deny policy are never allocated
+	var denied []IPNetwork
+	for _, p := range policy {
+		if p.IsDeny() && p.InterfaceNameRegex.MatchString(rd.InterfaceName) {
+			denied = append(denied, p.IPNetwork)
+		}
+	}
+
+	var address CIDRAddress
+	var pool AddressPolicy
+	var limitErr error
+	for _, p := range pools {
+		if ip, ok := p.nextFreeAddress(used, denied); ok {
+			ones, _ := p.IPNetwork.Mask.Size()
+			candidate, err := ParseAddress(fmt.Sprintf("%s/%d", ip, ones))
+			if err != nil {
+				writeError(w, r, http.StatusInternalServerError, ErrorCodeAddressParseError, "Failed to parse allocated cidr address", err, response)
+				return
+			}
+			if err := rd.AddressOptions.Apply(rd.InterfaceName, candidate); err != nil {
+				zap.L().Error("Validation of request body failed: Invalid address options",
+					zap.String("remote-addr", r.RemoteAddr),
+					zap.String("action", "allocate"),
+					zap.Error(err),
+				)
+				writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Invalid address options", err, response)
+				return
+			}
+
+			// Pools, that reached an address limit, are skipped
+			if err := s.checkAddressLimits(link, candidate, policy, owner); err != nil {
+				var addressLimitError *AddressLimitError
+				if !errors.As(err, &addressLimitError) {
+					writeError(w, r, http.StatusInternalServerError, ErrorCodeNetlinkFailure, "Failed to retreive addresses in use", err, response)
+					return
+				}
+				limitErr = err
+				continue
+			}
+
+			address = candidate
+			pool = p
+			break
+		}
+	}
+
+	if address == nil && limitErr != nil {
+		zap.L().Error("Failed to allocate address, because all matching pools reached an address limit",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("interface-name", rd.InterfaceName),
+			zap.String("pool", rd.Pool),
+			zap.Error(limitErr),
+		)
+		writeError(w, r, http.StatusForbidden, ErrorCodeAddressLimitExceeded, "Failed to allocate address, because all matching pools reached an address limit", limitErr, response)
+		return
+	}
+
+	if address == nil {
+		zap.L().Error("Failed to allocate address, because all matching pools are exhausted",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("interface-name", rd.InterfaceName),
+			zap.String("pool", rd.Pool),
+		)
+		writeError(w, r, http.StatusConflict, ErrorCodePoolExhausted, "Failed to allocate address, because all matching pools are exhausted", nil, response)
+		return
+	}
+
+	response.Address = address.IPNet.String()
+	response.Data = AllocationResult{Pool: pool.Name, ExpiresAt: expiresAt}
+
+	s.reserveAddress(ns, address)
+	defer s.unreserveAddress(ns, address)
+	s.mutex.Unlock()
+	locked = false
+
+	if err := s.addAddress(link, address, policy, expiresAt, owner); err != nil {
+		zap.L().Error("Failed to add allocated cidr address to interface",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("interface-name", rd.InterfaceName),
+			zap.String("address", response.Address),
+			zap.Error(err),
+		)
+		writeError(w, r, addressErrorStatus(err), addressErrorCode(err), "Failed to add allocated cidr address to interface", err, response)
+		return
+	}
+
+	zap.L().Info("Allocated address on interface",
+		zap.String("remote-addr", r.RemoteAddr),
+		zap.String("interface-name", rd.InterfaceName),
+		zap.String("address", response.Address),
+		zap.String("pool", pool.Name),
+	)
+
+	response.Message = "Successfully allocated address on interface"
+	writeSuccess(w, r, response)
+}
+
+// Handles an authenticated request for releasing an allocated address
+func (s *Server) handleReleaseRequest(w http.ResponseWriter, r *http.Request, policy []AddressPolicy) {
+	if !checkRequestMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var rd RequestData
+	if !decodeRequestBody(w, r, "release", &rd) {
+		return
+	}
+
+	if rd.Address == "" {
+		zap.L().Error("Validation of request body failed: Address is missing in request",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "release"),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Address (\"address\") is missing in request", nil, Response{})
+		return
+	}
+
+	if rd.InterfaceName == "" {
+		zap.L().Error("Validation of request body failed: Interface name is missing in request",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "release"),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Interface name (\"interface_name\") is missing in request", nil, Response{})
+		return
+	}
+
+	address, err := ParseAddress(rd.Address)
+	if err != nil {
+		zap.L().Error("Failed to parse cidr address",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "release"),
+			zap.String("address", rd.Address),
+			zap.Error(err),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeAddressParseError, "Failed to parse cidr address", err, Response{
+			InterfaceName: rd.InterfaceName,
+		})
+		return
+	}
+
+	ns, policy, ok := openRequestNamespace(w, r, "release", policy, rd.Netns, Response{
+		Address: address.IPNet.String(),
+		InterfaceName: rd.InterfaceName,
+		Netns: rd.Netns,
+	})
+	if !ok {
+		return
+	}
+	defer ns.Close()
+
+	if decision := checkAddressPolicies(r, "release", policiesBeforeLink(policy), rd.InterfaceName, address); !decision.Allowed {
+		writeError(w, r, http.StatusForbidden, ErrorCodePolicyDenied, "Rejected cidr address for interface, because " + decision.Reason(), nil, Response{
+			Address: address.IPNet.String(),
+			InterfaceName: rd.InterfaceName,
+			Netns: rd.Netns,
+		})
+		return
+	}
+
+	link, err := ns.LinkByName(rd.InterfaceName)
+	if err != nil {
+		zap.L().Error("Failed to retreive interface",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "release"),
+			zap.String("interface-name", rd.InterfaceName),
+			zap.String("netns", rd.Netns),
+			zap.Error(err),
+		)
+		writeError(w, r, linkErrorStatus(err), linkErrorCode(err), "Failed to retreive interface", err, Response{
+			Address: address.IPNet.String(),
+			InterfaceName: rd.InterfaceName,
+			Netns: rd.Netns,
+		})
+		return
+	}
+
+	response := Response{
+		Address: address.IPNet.String(),
+		InterfaceName: (*link).Attrs().Name,
+		InterfaceIndex: (*link).Attrs().Index,
+		Netns: rd.Netns,
+	}
+
+	policy, ok = checkLinkPolicies(w, r, "release", policy, link, address, response)
+	if !ok {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	addressExists, err := AddressExists(link, address)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, ErrorCodeNetlinkFailure, "Failed to retreive addresses of interface", err, response)
+		return
+	}
+
+	recorded := ns == nil && s.Store.Contains((*link).Attrs().Name, address)
+	if !addressExists && !recorded {
+		zap.L().Error("Failed to release address, because it isn't allocated on interface",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("interface-name", rd.InterfaceName),
+			zap.String("address", rd.Address),
+		)
+		writeError(w, r, http.StatusNotFound, ErrorCodeAddressNotFound, "Failed to release address, because it isn't allocated on interface", nil, response)
+		return
+	}
+
+	if err := s.deleteAddress(link, address); err != nil {
+		zap.L().Error("Failed to delete released cidr address from interface",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("interface-name", rd.InterfaceName),
+			zap.String("address", rd.Address),
+			zap.Error(err),
+		)
+		writeError(w, r, http.StatusInternalServerError, addressErrorCode(err), "Failed to delete released cidr address from interface", err, response)
+		return
+	}
+
+	zap.L().Info("Released address on interface",
+		zap.String("remote-addr", r.RemoteAddr),
+		zap.String("interface-name", rd.InterfaceName),
+		zap.String("address", rd.Address),
+	)
+
+	response.Message = "Successfully released address from interface"
+	writeSuccess(w, r, response)
+}
@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"regexp"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+// Modifies a request sent by the tests
+type requestOption func(*http.Request)
+
+// Sends the request with another method than POST
+func withMethod(method string) requestOption {
+	return func(req *http.Request) {
+		req.Method = method
+	}
+}
+
+// Sends the request on behalf of a client with a certificate
+func withClientCertificate(certificate *x509.Certificate) requestOption {
+	return func(req *http.Request) {
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{certificate}}
+	}
+}
+
+func sendPostRequest(t *testing.T, server *Server, path string, rd interface{}, options ...requestOption) (int, Response) {
+	requestData, err := json.Marshal(rd)
+	assert.NilError(t, err)
+
+	req, err := http.NewRequest("POST", path, bytes.NewBuffer(requestData))
+	if err != nil {
+		t.Fatalf("Could not create request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for _, option := range options {
+		option(req)
+	}
+
+	rr := httptest.NewRecorder()
+	server.handleRequest(rr, req)
+
+	var response Response
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+
+	return rr.Code, response
+}
+
+// Decodes the data of a response into a value
+func decodeResponseData(t *testing.T, response Response, v interface{}) {
+	data, err := json.Marshal(response.Data)
+	assert.NilError(t, err)
+	assert.NilError(t, json.Unmarshal(data, v))
+}
+
+func TestNextFreeAddress(t *testing.T) {
+	_, policyIPNetwork, err := net.ParseCIDR("192.0.2.0/29")
+	assert.NilError(t, err)
+	_, excludedIPNetwork, err := net.ParseCIDR("192.0.2.2/31")
+	assert.NilError(t, err)
+
+	policy := AddressPolicy{
+		IPNetwork: IPNetwork{*policyIPNetwork},
+		ExcludedNetworks: []IPNetwork{IPNetwork{*excludedIPNetwork}},
+	}
+
+	used := map[netip.Addr]bool{netip.MustParseAddr("192.0.2.1"): true}
+
+	address, ok := policy.nextFreeAddress(used, nil)
+	assert.Assert(t, ok)
+	assert.Equal(t, address.String(), "192.0.2.4")
+
+	used[netip.MustParseAddr("192.0.2.4")] = true
+	used[netip.MustParseAddr("192.0.2.5")] = true
+	address, ok = policy.nextFreeAddress(used, nil)
+	assert.Assert(t, ok)
+	assert.Equal(t, address.String(), "192.0.2.6")
+
+	// The broadcast address is never allocated
+	used[netip.MustParseAddr("192.0.2.6")] = true
+	_, ok = policy.nextFreeAddress(used, nil)
+	assert.Assert(t, !ok)
+}
+
+func TestNextFreeAddressWithIPv6(t *testing.T) {
+	_, policyIPNetwork, err := net.ParseCIDR("fd69:decd:7b66:8220::/64")
+	assert.NilError(t, err)
+	_, excludedIPNetwork, err := net.ParseCIDR("fd69:decd:7b66:8220::/72")
+	assert.NilError(t, err)
+
+	policy := AddressPolicy{
+		IPNetwork: IPNetwork{*policyIPNetwork},
+		ExcludedNetworks: []IPNetwork{IPNetwork{*excludedIPNetwork}},
+	}
+
+	address, ok := policy.nextFreeAddress(map[netip.Addr]bool{}, nil)
+	assert.Assert(t, ok)
+	assert.Equal(t, address.String(), "fd69:decd:7b66:8220:100::")
+}
+
+func TestNextFreeAddressWithPointToPointNetwork(t *testing.T) {
+	_, policyIPNetwork, err := net.ParseCIDR("192.0.2.0/31")
+	assert.NilError(t, err)
+
+	policy := AddressPolicy{IPNetwork: IPNetwork{*policyIPNetwork}}
+
+	address, ok := policy.nextFreeAddress(map[netip.Addr]bool{}, nil)
+	assert.Assert(t, ok)
+	assert.Equal(t, address.String(), "192.0.2.0")
+}
+
+func TestAllocateWithoutMatchingPool(t *testing.T) {
+	_, policyIPNetwork, err := net.ParseCIDR("192.0.2.0/24")
+	assert.NilError(t, err)
+
+	server := &Server{AddressPolicies: []AddressPolicy{
+		AddressPolicy{Name: "team-a", IPNetwork: IPNetwork{*policyIPNetwork}, InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")}},
+	}}
+
+	code, response := sendPostRequest(t, server, "/allocate", AllocateRequestData{InterfaceName: "lo", Pool: "team-b"})
+	assert.Equal(t, code, http.StatusForbidden)
+	assert.Equal(t, response.Error.Code, ErrorCodePolicyDenied)
+
+	code, response = sendPostRequest(t, server, "/allocate", AllocateRequestData{InterfaceName: "lo", Family: "ipv6"})
+	assert.Equal(t, code, http.StatusForbidden)
+	assert.Equal(t, response.Error.Code, ErrorCodePolicyDenied)
+}
+
+func TestAllocateAndRelease(t *testing.T) {
+	assert.Assert(t, os.Getenv("NET_LINK") != "")
+
+	link, err := LinkByName(os.Getenv("NET_LINK"))
+	assert.NilError(t, err)
+
+	_, policyIPNetwork, err := net.ParseCIDR("198.51.100.0/30")
+	assert.NilError(t, err)
+
+	server := &Server{AddressPolicies: []AddressPolicy{
+		AddressPolicy{Name: "team-a", IPNetwork: IPNetwork{*policyIPNetwork}, InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")}},
+	}}
+
+	rd := AllocateRequestData{InterfaceName: os.Getenv("NET_LINK"), Pool: "team-a"}
+
+	code, response := sendPostRequest(t, server, "/allocate", rd)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, response.Address, "198.51.100.1/30")
+	assert.DeepEqual(t, response.Data, map[string]interface{}{"pool": "team-a"})
+	assertAddressExists(t, link, "198.51.100.1/30", true)
+
+	code, response = sendPostRequest(t, server, "/allocate", rd)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, response.Address, "198.51.100.2/30")
+
+	code, response = sendPostRequest(t, server, "/allocate", rd)
+	assert.Equal(t, code, http.StatusConflict)
+	assert.Equal(t, response.Error.Code, ErrorCodePoolExhausted)
+
+	for _, a := range []string{"198.51.100.2/30", "198.51.100.1/30"} {
+		code, response = sendPostRequest(t, server, "/release", RequestData{Address: a, InterfaceName: os.Getenv("NET_LINK")})
+		assert.Equal(t, code, http.StatusOK)
+		assertAddressExists(t, link, a, false)
+	}
+
+	code, response = sendPostRequest(t, server, "/release", RequestData{Address: "198.51.100.1/30", InterfaceName: os.Getenv("NET_LINK")})
+	assert.Equal(t, code, http.StatusNotFound)
+	assert.Equal(t, response.Error.Code, ErrorCodeAddressNotFound)
+}
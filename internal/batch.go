@@ -0,0 +1,304 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Status of a single operation of a batch
+type OperationStatus string
+
+const (
+	OperationStatusApplied OperationStatus = "applied"
+	OperationStatusUnchanged OperationStatus = "unchanged"
+	OperationStatusFailed OperationStatus = "failed"
+	OperationStatusRolledBack OperationStatus = "rolled_back"
+	OperationStatusRollbackFailed OperationStatus = "rollback_failed"
+	OperationStatusRejected OperationStatus = "rejected"
+	OperationStatusSkipped OperationStatus = "skipped"
+	OperationStatusPlanned OperationStatus = "planned"
+)
+
+// Holds the request data of a batch of address operations
+type BatchRequestData struct {
+	Operations []BatchOperation `json:"operations"`
+}
+
+// Holds a single address operation of a batch
+type BatchOperation struct {
+	Action string `json:"action"`
+	Address string `json:"address"`
+	InterfaceName string `json:"interface_name"`
+}
+
+// Holds the outcome of a batch of address operations
+type BatchResult struct {
+	Operations []OperationResult `json:"operations"`
+	RolledBack bool `json:"rolled_back"`
+}
+
+// Holds the outcome of a single address operation of a batch
+type OperationResult struct {
+	Index int `json:"index"`
+	Action string `json:"action"`
+	Address string `json:"address"`
+	InterfaceName string `json:"interface_name"`
+	Status OperationStatus `json:"status"`
+	Error *ResponseError `json:"error,omitempty"`
+}
+
+// A validated address operation, that is ready to be applied
+type resolvedOperation struct {
+	action string
+	link NetworkLink
+	address CIDRAddress
+	// Policies of the client, that bound the address limits of additions
+	policy []AddressPolicy
+	// Owner and lease expiry of a deleted address, that are restored on rollback
+	owner string
+	expiresAt *time.Time
+	changed bool
+}
+
+// Renders the batch result as plain text (one operation per line)
+func (br BatchResult) PlainText() string {
+	var sb strings.Builder
+	for _, o := range br.Operations {
+		fmt.Fprintf(&sb, "%d %s %s %s %s", o.Index, o.Action, o.InterfaceName, o.Address, o.Status)
+		if o.Error != nil {
+			fmt.Fprintf(&sb, " (%s)", o.Error.Code)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// Validates a single address operation of a batch
+func resolveOperation(operation BatchOperation, policy []AddressPolicy) (*resolvedOperation, int, ErrorCode, error) {
+	if operation.Action != "add" && operation.Action != "delete" {
+		return nil, http.StatusBadRequest, ErrorCodeInvalidRequest, fmt.Errorf("invalid action \"%s\" (expected \"add\" or \"delete\")", operation.Action)
+	}
+
+	if operation.Address == "" {
+		return nil, http.StatusBadRequest, ErrorCodeInvalidRequest, errors.New("address (\"address\") is missing")
+	}
+
+	if operation.InterfaceName == "" {
+		return nil, http.StatusBadRequest, ErrorCodeInvalidRequest, errors.New("interface name (\"interface_name\") is missing")
+	}
+
+	address, err := ParseAddress(operation.Address)
+	if err != nil {
+		return nil, http.StatusBadRequest, ErrorCodeAddressParseError, err
+	}
+
+	if decision := DecideAddress(policiesBeforeLink(policy), operation.InterfaceName, address); !decision.Allowed {
+		return nil, http.StatusForbidden, ErrorCodePolicyDenied, errors.New(decision.Reason())
+	}
+
+	link, err := LinkByName(operation.InterfaceName)
+	if err != nil {
+		return nil, linkErrorStatus(err), linkErrorCode(err), err
+	}
+
+	// Link matchers can only be evaluated with the resolved interface
+	policy = PoliciesForLink(policy, link)
+	if decision := DecideAddress(policy, operation.InterfaceName, address); !decision.Allowed {
+		return nil, http.StatusForbidden, ErrorCodePolicyDenied, errors.New(decision.Reason())
+	}
+
+	return &resolvedOperation{
+		action: operation.Action,
+		link: link,
+		address: address,
+		policy: policy,
+	}, 0, "", nil
+}
+
+// Applies a single address operation on behalf of a client and remembers,
+// whether it changed anything
+func (o *resolvedOperation) apply(s *Server, owner string) error {
+	addressExists, err := AddressExists(o.link, o.address)
+	if err != nil {
+		return err
+	}
+
+	record, recorded := s.Store.Record((*o.link).Attrs().Name, o.address)
+
+	switch o.action {
+	case "add":
+		// Adding a recorded address again keeps its lease
+		var expiresAt *time.Time
+		if recorded {
+			expiresAt = record.ExpiresAt
+		}
+		err = s.addAddress(o.link, o.address, o.policy, expiresAt, owner)
+	case "delete":
+		if recorded {
+			o.owner, o.expiresAt = record.Owner, record.ExpiresAt
+		}
+		s.mutex.Lock()
+		err = s.deleteAddress(o.link, o.address)
+		s.mutex.Unlock()
+	}
+
+	// An operation may fail after the address was changed (e.g. advertising)
+	addressExistsAfter, existsErr := AddressExists(o.link, o.address)
+	if existsErr != nil {
+		return existsErr
+	}
+	o.changed = addressExists != addressExistsAfter
+
+	return err
+}
+
+// Reverts a previously applied address operation
+func (o *resolvedOperation) revert(s *Server) error {
+	switch o.action {
+	case "add":
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		return s.deleteAddress(o.link, o.address)
+	case "delete":
+		return s.addAddress(o.link, o.address, nil, o.expiresAt, o.owner)
+	}
+	return nil
+}
+
+// Applies address operations in order and rolls back the applied ones on the
+// first failure (returns the index of the failed operation)
+func (s *Server) applyOperations(r *http.Request, operations []*resolvedOperation, result *BatchResult) (int, error) {
+	// Address limits are checked against the state left by the previous
+	// operations (the mutex is only held by the single operations, as additions
+	// may wait for the duplicate address detection)
+	owner := requestIdentity(r).String()
+	for i, operation := range operations {
+		err := operation.apply(s, owner)
+		if err == nil {
+			if operation.changed {
+				result.Operations[i].Status = OperationStatusApplied
+			} else {
+				result.Operations[i].Status = OperationStatusUnchanged
+			}
+			continue
+		}
+
+		zap.L().Error("Failed to apply operation, rolling back",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.Int("index", i),
+			zap.String("operation", operation.action),
+			zap.String("interface-name", result.Operations[i].InterfaceName),
+			zap.String("address", result.Operations[i].Address),
+			zap.Error(err),
+		)
+
+		result.Operations[i].Status = OperationStatusFailed
+		result.Operations[i].Error = &ResponseError{Code: addressErrorCode(err), Detail: err.Error()}
+
+		for j := i; j >= 0; j-- {
+			if !operations[j].changed {
+				continue
+			}
+
+			if err := operations[j].revert(s); err != nil {
+				zap.L().Error("Failed to roll back operation",
+					zap.String("remote-addr", r.RemoteAddr),
+					zap.Int("index", j),
+					zap.String("operation", operations[j].action),
+					zap.String("interface-name", result.Operations[j].InterfaceName),
+					zap.String("address", result.Operations[j].Address),
+					zap.Error(err),
+				)
+				result.Operations[j].Status = OperationStatusRollbackFailed
+				continue
+			}
+
+			if j != i {
+				result.Operations[j].Status = OperationStatusRolledBack
+			}
+		}
+		result.RolledBack = true
+
+		return i, err
+	}
+
+	return -1, nil
+}
+
+// Handles an authenticated request for a batch of address operations
+func (s *Server) handleBatchRequest(w http.ResponseWriter, r *http.Request, policy []AddressPolicy) {
+	if !checkRequestMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var rd BatchRequestData
+	if !decodeRequestBody(w, r, "batch", &rd) {
+		return
+	}
+
+	if len(rd.Operations) == 0 {
+		zap.L().Error("Validation of request body failed: Operations are missing in request",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "batch"),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Operations (\"operations\") are missing in request", nil, Response{})
+		return
+	}
+
+	result := BatchResult{Operations: make([]OperationResult, len(rd.Operations))}
+	for i, operation := range rd.Operations {
+		result.Operations[i] = OperationResult{
+			Index: i,
+			Action: operation.Action,
+			Address: operation.Address,
+			InterfaceName: operation.InterfaceName,
+			Status: OperationStatusSkipped,
+		}
+	}
+
+	// Validate all operations, before anything is applied
+	operations := make([]*resolvedOperation, len(rd.Operations))
+	for i, operation := range rd.Operations {
+		resolved, statusCode, code, err := resolveOperation(operation, policy)
+		if err != nil {
+			zap.L().Error("Rejected batch, because an operation is invalid",
+				zap.String("remote-addr", r.RemoteAddr),
+				zap.String("action", "batch"),
+				zap.Int("index", i),
+				zap.String("operation", operation.Action),
+				zap.String("interface-name", operation.InterfaceName),
+				zap.String("address", operation.Address),
+				zap.Error(err),
+			)
+			result.Operations[i].Status = OperationStatusRejected
+			result.Operations[i].Error = &ResponseError{Code: code, Detail: err.Error()}
+			writeError(w, r, statusCode, code, fmt.Sprintf("Rejected batch, because operation %d is invalid", i), err, Response{
+				Address: operation.Address,
+				InterfaceName: operation.InterfaceName,
+				Data: result,
+			})
+			return
+		}
+		operations[i] = resolved
+		result.Operations[i].Address = resolved.address.IPNet.String()
+	}
+
+	if i, err := s.applyOperations(r, operations, &result); err != nil {
+		writeError(w, r, addressErrorStatus(err), addressErrorCode(err), fmt.Sprintf("Failed to apply operation %d of batch, the batch was rolled back", i), err, Response{
+			Address: result.Operations[i].Address,
+			InterfaceName: result.Operations[i].InterfaceName,
+			Data: result,
+		})
+		return
+	}
+
+	writeSuccess(w, r, Response{
+		Message: fmt.Sprintf("Successfully applied %d operations", len(operations)),
+		Data: result,
+	})
+}
@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func batchTestPolicies(t *testing.T) []AddressPolicy {
+	_, policyIPv6Network, err := net.ParseCIDR("fd69:decd:7b66:8220::/64")
+	assert.NilError(t, err)
+
+	_, policyIPv4Network, err := net.ParseCIDR("192.0.2.0/24")
+	assert.NilError(t, err)
+
+	policyInterfaceNameRegexp, err := regexp.Compile(".*")
+	assert.NilError(t, err)
+
+	return []AddressPolicy{
+		AddressPolicy{IPNetwork: IPNetwork{*policyIPv6Network}, InterfaceNameRegex: Regexp{*policyInterfaceNameRegexp}},
+		AddressPolicy{IPNetwork: IPNetwork{*policyIPv4Network}, InterfaceNameRegex: Regexp{*policyInterfaceNameRegexp}},
+	}
+}
+
+func sendBatchRequest(t *testing.T, policies []AddressPolicy, operations []BatchOperation) (int, BatchResult) {
+	status, response := sendPostRequest(t, &Server{AddressPolicies: policies}, "/batch", BatchRequestData{Operations: operations})
+
+	var result BatchResult
+	decodeResponseData(t, response, &result)
+
+	return status, result
+}
+
+func TestEmptyBatch(t *testing.T) {
+	code, _ := sendBatchRequest(t, batchTestPolicies(t), []BatchOperation{})
+	assert.Equal(t, code, http.StatusBadRequest)
+}
+
+func TestBatchWithInvalidOperation(t *testing.T) {
+	code, result := sendBatchRequest(t, batchTestPolicies(t), []BatchOperation{
+		BatchOperation{Action: "add", Address: "fd69:decd:7b66:8220::1/64", InterfaceName: "lo"},
+		BatchOperation{Action: "replace", Address: "fd69:decd:7b66:8220::2/64", InterfaceName: "lo"},
+	})
+	assert.Equal(t, code, http.StatusBadRequest)
+	assert.Equal(t, result.Operations[0].Status, OperationStatusSkipped)
+	assert.Equal(t, result.Operations[1].Status, OperationStatusRejected)
+	assert.Equal(t, result.Operations[1].Error.Code, ErrorCodeInvalidRequest)
+}
+
+func TestBatchWithPolicyMismatch(t *testing.T) {
+	assert.Assert(t, os.Getenv("NET_LINK") != "")
+
+	link, err := LinkByName(os.Getenv("NET_LINK"))
+	assert.NilError(t, err)
+
+	code, result := sendBatchRequest(t, batchTestPolicies(t), []BatchOperation{
+		BatchOperation{Action: "add", Address: "fd69:decd:7b66:8220::1/64", InterfaceName: os.Getenv("NET_LINK")},
+		BatchOperation{Action: "add", Address: "fd69:decd:7b66:8221::1/64", InterfaceName: os.Getenv("NET_LINK")},
+	})
+	assert.Equal(t, code, http.StatusForbidden)
+	assert.Equal(t, result.Operations[0].Status, OperationStatusSkipped)
+	assert.Equal(t, result.Operations[1].Status, OperationStatusRejected)
+	assert.Equal(t, result.Operations[1].Error.Code, ErrorCodePolicyDenied)
+
+	address, err := ParseAddress("fd69:decd:7b66:8220::1/64")
+	assert.NilError(t, err)
+
+	addressExists, err := AddressExists(link, address)
+	assert.NilError(t, err)
+	assert.Equal(t, addressExists, false)
+}
+
+func TestBatchAddAndDelete(t *testing.T) {
+	assert.Assert(t, os.Getenv("NET_LINK") != "")
+
+	code, result := sendBatchRequest(t, batchTestPolicies(t), []BatchOperation{
+		BatchOperation{Action: "add", Address: "fd69:decd:7b66:8220::1/64", InterfaceName: os.Getenv("NET_LINK")},
+		BatchOperation{Action: "add", Address: "192.0.2.1/24", InterfaceName: os.Getenv("NET_LINK")},
+		BatchOperation{Action: "delete", Address: "192.0.2.2/24", InterfaceName: os.Getenv("NET_LINK")},
+	})
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, result.RolledBack, false)
+	assert.Equal(t, result.Operations[0].Status, OperationStatusApplied)
+	assert.Equal(t, result.Operations[1].Status, OperationStatusApplied)
+	assert.Equal(t, result.Operations[2].Status, OperationStatusUnchanged)
+
+	code, result = sendBatchRequest(t, batchTestPolicies(t), []BatchOperation{
+		BatchOperation{Action: "delete", Address: "fd69:decd:7b66:8220::1/64", InterfaceName: os.Getenv("NET_LINK")},
+		BatchOperation{Action: "delete", Address: "192.0.2.1/24", InterfaceName: os.Getenv("NET_LINK")},
+	})
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, result.Operations[0].Status, OperationStatusApplied)
+	assert.Equal(t, result.Operations[1].Status, OperationStatusApplied)
+}
+
+func TestBatchRollback(t *testing.T) {
+	assert.Assert(t, os.Getenv("NET_LINK") != "")
+
+	link, err := LinkByName(os.Getenv("NET_LINK"))
+	assert.NilError(t, err)
+
+	// The kernel rejects labels, that don't begin with the interface name
+	code, result := sendBatchRequest(t, batchTestPolicies(t), []BatchOperation{
+		BatchOperation{Action: "add", Address: "fd69:decd:7b66:8220::1/64", InterfaceName: os.Getenv("NET_LINK")},
+		BatchOperation{Action: "add", Address: "192.0.2.1/24 invalid-label", InterfaceName: os.Getenv("NET_LINK")},
+		BatchOperation{Action: "add", Address: "192.0.2.2/24", InterfaceName: os.Getenv("NET_LINK")},
+	})
+	assert.Equal(t, code, http.StatusInternalServerError)
+	assert.Equal(t, result.RolledBack, true)
+	assert.Equal(t, result.Operations[0].Status, OperationStatusRolledBack)
+	assert.Equal(t, result.Operations[1].Status, OperationStatusFailed)
+	assert.Equal(t, result.Operations[1].Error.Code, ErrorCodeNetlinkFailure)
+	assert.Equal(t, result.Operations[2].Status, OperationStatusSkipped)
+
+	address, err := ParseAddress("fd69:decd:7b66:8220::1/64")
+	assert.NilError(t, err)
+
+	addressExists, err := AddressExists(link, address)
+	assert.NilError(t, err)
+	assert.Equal(t, addressExists, false)
+}
+
+func TestBatchKeepsLease(t *testing.T) {
+	assert.Assert(t, os.Getenv("NET_LINK") != "")
+
+	store, err := OpenStore(t.TempDir())
+	assert.NilError(t, err)
+
+	server := &Server{AddressPolicies: batchTestPolicies(t), Store: store}
+
+	status, _ := sendPostRequest(t, server, "/add", RequestData{
+		Address: "192.0.2.1/24",
+		InterfaceName: os.Getenv("NET_LINK"),
+		LeaseDuration: 60,
+	})
+	assert.Equal(t, status, http.StatusOK)
+	defer sendPostRequest(t, server, "/delete", RequestData{Address: "192.0.2.1/24", InterfaceName: os.Getenv("NET_LINK")})
+
+	address, err := ParseAddress("192.0.2.1/24")
+	assert.NilError(t, err)
+	record, recorded := store.Record(os.Getenv("NET_LINK"), address)
+	assert.Assert(t, recorded)
+	assert.Assert(t, record.ExpiresAt != nil)
+
+	// Adding the address again in a batch doesn't turn the lease into a permanent address
+	status, _ = sendPostRequest(t, server, "/batch", BatchRequestData{Operations: []BatchOperation{
+		BatchOperation{Action: "add", Address: "192.0.2.1/24", InterfaceName: os.Getenv("NET_LINK")},
+	}})
+	assert.Equal(t, status, http.StatusOK)
+
+	record, recorded = store.Record(os.Getenv("NET_LINK"), address)
+	assert.Assert(t, recorded)
+	assert.Assert(t, record.ExpiresAt != nil)
+}
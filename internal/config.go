@@ -8,7 +8,9 @@ import (
 	"fmt"
 	"os"
 	"io/ioutil"
+	"math"
 	"regexp"
+	"time"
 )
 
 // Holds configuration information
@@ -17,15 +19,145 @@ type Config struct {
 	ClientCACertificatePath string `json:"client_ca_certificate_path"`
 	ServerCertificatePath string `json:"server_certificate_path"`
 	ServerKeyPath string `json:"server_key_path"`
+	StateDirectoryPath string `json:"state_directory_path"`
+	CRLPaths []string `json:"crl_paths"`
+	CRLReloadInterval Duration `json:"crl_reload_interval"`
+	OCSP *OCSPConfig `json:"ocsp"`
+	TLS TLSOptions `json:"tls"`
+	HealthzPort uint16 `json:"healthz_port"`
 	AddressPolicies []AddressPolicy `json:"address_policies"`
+	RoutePolicies []RoutePolicy `json:"route_policies"`
+	ProxyPolicies []ProxyPolicy `json:"proxy_policies"`
+	NeighbourPolicies []NeighbourPolicy `json:"neighbour_policies"`
+}
+
+// Holds configuration for the TLS handshake and the verification of client
+// certificates
+type TLSOptions struct {
+	ClientAuth string `json:"client_auth"`
+	MinVersion string `json:"min_version"`
+	CipherSuites []string `json:"cipher_suites"`
+	Curves []string `json:"curves"`
+	RequireClientAuthEKU bool `json:"require_client_auth_eku"`
+}
+
+// Holds configuration for checking client certificates via OCSP
+type OCSPConfig struct {
+	ResponderURL string `json:"responder_url"`
+	FailMode string `json:"fail_mode"`
+	Timeout Duration `json:"timeout"`
+	CacheDuration Duration `json:"cache_duration"`
 }
 
 // Holds configuration for a address policy
 type AddressPolicy struct {
+	Name string `json:"name"`
+	Action string `json:"action"`
+	IPNetwork IPNetwork `json:"ip_network"`
+	ExcludedNetworks []IPNetwork `json:"excluded_networks"`
+	InterfaceNameRegex Regexp `json:"interface_name_regex"`
+	Link *LinkMatcher `json:"link"`
+	NetnsRegex *Regexp `json:"netns_regex"`
+	Identities []IdentityMatcher `json:"identities"`
+	Enforce string `json:"enforce"`
+	AllowedFlags []string `json:"allowed_flags"`
+	AllowedScopes []string `json:"allowed_scopes"`
+	AllowLabel bool `json:"allow_label"`
+	AllowLifetimes bool `json:"allow_lifetimes"`
+	MaxAddresses int `json:"max_addresses"`
+	MaxAddressesPerIdentity int `json:"max_addresses_per_identity"`
+	Advertisement Advertisement `json:"advertisement"`
+}
+
+// Holds the attributes, that a network link must have for an address policy to
+// apply (unset attributes match every link)
+type LinkMatcher struct {
+	Types []string `json:"types"`
+	Master string `json:"master"`
+	Parent string `json:"parent"`
+	HardwareAddressPrefix string `json:"hardware_address_prefix"`
+	VLANID int `json:"vlan_id"`
+	AliasRegex *Regexp `json:"alias_regex"`
+	Group *uint32 `json:"group"`
+	OperStates []string `json:"operstates"`
+}
+
+// Holds configuration for a route policy
+type RoutePolicy struct {
+	Name string `json:"name"`
+	Destination IPNetwork `json:"destination"`
+	InterfaceNameRegex Regexp `json:"interface_name_regex"`
+	Tables []int `json:"tables"`
+	Gateways []IPNetwork `json:"gateways"`
+	Sources []IPNetwork `json:"sources"`
+	Identities []IdentityMatcher `json:"identities"`
+}
+
+// Holds configuration for a proxy neighbour policy
+type ProxyPolicy struct {
+	Name string `json:"name"`
 	IPNetwork IPNetwork `json:"ip_network"`
 	InterfaceNameRegex Regexp `json:"interface_name_regex"`
+	Identities []IdentityMatcher `json:"identities"`
+	Advertisement Advertisement `json:"advertisement"`
 }
 
+// Holds configuration for a static neighbour policy
+type NeighbourPolicy struct {
+	Name string `json:"name"`
+	IPNetwork IPNetwork `json:"ip_network"`
+	InterfaceNameRegex Regexp `json:"interface_name_regex"`
+	States []string `json:"states"`
+	Identities []IdentityMatcher `json:"identities"`
+}
+
+// Holds the settings for advertising a newly added address
+type Advertisement struct {
+	Count int `json:"count"`
+	Interval Duration `json:"interval"`
+	ARPOperation string `json:"arp_operation"`
+	Override *bool `json:"override"`
+	SolicitedNode bool `json:"solicited_node"`
+	DADTimeout Duration `json:"dad_timeout"`
+	ProbeCount int `json:"probe_count"`
+	ProbeInterval Duration `json:"probe_interval"`
+}
+
+// Operations of the ARP packets used for advertising IPv4 addresses
+const (
+	ARPOperationRequest = "request"
+	ARPOperationReply = "reply"
+)
+
+// Maximum number of packets sent for advertising an address
+const maxAdvertisementCount = 100
+
+// Interval between the packets of an advertisement, if none is configured
+const defaultAdvertisementInterval = time.Second
+
+// Interval between the ARP probes, if none is configured (PROBE_MIN of RFC 5227)
+const defaultProbeInterval = time.Second
+
+// Actions of address policies
+const (
+	PolicyActionAllow = "allow"
+	PolicyActionDeny = "deny"
+)
+
+// Outcomes of evaluating the address policies for an address
+const (
+	PolicyOutcomeAllowed = "allowed"
+	PolicyOutcomeDenied = "denied"
+	PolicyOutcomeExcluded = "excluded"
+	PolicyOutcomeNoMatch = "no_match"
+)
+
+// Modes for enforcing managed addresses, that vanished out-of-band
+const (
+	EnforceModeReassert = "reassert"
+	EnforceModeAlert = "alert"
+)
+
 // Custom type for ip network parsing
 type IPNetwork struct {
 	net.IPNet
@@ -49,6 +181,34 @@ func (ipnet *IPNetwork) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// Custom type for duration parsing (e.g. "500ms")
+type Duration struct {
+	time.Duration
+}
+
+// Implements parsing a json value to the duration value
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration{duration}
+
+	return nil
+}
+
+// Implements formatting the duration value as json value
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
 // Custom type for regexp parsing
 type Regexp struct {
 	regexp.Regexp
@@ -72,6 +232,13 @@ func (r *Regexp) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// Checks whether the regexp was given (the zero value can't be matched, as it
+// was never compiled)
+func (r Regexp) IsSet() bool {
+	// Compiled regexps always name the whole match as their first subexpression
+	return r.SubexpNames() != nil
+}
+
 // Prepends the path prefix to the path, if it's not absolute
 func AbsPath(pathPrefix string, path string) string {
 	if !filepath.IsAbs(path) {
@@ -117,6 +284,12 @@ func ReadConfiguration(configFilePath string) (*Config, error) {
 	config.ClientCACertificatePath = AbsPath(configDirectoryPath, config.ClientCACertificatePath)
 	config.ServerCertificatePath = AbsPath(configDirectoryPath, config.ServerCertificatePath)
 	config.ServerKeyPath = AbsPath(configDirectoryPath, config.ServerKeyPath)
+	if config.StateDirectoryPath != "" {
+		config.StateDirectoryPath = AbsPath(configDirectoryPath, config.StateDirectoryPath)
+	}
+	for i, crlPath := range config.CRLPaths {
+		config.CRLPaths[i] = AbsPath(configDirectoryPath, crlPath)
+	}
 
 	return &config, nil
 }
@@ -139,16 +312,378 @@ func (c Config) Validate() error {
 		return errors.New("The configuration is missing a path to the server key")
 	}
 
+	if c.CRLReloadInterval.Duration < 0 {
+		return errors.New("The configuration has a negative crl reload interval")
+	}
+
+	if err := c.OCSP.validate(); err != nil {
+		return err
+	}
+
+	if err := c.TLS.validate(); err != nil {
+		return err
+	}
+
+	if c.HealthzPort != 0 && c.HealthzPort == c.Port {
+		return errors.New("The configuration has the same port for the health check listener and the server")
+	}
+
 	if len(c.AddressPolicies) == 0 {
 		return errors.New("The configuration is missing address policies")
 	}
 
+	for i, ap := range c.AddressPolicies {
+		if ap.Action != "" && ap.Action != PolicyActionAllow && ap.Action != PolicyActionDeny {
+			return fmt.Errorf("The address policy %d has an invalid action \"%s\" (expected \"allow\" or \"deny\")", i, ap.Action)
+		}
+
+		// Deny policies without interface restriction still need a regexp, that
+		// matches every interface (e.g. ".*")
+		if !ap.InterfaceNameRegex.IsSet() {
+			return fmt.Errorf("The address policy %d is missing an interface name regex", i)
+		}
+
+		for _, im := range ap.Identities {
+			if !im.IsValid() {
+				return fmt.Errorf("The address policy %d references an unknown identity matcher \"%s\"", i, im)
+			}
+		}
+
+		if err := ap.Link.validate(i); err != nil {
+			return err
+		}
+
+		for _, en := range ap.ExcludedNetworks {
+			excludedNetworkOnes, _ := en.Mask.Size()
+			policyNetworkOnes, _ := ap.IPNetwork.Mask.Size()
+			if !ap.IPNetwork.Contains(en.IP) || excludedNetworkOnes < policyNetworkOnes {
+				return fmt.Errorf("The address policy %d excludes the network \"%s\", which isn't part of its ip network", i, en.String())
+			}
+		}
+
+		for _, flag := range ap.AllowedFlags {
+			if _, ok := settableAddressFlags[flag]; !ok {
+				return fmt.Errorf("The address policy %d allows an unknown address flag \"%s\"", i, flag)
+			}
+		}
+
+		for _, scope := range ap.AllowedScopes {
+			if _, err := ParseAddressScope(scope); err != nil {
+				return fmt.Errorf("The address policy %d allows an unknown address scope \"%s\"", i, scope)
+			}
+		}
+
+		if err := ap.Advertisement.validate(fmt.Sprintf("address policy %d", i)); err != nil {
+			return err
+		}
+
+		if ap.Enforce != "" && ap.Enforce != EnforceModeReassert && ap.Enforce != EnforceModeAlert {
+			return fmt.Errorf("The address policy %d has an invalid enforce mode \"%s\" (expected \"reassert\" or \"alert\")", i, ap.Enforce)
+		}
+
+		if ap.MaxAddresses < 0 || ap.MaxAddressesPerIdentity < 0 {
+			return fmt.Errorf("The address policy %d has a negative address limit", i)
+		}
+
+		// The owners of addresses are only known from their records
+		if ap.MaxAddressesPerIdentity > 0 && c.StateDirectoryPath == "" {
+			return fmt.Errorf("The address policy %d limits the addresses per client identity, which requires a state directory", i)
+		}
+	}
+
+	for i, pp := range c.ProxyPolicies {
+		if pp.IPNetwork.IP == nil {
+			return fmt.Errorf("The proxy policy %d is missing an ip network", i)
+		}
+
+		if !pp.InterfaceNameRegex.IsSet() {
+			return fmt.Errorf("The proxy policy %d is missing an interface name regex", i)
+		}
+
+		for _, im := range pp.Identities {
+			if !im.IsValid() {
+				return fmt.Errorf("The proxy policy %d references an unknown identity matcher \"%s\"", i, im)
+			}
+		}
+
+		if err := pp.Advertisement.validate(fmt.Sprintf("proxy policy %d", i)); err != nil {
+			return err
+		}
+	}
+
+	for i, np := range c.NeighbourPolicies {
+		if np.IPNetwork.IP == nil {
+			return fmt.Errorf("The neighbour policy %d is missing an ip network", i)
+		}
+
+		if !np.InterfaceNameRegex.IsSet() {
+			return fmt.Errorf("The neighbour policy %d is missing an interface name regex", i)
+		}
+
+		for _, im := range np.Identities {
+			if !im.IsValid() {
+				return fmt.Errorf("The neighbour policy %d references an unknown identity matcher \"%s\"", i, im)
+			}
+		}
+
+		for _, state := range np.States {
+			if _, err := ParseNeighbourState(state); err != nil {
+				return fmt.Errorf("The neighbour policy %d allows an unknown neighbour state \"%s\"", i, state)
+			}
+		}
+	}
+
+	for i, rp := range c.RoutePolicies {
+		if rp.Destination.IP == nil {
+			return fmt.Errorf("The route policy %d is missing a destination network", i)
+		}
+
+		if !rp.InterfaceNameRegex.IsSet() {
+			return fmt.Errorf("The route policy %d is missing an interface name regex", i)
+		}
+
+		for _, im := range rp.Identities {
+			if !im.IsValid() {
+				return fmt.Errorf("The route policy %d references an unknown identity matcher \"%s\"", i, im)
+			}
+		}
+
+		for _, table := range rp.Tables {
+			if table <= 0 || int64(table) > math.MaxUint32 {
+				return fmt.Errorf("The route policy %d allows an invalid routing table %d", i, table)
+			}
+		}
+
+		for _, network := range append(append([]IPNetwork{}, rp.Gateways...), rp.Sources...) {
+			if (network.IP.To4() == nil) != (rp.Destination.IP.To4() == nil) {
+				return fmt.Errorf("The route policy %d allows the network \"%s\", which doesn't match the address family of its destination", i, network.String())
+			}
+		}
+	}
+
 	return nil
 }
 
-// Checks whether an interface name and address is allowed by an address policy
-func (ap AddressPolicy) Allows(interfaceName string, address CIDRAddress) bool {
+// Validates the advertisement settings of a policy
+func (a Advertisement) validate(policyName string) error {
+	if a.Count < 0 || a.Count > maxAdvertisementCount {
+		return fmt.Errorf("The %s has an invalid advertisement count %d (expected 0 to %d)", policyName, a.Count, maxAdvertisementCount)
+	}
+
+	if a.Interval.Duration < 0 {
+		return fmt.Errorf("The %s has a negative advertisement interval", policyName)
+	}
+
+	if a.DADTimeout.Duration < 0 {
+		return fmt.Errorf("The %s has a negative dad timeout", policyName)
+	}
+
+	if a.ProbeCount < 0 || a.ProbeCount > maxAdvertisementCount {
+		return fmt.Errorf("The %s has an invalid probe count %d (expected 0 to %d)", policyName, a.ProbeCount, maxAdvertisementCount)
+	}
+
+	if a.ProbeInterval.Duration < 0 {
+		return fmt.Errorf("The %s has a negative probe interval", policyName)
+	}
+
+	if a.ARPOperation != "" && a.ARPOperation != ARPOperationRequest && a.ARPOperation != ARPOperationReply {
+		return fmt.Errorf("The %s has an invalid arp operation \"%s\" (expected \"request\" or \"reply\")", policyName, a.ARPOperation)
+	}
+
+	return nil
+}
+
+// Checks whether an address policy applies to a client identity (a policy
+// without identities applies to every client)
+func (ap AddressPolicy) AppliesTo(identity ClientIdentity) bool {
+	return matchesAnyIdentity(ap.Identities, identity)
+}
+
+// Checks whether any of the identity matchers matches a client identity (no
+// matchers match every client)
+func matchesAnyIdentity(identities []IdentityMatcher, identity ClientIdentity) bool {
+	if len(identities) == 0 {
+		return true
+	}
+
+	for _, im := range identities {
+		if im.Matches(identity) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the name of an address policy for messages (defaults to its ip network)
+func (ap AddressPolicy) DisplayName() string {
+	if ap.Name != "" {
+		return ap.Name
+	}
+	return ap.IPNetwork.String()
+}
+
+// Returns the enforce mode of an address policy (defaults to re-asserting)
+func (ap AddressPolicy) EnforceMode() string {
+	if ap.Enforce == "" {
+		return EnforceModeReassert
+	}
+	return ap.Enforce
+}
+
+// Returns the number of packets sent for advertising an address (defaults to one)
+func (a Advertisement) PacketCount() int {
+	if a.Count == 0 {
+		return 1
+	}
+	return a.Count
+}
+
+// Returns the interval between the packets of an advertisement
+func (a Advertisement) PacketInterval() time.Duration {
+	if a.Interval.Duration == 0 {
+		return defaultAdvertisementInterval
+	}
+	return a.Interval.Duration
+}
+
+// Returns the interval between ARP probes
+func (a Advertisement) ProbeWait() time.Duration {
+	if a.ProbeInterval.Duration == 0 {
+		return defaultProbeInterval
+	}
+	return a.ProbeInterval.Duration
+}
+
+// Checks whether neighbour advertisements have the override flag set (defaults to true)
+func (a Advertisement) IsOverride() bool {
+	return a.Override == nil || *a.Override
+}
+
+// Returns the advertisement settings of the first address policy allowing an
+// interface name and address
+func advertisementFor(policies []AddressPolicy, interfaceName string, address CIDRAddress) Advertisement {
+	for _, p := range policies {
+		if p.Allows(interfaceName, address) {
+			return p.Advertisement
+		}
+	}
+	return Advertisement{}
+}
+
+// Returns the address policies, that apply to a client identity
+func PoliciesForIdentity(policies []AddressPolicy, identity ClientIdentity) []AddressPolicy {
+	var identityPolicies []AddressPolicy
+	for _, p := range policies {
+		if p.AppliesTo(identity) {
+			identityPolicies = append(identityPolicies, p)
+		}
+	}
+	return identityPolicies
+}
+
+// Checks whether the options of an address are allowed by an address policy
+// (addresses without options and with global scope are always allowed)
+func (ap AddressPolicy) AllowsOptions(options AddressOptions) bool {
+	for _, flag := range options.Flags {
+		if !containsString(ap.AllowedFlags, flag) {
+			return false
+		}
+	}
+
+	if options.Scope != "" && options.Scope != "global" && !containsString(ap.AllowedScopes, options.Scope) {
+		return false
+	}
+
+	if options.Label != "" && !ap.AllowLabel {
+		return false
+	}
+
+	if (options.ValidLifetime != nil || options.PreferredLifetime != nil) && !ap.AllowLifetimes {
+		return false
+	}
+
+	return true
+}
+
+// Checks whether an address policy denies matching addresses
+func (ap AddressPolicy) IsDeny() bool {
+	return ap.Action == PolicyActionDeny
+}
+
+// Checks whether an interface name and address matches the network of an
+// address policy, ignoring its action and excluded networks
+func (ap AddressPolicy) matches(interfaceName string, address CIDRAddress) bool {
 	return ap.InterfaceNameRegex.MatchString(interfaceName) &&
 		ap.IPNetwork.Mask.String() == address.Mask.String() &&
 		ap.IPNetwork.IP.Mask(ap.IPNetwork.Mask).Equal(address.IP.Mask(address.Mask))
 }
+
+// Checks whether an address is part of an excluded network of an address policy
+func (ap AddressPolicy) excludes(address CIDRAddress) bool {
+	for _, en := range ap.ExcludedNetworks {
+		if en.Contains(address.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks whether an interface name and address is allowed by an address policy
+// (deny policies never allow anything)
+func (ap AddressPolicy) Allows(interfaceName string, address CIDRAddress) bool {
+	return !ap.IsDeny() && ap.matches(interfaceName, address) && !ap.excludes(address)
+}
+
+// Checks whether an interface name and address is denied by a deny policy
+// (the address matches regardless of its prefix length)
+func (ap AddressPolicy) Denies(interfaceName string, address CIDRAddress) bool {
+	return ap.IsDeny() && ap.InterfaceNameRegex.MatchString(interfaceName) && ap.IPNetwork.Contains(address.IP)
+}
+
+// Holds the outcome of evaluating the address policies for an address and the
+// name of the policy, that produced it
+type PolicyDecision struct {
+	Allowed bool `json:"allowed"`
+	Outcome string `json:"outcome"`
+	Policy string `json:"policy,omitempty"`
+}
+
+// Evaluates the address policies for an interface name and address: A deny
+// policy denying it takes precedence over everything else, otherwise the first
+// policy allowing it decides. An address excluded by a matching policy is only
+// rejected, if no other policy allows it.
+func DecideAddress(policy []AddressPolicy, interfaceName string, address CIDRAddress) PolicyDecision {
+	for _, p := range policy {
+		if p.Denies(interfaceName, address) {
+			return PolicyDecision{false, PolicyOutcomeDenied, p.DisplayName()}
+		}
+	}
+
+	for _, p := range policy {
+		if p.Allows(interfaceName, address) {
+			return PolicyDecision{true, PolicyOutcomeAllowed, p.DisplayName()}
+		}
+	}
+
+	for _, p := range policy {
+		if !p.IsDeny() && p.matches(interfaceName, address) {
+			return PolicyDecision{false, PolicyOutcomeExcluded, p.DisplayName()}
+		}
+	}
+
+	return PolicyDecision{false, PolicyOutcomeNoMatch, ""}
+}
+
+// Returns the reason of a policy decision for messages
+func (d PolicyDecision) Reason() string {
+	switch d.Outcome {
+	case PolicyOutcomeAllowed:
+		return fmt.Sprintf("it's allowed by policy \"%s\"", d.Policy)
+	case PolicyOutcomeDenied:
+		return fmt.Sprintf("it's denied by policy \"%s\"", d.Policy)
+	case PolicyOutcomeExcluded:
+		return fmt.Sprintf("it's excluded by policy \"%s\"", d.Policy)
+	}
+	return "no matching policy was found"
+}
@@ -1,7 +1,10 @@
 package internal
 
 import (
+	"fmt"
+	"net"
 	"path/filepath"
+	"regexp"
 	"testing"
 
 	"gotest.tools/assert"
@@ -53,3 +56,164 @@ func TestInvalidAddressPolicyParameters(t *testing.T) {
 	_, err = ReadConfiguration("../test/config-address-policy-invalid-interface-name-regex.json")
 	assert.Error(t, err, "error parsing regexp: missing argument to repetition operator: `*`")
 }
+
+func TestDenyAddressPolicyWithoutInterfaceNameRegex(t *testing.T) {
+	_, err := ReadConfiguration("../test/config-address-policy-deny-without-interface-name-regex.json")
+	assert.Error(t, err, "The address policy 1 is missing an interface name regex")
+}
+
+func TestInvalidAddressPolicyIdentity(t *testing.T) {
+	_, err := ReadConfiguration("../test/config-address-policy-invalid-identity.json")
+	assert.Error(t, err, "The address policy 0 references an unknown identity matcher \"serial:1234\"")
+}
+
+func TestInvalidAddressPolicyEnforceMode(t *testing.T) {
+	_, err := ReadConfiguration("../test/config-address-policy-invalid-enforce.json")
+	assert.Error(t, err, "The address policy 0 has an invalid enforce mode \"ignore\" (expected \"reassert\" or \"alert\")")
+}
+
+func TestStateDirectoryConfiguration(t *testing.T) {
+	configFilePath := "../test/config-state-directory.json"
+	config, err := ReadConfiguration(configFilePath)
+	assert.NilError(t, err)
+
+	configFilePath, err = filepath.Abs(configFilePath)
+	assert.NilError(t, err)
+
+	assert.Equal(t, config.StateDirectoryPath, AbsPath(filepath.Dir(configFilePath), "state"))
+}
+
+func TestInvalidAddressPolicyExcludedNetwork(t *testing.T) {
+	_, err := ReadConfiguration("../test/config-address-policy-invalid-excluded-network.json")
+	assert.Error(t, err, "The address policy 0 excludes the network \"198.51.100.0/28\", which isn't part of its ip network")
+}
+
+func TestInvalidAddressPolicyAllowedFlag(t *testing.T) {
+	_, err := ReadConfiguration("../test/config-address-policy-invalid-allowed-flag.json")
+	assert.Error(t, err, "The address policy 0 allows an unknown address flag \"permanent\"")
+}
+
+func TestInvalidAddressPolicyAdvertisement(t *testing.T) {
+	_, err := ReadConfiguration("../test/config-address-policy-invalid-advertisement.json")
+	assert.Error(t, err, "The address policy 0 has an invalid arp operation \"announce\" (expected \"request\" or \"reply\")")
+}
+
+func TestAdvertisementCount(t *testing.T) {
+	// A count of 0 selects the default
+	assert.NilError(t, Advertisement{}.validate("address policy 0"))
+	assert.Error(t, Advertisement{Count: maxAdvertisementCount + 1}.validate("address policy 0"), fmt.Sprintf("The address policy 0 has an invalid advertisement count %d (expected 0 to %d)", maxAdvertisementCount + 1, maxAdvertisementCount))
+}
+
+func TestInvalidRoutePolicyGateway(t *testing.T) {
+	_, err := ReadConfiguration("../test/config-route-policy-invalid-gateway.json")
+	assert.Error(t, err, "The route policy 0 allows the network \"fd69:decd:7b66:8220::1/128\", which doesn't match the address family of its destination")
+}
+
+func TestProxyPolicyWithoutIPNetwork(t *testing.T) {
+	_, err := ReadConfiguration("../test/config-proxy-policy-without-ip-network.json")
+	assert.Error(t, err, "The proxy policy 0 is missing an ip network")
+}
+
+func TestInvalidNeighbourPolicyState(t *testing.T) {
+	_, err := ReadConfiguration("../test/config-neighbour-policy-invalid-state.json")
+	assert.Error(t, err, "The neighbour policy 0 allows an unknown neighbour state \"stale\"")
+}
+
+func TestNeighbourPolicyWithoutIPNetwork(t *testing.T) {
+	_, err := ReadConfiguration("../test/config-neighbour-policy-without-ip-network.json")
+	assert.Error(t, err, "The neighbour policy 0 is missing an ip network")
+}
+
+func TestInvalidAddressPolicyAction(t *testing.T) {
+	_, err := ReadConfiguration("../test/config-address-policy-invalid-action.json")
+	assert.Error(t, err, "The address policy 0 has an invalid action \"reject\" (expected \"allow\" or \"deny\")")
+}
+
+func TestInvalidAddressPolicyLink(t *testing.T) {
+	_, err := ReadConfiguration("../test/config-address-policy-invalid-link.json")
+	assert.Error(t, err, "The address policy 0 matches an unknown operstate \"sleeping\"")
+}
+
+func TestInvalidAddressPolicyLimitWithoutStateDirectory(t *testing.T) {
+	_, err := ReadConfiguration("../test/config-address-policy-limit-without-state.json")
+	assert.Error(t, err, "The address policy 0 limits the addresses per client identity, which requires a state directory")
+}
+
+func TestDecideAddress(t *testing.T) {
+	_, allowedIPNetwork, err := net.ParseCIDR("198.51.100.0/24")
+	assert.NilError(t, err)
+	_, excludedIPNetwork, err := net.ParseCIDR("198.51.100.0/28")
+	assert.NilError(t, err)
+	_, gatewayIPNetwork, err := net.ParseCIDR("198.51.100.254/32")
+	assert.NilError(t, err)
+
+	policies := []AddressPolicy{
+		{
+			Name: "team-a",
+			IPNetwork: IPNetwork{*allowedIPNetwork},
+			ExcludedNetworks: []IPNetwork{IPNetwork{*excludedIPNetwork}},
+			InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")},
+		},
+		{
+			Name: "gateway",
+			Action: PolicyActionDeny,
+			IPNetwork: IPNetwork{*gatewayIPNetwork},
+			InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")},
+		},
+	}
+
+	for _, tc := range []struct {
+		address string
+		outcome string
+		policy string
+	}{
+		{"198.51.100.20/24", PolicyOutcomeAllowed, "team-a"},
+		{"198.51.100.1/24", PolicyOutcomeExcluded, "team-a"},
+		// Deny policies match regardless of the prefix length
+		{"198.51.100.254/24", PolicyOutcomeDenied, "gateway"},
+		{"198.51.100.20/25", PolicyOutcomeNoMatch, ""},
+	} {
+		address, err := ParseAddress(tc.address)
+		assert.NilError(t, err)
+
+		decision := DecideAddress(policies, "eth0", address)
+		assert.Equal(t, decision.Outcome, tc.outcome, tc.address)
+		assert.Equal(t, decision.Policy, tc.policy, tc.address)
+		assert.Equal(t, decision.Allowed, tc.outcome == PolicyOutcomeAllowed, tc.address)
+	}
+
+	// A deny policy takes precedence over a policy allowing the address exactly
+	policies = append(policies, AddressPolicy{
+		Name: "gateway-admin",
+		IPNetwork: IPNetwork{*gatewayIPNetwork},
+		InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")},
+	})
+	address, err := ParseAddress("198.51.100.254/32")
+	assert.NilError(t, err)
+	assert.Equal(t, DecideAddress(policies, "eth0", address).Policy, "gateway")
+
+	// Excluded addresses may still be allowed by another policy
+	policies = append(policies, AddressPolicy{
+		Name: "reserved",
+		IPNetwork: IPNetwork{*allowedIPNetwork},
+		InterfaceNameRegex: Regexp{*regexp.MustCompile("^eth0$")},
+	})
+	address, err = ParseAddress("198.51.100.1/24")
+	assert.NilError(t, err)
+	assert.Equal(t, DecideAddress(policies, "eth0", address).Policy, "reserved")
+}
+
+func TestRoutePolicyWithoutInterfaceNameRegex(t *testing.T) {
+	_, err := ReadConfiguration("../test/config-route-policy-without-interface-name-regex.json")
+	assert.Error(t, err, "The route policy 0 is missing an interface name regex")
+}
+
+func TestProxyPolicyWithoutInterfaceNameRegex(t *testing.T) {
+	_, err := ReadConfiguration("../test/config-proxy-policy-without-interface-name-regex.json")
+	assert.Error(t, err, "The proxy policy 0 is missing an interface name regex")
+}
+
+func TestNeighbourPolicyWithoutInterfaceNameRegex(t *testing.T) {
+	_, err := ReadConfiguration("../test/config-neighbour-policy-without-interface-name-regex.json")
+	assert.Error(t, err, "The neighbour policy 0 is missing an interface name regex")
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Number of events kept by the event log
+const eventLogCapacity = 256
+
+// Type of an event
+type EventType string
+
+const (
+	EventTypeAddressRemoved EventType = "address_removed"
+	EventTypeAddressReasserted EventType = "address_reasserted"
+	EventTypeReassertFailed EventType = "reassert_failed"
+	EventTypeLeaseExpired EventType = "lease_expired"
+)
+
+// Holds an event about the managed addresses
+type Event struct {
+	Time time.Time `json:"time"`
+	Type EventType `json:"type"`
+	InterfaceName string `json:"interface_name"`
+	Address string `json:"address"`
+	Message string `json:"message"`
+}
+
+// Keeps the most recent events in memory (a nil event log drops all events)
+type EventLog struct {
+	mutex sync.Mutex
+	events []Event
+}
+
+// Holds the list of events returned by an events request
+type EventList struct {
+	Events []Event `json:"events"`
+}
+
+// Creates an empty event log
+func NewEventLog() *EventLog {
+	return &EventLog{}
+}
+
+// Publishes an event
+func (el *EventLog) Publish(event Event) {
+	if el == nil {
+		return
+	}
+
+	el.mutex.Lock()
+	defer el.mutex.Unlock()
+
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	el.events = append(el.events, event)
+	if len(el.events) > eventLogCapacity {
+		el.events = el.events[len(el.events)-eventLogCapacity:]
+	}
+}
+
+// Returns a copy of all events
+func (el *EventLog) Events() []Event {
+	if el == nil {
+		return nil
+	}
+
+	el.mutex.Lock()
+	defer el.mutex.Unlock()
+
+	events := make([]Event, len(el.events))
+	copy(events, el.events)
+	return events
+}
+
+// Renders the event list as plain text (one event per line)
+func (el EventList) PlainText() string {
+	var sb strings.Builder
+	for _, e := range el.Events {
+		fmt.Fprintf(&sb, "%s %s %s %s\n", e.Time.Format(time.RFC3339), e.Type, e.InterfaceName, e.Address)
+	}
+	return sb.String()
+}
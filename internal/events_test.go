@@ -0,0 +1,25 @@
+package internal
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestEventLogCapacity(t *testing.T) {
+	events := NewEventLog()
+
+	for i := 0; i < eventLogCapacity + 10; i++ {
+		events.Publish(Event{Type: EventTypeAddressRemoved, InterfaceName: "eth0"})
+	}
+
+	assert.Equal(t, len(events.Events()), eventLogCapacity)
+	assert.Assert(t, !events.Events()[0].Time.IsZero())
+}
+
+func TestNilEventLog(t *testing.T) {
+	var events *EventLog
+
+	events.Publish(Event{Type: EventTypeAddressRemoved, InterfaceName: "eth0"})
+	assert.Equal(t, len(events.Events()), 0)
+}
@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Kinds of identity matchers
+const (
+	IdentityKindCommonName = "cn"
+	IdentityKindOrganizationalUnit = "ou"
+	IdentityKindDNSName = "dns"
+	IdentityKindURI = "uri"
+)
+
+// Holds the identity of a client derived from its certificate
+type ClientIdentity struct {
+	CommonName string `json:"common_name,omitempty"`
+	OrganizationalUnits []string `json:"organizational_units,omitempty"`
+	DNSNames []string `json:"dns_names,omitempty"`
+	URIs []string `json:"uris,omitempty"`
+}
+
+// Matches a client identity by one of its attributes (written as "<kind>:<value>")
+type IdentityMatcher struct {
+	Kind string
+	Value string
+}
+
+// Derives the identity of a client from its certificate
+func IdentityFromCertificate(certificate *x509.Certificate) ClientIdentity {
+	identity := ClientIdentity{
+		CommonName: certificate.Subject.CommonName,
+		OrganizationalUnits: certificate.Subject.OrganizationalUnit,
+		DNSNames: certificate.DNSNames,
+	}
+
+	for _, uri := range certificate.URIs {
+		identity.URIs = append(identity.URIs, uri.String())
+	}
+
+	return identity
+}
+
+// Derives the identity of a client from the certificate of a request
+func requestIdentity(r *http.Request) ClientIdentity {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ClientIdentity{}
+	}
+
+	return IdentityFromCertificate(r.TLS.PeerCertificates[0])
+}
+
+// Returns a short description of a client identity for logging
+func (ci ClientIdentity) String() string {
+	if ci.CommonName != "" {
+		return IdentityKindCommonName + ":" + ci.CommonName
+	}
+	if len(ci.URIs) > 0 {
+		return IdentityKindURI + ":" + ci.URIs[0]
+	}
+	if len(ci.DNSNames) > 0 {
+		return IdentityKindDNSName + ":" + ci.DNSNames[0]
+	}
+	return ""
+}
+
+// Parses a client identity from a comma-separated list of its attributes (e.g.
+// "cn:client,ou:team-a")
+func ParseClientIdentity(s string) (ClientIdentity, error) {
+	var identity ClientIdentity
+	if s == "" {
+		return identity, nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		im := ParseIdentityMatcher(strings.TrimSpace(part))
+		if !im.IsValid() {
+			return identity, fmt.Errorf("invalid identity attribute \"%s\" (expected \"<kind>:<value>\" with kind cn, ou, dns or uri)", part)
+		}
+
+		switch im.Kind {
+		case IdentityKindCommonName:
+			identity.CommonName = im.Value
+		case IdentityKindOrganizationalUnit:
+			identity.OrganizationalUnits = append(identity.OrganizationalUnits, im.Value)
+		case IdentityKindDNSName:
+			identity.DNSNames = append(identity.DNSNames, im.Value)
+		case IdentityKindURI:
+			identity.URIs = append(identity.URIs, im.Value)
+		}
+	}
+
+	return identity, nil
+}
+
+// Parses an identity matcher
+func ParseIdentityMatcher(s string) IdentityMatcher {
+	kind, value, found := strings.Cut(s, ":")
+	if !found {
+		return IdentityMatcher{Value: s}
+	}
+
+	return IdentityMatcher{Kind: kind, Value: value}
+}
+
+// Implements parsing a json value to the identity matcher value
+func (im *IdentityMatcher) UnmarshalJSON(data []byte) error {
+	var s string
+
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	*im = ParseIdentityMatcher(s)
+
+	return nil
+}
+
+// Implements serializing the identity matcher value to a json value
+func (im IdentityMatcher) MarshalJSON() ([]byte, error) {
+	return json.Marshal(im.String())
+}
+
+// Returns the identity matcher in its textual form
+func (im IdentityMatcher) String() string {
+	if im.Kind == "" {
+		return im.Value
+	}
+	return im.Kind + ":" + im.Value
+}
+
+// Checks whether the kind of the identity matcher is known
+func (im IdentityMatcher) IsValid() bool {
+	switch im.Kind {
+	case IdentityKindCommonName, IdentityKindOrganizationalUnit, IdentityKindDNSName, IdentityKindURI:
+		return im.Value != ""
+	default:
+		return false
+	}
+}
+
+// Checks whether a client identity is matched
+func (im IdentityMatcher) Matches(identity ClientIdentity) bool {
+	switch im.Kind {
+	case IdentityKindCommonName:
+		return identity.CommonName == im.Value
+	case IdentityKindOrganizationalUnit:
+		return containsString(identity.OrganizationalUnits, im.Value)
+	case IdentityKindDNSName:
+		return containsString(identity.DNSNames, im.Value)
+	case IdentityKindURI:
+		return containsString(identity.URIs, im.Value)
+	default:
+		return false
+	}
+}
+
+// Checks whether a string is contained in a list of strings
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func testClientCertificate(t *testing.T) *x509.Certificate {
+	spiffeID, err := url.Parse("spiffe://example.org/team-a/worker")
+	assert.NilError(t, err)
+
+	return &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName: "team-a",
+			OrganizationalUnit: []string{"networking", "ops"},
+		},
+		DNSNames: []string{"worker.team-a.example.org"},
+		URIs: []*url.URL{spiffeID},
+	}
+}
+
+func TestIdentityFromCertificate(t *testing.T) {
+	identity := IdentityFromCertificate(testClientCertificate(t))
+
+	assert.Equal(t, identity.CommonName, "team-a")
+	assert.DeepEqual(t, identity.OrganizationalUnits, []string{"networking", "ops"})
+	assert.DeepEqual(t, identity.DNSNames, []string{"worker.team-a.example.org"})
+	assert.DeepEqual(t, identity.URIs, []string{"spiffe://example.org/team-a/worker"})
+	assert.Equal(t, identity.String(), "cn:team-a")
+}
+
+func TestIdentityMatcher(t *testing.T) {
+	identity := IdentityFromCertificate(testClientCertificate(t))
+
+	cases := map[string]bool{
+		"cn:team-a": true,
+		"cn:team-b": false,
+		"ou:ops": true,
+		"ou:dev": false,
+		"dns:worker.team-a.example.org": true,
+		"dns:team-a.example.org": false,
+		"uri:spiffe://example.org/team-a/worker": true,
+		"uri:spiffe://example.org/team-b/worker": false,
+	}
+
+	for s, matches := range cases {
+		im := ParseIdentityMatcher(s)
+		assert.Assert(t, im.IsValid(), s)
+		assert.Equal(t, im.String(), s)
+		assert.Equal(t, im.Matches(identity), matches, s)
+	}
+}
+
+func TestInvalidIdentityMatcher(t *testing.T) {
+	assert.Assert(t, !ParseIdentityMatcher("team-a").IsValid())
+	assert.Assert(t, !ParseIdentityMatcher("serial:1234").IsValid())
+	assert.Assert(t, !ParseIdentityMatcher("cn:").IsValid())
+}
+
+func TestPoliciesForIdentity(t *testing.T) {
+	identity := IdentityFromCertificate(testClientCertificate(t))
+
+	policies := []AddressPolicy{
+		AddressPolicy{},
+		AddressPolicy{Identities: []IdentityMatcher{ParseIdentityMatcher("cn:team-b"), ParseIdentityMatcher("ou:ops")}},
+		AddressPolicy{Identities: []IdentityMatcher{ParseIdentityMatcher("cn:team-b")}},
+	}
+
+	assert.Equal(t, len(PoliciesForIdentity(policies, identity)), 2)
+	assert.Equal(t, len(PoliciesForIdentity(policies, ClientIdentity{})), 1)
+}
+
+func TestParseClientIdentity(t *testing.T) {
+	identity, err := ParseClientIdentity("cn:team-a, ou:networking,ou:ops,uri:spiffe://example.org/team-a/worker")
+	assert.NilError(t, err)
+	assert.Equal(t, identity.CommonName, "team-a")
+	assert.DeepEqual(t, identity.OrganizationalUnits, []string{"networking", "ops"})
+	assert.DeepEqual(t, identity.URIs, []string{"spiffe://example.org/team-a/worker"})
+
+	identity, err = ParseClientIdentity("")
+	assert.NilError(t, err)
+	assert.Equal(t, identity.String(), "")
+
+	_, err = ParseClientIdentity("team-a")
+	assert.ErrorContains(t, err, "invalid identity attribute \"team-a\"")
+}
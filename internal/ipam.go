@@ -1,7 +1,14 @@
 package internal
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
 	"net"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/vishvananda/netlink"
 	"github.com/google/gopacket"
@@ -10,17 +17,264 @@ import (
 	"go.uber.org/zap"
 )
 
-type NetworkLink = *netlink.Link
+type NetworkLink = *Link
 type CIDRAddress = *netlink.Addr
 
-// Returns a network link based on the interface name
+// Error returned, when an address was added, but couldn't be advertised
+type AdvertiseError struct {
+	Err error
+}
+
+func (e *AdvertiseError) Error() string {
+	return fmt.Sprintf("failed to advertise address: %v", e.Err)
+}
+
+func (e *AdvertiseError) Unwrap() error {
+	return e.Err
+}
+
+// Error returned, when the duplicate address detection or an ARP probe found
+// another host using an address (the hardware address is only known for ARP)
+type DuplicateAddressError struct {
+	HardwareAddr net.HardwareAddr
+}
+
+func (e *DuplicateAddressError) Error() string {
+	if e.HardwareAddr != nil {
+		return fmt.Sprintf("address conflict detected, the address is already in use by %s", e.HardwareAddr)
+	}
+	return "duplicate address detection failed, the address is already in use on the network"
+}
+
+// Error returned, when the duplicate address detection didn't finish in time
+type DADTimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *DADTimeoutError) Error() string {
+	return fmt.Sprintf("duplicate address detection didn't finish within %s", e.Timeout)
+}
+
+// Error returned, when an address is already present with another label or
+// scope, which can't be changed in place
+type AddressOptionConflictError struct {
+	Option string
+}
+
+func (e *AddressOptionConflictError) Error() string {
+	return fmt.Sprintf("the address is already present with another %s", e.Option)
+}
+
+// Interval in which the state of the duplicate address detection is polled
+const dadPollInterval = 50 * time.Millisecond
+
+// Timeout of a single receive call while waiting for answers to ARP probes
+const probeReceiveTimeout = 50 * time.Millisecond
+
+// Checks whether an error was caused by a missing network link
+func IsLinkNotFound(err error) bool {
+	var linkNotFoundError netlink.LinkNotFoundError
+	return errors.As(err, &linkNotFoundError)
+}
+
+// Returns a network link of the server's network namespace based on the interface name
 func LinkByName(interfaceName string) (NetworkLink, error) {
-	link, err := netlink.LinkByName(interfaceName)
-	if err != nil {
-		return nil, err
+	return (*Namespace)(nil).LinkByName(interfaceName)
+}
+
+// Holds information about a cidr address present on a network link
+type AddressInfo struct {
+	InterfaceName string `json:"interface_name"`
+	Address string `json:"address"`
+	PrefixLength int `json:"prefix_length"`
+	Family string `json:"family"`
+	Scope string `json:"scope"`
+	Flags []string `json:"flags"`
+	ValidLifetime *int `json:"valid_lifetime"`
+	PreferredLifetime *int `json:"preferred_lifetime"`
+}
+
+// Names of the address scopes as used by iproute2
+var addressScopeNames = map[int]string{
+	unix.RT_SCOPE_UNIVERSE: "global",
+	unix.RT_SCOPE_SITE: "site",
+	unix.RT_SCOPE_LINK: "link",
+	unix.RT_SCOPE_HOST: "host",
+	unix.RT_SCOPE_NOWHERE: "nowhere",
+}
+
+// Names of the address flags as used by iproute2 (IFA_F_SECONDARY and
+// IFA_F_TEMPORARY share a bit and are handled separately)
+var addressFlagNames = []struct {
+	flag int
+	name string
+}{
+	{unix.IFA_F_NODAD, "nodad"},
+	{unix.IFA_F_OPTIMISTIC, "optimistic"},
+	{unix.IFA_F_DADFAILED, "dadfailed"},
+	{unix.IFA_F_HOMEADDRESS, "home"},
+	{unix.IFA_F_DEPRECATED, "deprecated"},
+	{unix.IFA_F_TENTATIVE, "tentative"},
+	{unix.IFA_F_PERMANENT, "permanent"},
+	{unix.IFA_F_MANAGETEMPADDR, "mngtmpaddr"},
+	{unix.IFA_F_NOPREFIXROUTE, "noprefixroute"},
+	{unix.IFA_F_MCAUTOJOIN, "autojoin"},
+	{unix.IFA_F_STABLE_PRIVACY, "stable-privacy"},
+}
+
+// Address flags, that can be set when adding an address ("deprecated" is
+// implemented by a preferred lifetime of zero, as the kernel derives it from that)
+var settableAddressFlags = map[string]int{
+	"nodad": unix.IFA_F_NODAD,
+	"noprefixroute": unix.IFA_F_NOPREFIXROUTE,
+	"home": unix.IFA_F_HOMEADDRESS,
+	"deprecated": unix.IFA_F_DEPRECATED,
+}
+
+// Holds the options of an address, that are passed to the kernel when adding it
+type AddressOptions struct {
+	ValidLifetime *int `json:"valid_lifetime,omitempty"`
+	PreferredLifetime *int `json:"preferred_lifetime,omitempty"`
+	Flags []string `json:"flags,omitempty"`
+	Label string `json:"label,omitempty"`
+	Scope string `json:"scope,omitempty"`
+}
+
+// Parses an address scope name ("global", "site", "link" or "host")
+func ParseAddressScope(scope string) (int, error) {
+	for value, name := range addressScopeNames {
+		if name == scope && value != unix.RT_SCOPE_NOWHERE {
+			return value, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid address scope \"%s\" (expected \"global\", \"site\", \"link\" or \"host\")", scope)
+}
+
+// Checks whether no options are set
+func (ao AddressOptions) IsEmpty() bool {
+	return ao.ValidLifetime == nil && ao.PreferredLifetime == nil && len(ao.Flags) == 0 && ao.Label == "" && ao.Scope == ""
+}
+
+// Checks whether the options set a finite valid lifetime, after which the
+// kernel removes the address by itself
+func (ao AddressOptions) HasFiniteLifetime() bool {
+	return ao.ValidLifetime != nil
+}
+
+// Applies the options to a cidr address, that will be added to an interface
+func (ao AddressOptions) Apply(interfaceName string, address CIDRAddress) error {
+	deprecated := false
+	for _, name := range ao.Flags {
+		flag, ok := settableAddressFlags[name]
+		if !ok {
+			return fmt.Errorf("invalid address flag \"%s\" (expected \"nodad\", \"noprefixroute\", \"home\" or \"deprecated\")", name)
+		}
+		if flag == unix.IFA_F_DEPRECATED {
+			deprecated = true
+		} else {
+			address.Flags |= flag
+		}
+	}
+
+	// A lifetime of 0xffffffff means forever
+	validLifetime, preferredLifetime := int(math.MaxUint32), int(math.MaxUint32)
+	if ao.ValidLifetime != nil {
+		if *ao.ValidLifetime <= 0 || int64(*ao.ValidLifetime) >= math.MaxUint32 {
+			return fmt.Errorf("invalid valid lifetime %d (expected 1 to %d seconds)", *ao.ValidLifetime, uint32(math.MaxUint32 - 1))
+		}
+		validLifetime, preferredLifetime = *ao.ValidLifetime, *ao.ValidLifetime
+	}
+	if ao.PreferredLifetime != nil {
+		if *ao.PreferredLifetime < 0 || *ao.PreferredLifetime > validLifetime {
+			return fmt.Errorf("invalid preferred lifetime %d (expected 0 to the valid lifetime)", *ao.PreferredLifetime)
+		}
+		preferredLifetime = *ao.PreferredLifetime
+	}
+	if deprecated {
+		if ao.PreferredLifetime != nil && *ao.PreferredLifetime != 0 {
+			return errors.New("deprecated addresses can't have a preferred lifetime")
+		}
+		preferredLifetime = 0
+	}
+	if ao.ValidLifetime != nil || ao.PreferredLifetime != nil || deprecated {
+		address.ValidLft, address.PreferedLft = validLifetime, preferredLifetime
+	}
+
+	if ao.Label != "" {
+		if address.IP.To4() == nil {
+			return errors.New("labels are only supported for IPv4 addresses")
+		}
+		if !strings.HasPrefix(ao.Label, interfaceName) || len(ao.Label) >= unix.IFNAMSIZ {
+			return fmt.Errorf("invalid label \"%s\" (expected the interface name as prefix and at most %d characters)", ao.Label, unix.IFNAMSIZ - 1)
+		}
+		address.Label = ao.Label
+	}
+
+	if ao.Scope != "" {
+		scope, err := ParseAddressScope(ao.Scope)
+		if err != nil {
+			return err
+		}
+		address.Scope = scope
+	}
+
+	return nil
+}
+
+// Returns the options of a cidr address, that are kept when it's recorded
+// (finite lifetimes are kept as given, although they start over on restoring
+// the address)
+func PersistentAddressOptions(address CIDRAddress) *AddressOptions {
+	options := &AddressOptions{
+		Label: address.Label,
+	}
+
+	finiteLifetime := hasFiniteLifetime(address)
+	if finiteLifetime {
+		validLifetime, preferredLifetime := address.ValidLft, address.PreferedLft
+		options.ValidLifetime, options.PreferredLifetime = &validLifetime, &preferredLifetime
+	}
+
+	for name, flag := range settableAddressFlags {
+		if flag == unix.IFA_F_DEPRECATED {
+			// Only the deprecated flag yields a preferred lifetime of zero without
+			// a finite valid lifetime
+			if !finiteLifetime && address.PreferedLft == 0 && address.ValidLft > 0 {
+				options.Flags = append(options.Flags, name)
+			}
+		} else if address.Flags & flag != 0 {
+			options.Flags = append(options.Flags, name)
+		}
+	}
+	sort.Strings(options.Flags)
+
+	if address.Scope != unix.RT_SCOPE_UNIVERSE {
+		options.Scope = addressScopeNames[address.Scope]
 	}
 
-	return &link, nil
+	if options.IsEmpty() {
+		return nil
+	}
+	return options
+}
+
+// Returns all network links of the server's network namespace
+func ListLinks() ([]NetworkLink, error) {
+	return (*Namespace)(nil).ListLinks()
+}
+
+// Parses an address family name ("ipv4" or "ipv6"), an empty name selects all families
+func ParseAddressFamily(family string) (int, error) {
+	switch family {
+	case "":
+		return netlink.FAMILY_ALL, nil
+	case "ipv4":
+		return netlink.FAMILY_V4, nil
+	case "ipv6":
+		return netlink.FAMILY_V6, nil
+	default:
+		return 0, errors.New("invalid address family (expected \"ipv4\" or \"ipv6\")")
+	}
 }
 
 // Parses an cidr address
@@ -33,28 +287,98 @@ func ParseAddress(address string) (CIDRAddress, error) {
 	return parsedAddress, nil
 }
 
-// Adds an cidr address to a network link
-func AddAddress(link NetworkLink, address CIDRAddress) error {
-	addressExists, err := AddressExists(link, address)
+// Adds an cidr address to a network link and advertises it (the first packet
+// is sent synchronously, the remaining ones of the burst in the background)
+func AddAddress(link NetworkLink, address CIDRAddress, advertisement Advertisement) error {
+	if err := probeNewAddress(link, address, advertisement); err != nil {
+		return err
+	}
+
+	added, err := claimAddress(link, address)
+	if err != nil || !added {
+		return err
+	}
+
+	err = settleAddress(link, address, advertisement)
+	if isDADFailure(err) {
+		removeFailedAddress(link, address)
+	}
+	return err
+}
+
+// Probes whether another host uses an IPv4 address, that isn't present on a
+// network link yet, before it's claimed
+func probeNewAddress(link NetworkLink, address CIDRAddress, advertisement Advertisement) error {
+	if address.IP.To4() == nil || advertisement.ProbeCount <= 0 {
+		return nil
+	}
+
+	existingAddress, err := findAddress(link, address)
+	if err != nil {
+		return err
+	}
+	if existingAddress != nil && existingAddress.Flags & unix.IFA_F_DADFAILED == 0 {
+		return nil
+	}
+
+	hardwareAddr, err := ProbeAddress(link, address, advertisement.ProbeCount, advertisement.ProbeWait())
 	if err != nil {
+		zap.L().Error("Failed to probe address on interface",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.String("address", address.String()),
+			zap.Error(err),
+		)
 		return err
 	}
-	if addressExists {
+	if hardwareAddr != nil {
+		zap.L().Error("Refusing to add address to interface, because another host uses it",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.String("address", address.String()),
+			zap.Stringer("hardware-address", hardwareAddr),
+		)
+		return &DuplicateAddressError{hardwareAddr}
+	}
+
+	return nil
+}
+
+// Adds an cidr address to a network link without waiting for the duplicate
+// address detection and returns, whether it was added (false, if it's
+// already present)
+func claimAddress(link NetworkLink, address CIDRAddress) (bool, error) {
+	existingAddress, err := findAddress(link, address)
+	if err != nil {
+		return false, err
+	}
+	if existingAddress != nil {
 		zap.L().Info("Address already exists on interface",
 			zap.String("interface-name", (*link).Attrs().Name),
 			zap.String("address", address.String()),
 		)
-		return nil
+
+		// An address, that failed duplicate address detection before, is removed
+		// and the detection is repeated
+		if existingAddress.Flags & unix.IFA_F_DADFAILED == 0 {
+			return false, updateAddressOptions(link, existingAddress, address)
+		}
+		if err := link.Namespace.netlinkHandle().AddrDel(link.Link, existingAddress); err != nil {
+			zap.L().Error("Failed to remove address, that failed duplicate address detection, from interface",
+				zap.String("interface-name", (*link).Attrs().Name),
+				zap.String("address", address.String()),
+				zap.Error(err),
+			)
+			return false, &DuplicateAddressError{}
+		}
 	}
 
-	err = netlink.AddrAdd(*link, address)
+	err = link.Namespace.netlinkHandle().AddrAdd(link.Link, address)
 	if err != nil {
 		zap.L().Error("Failed to add address to interface",
 			zap.String("interface-name", (*link).Attrs().Name),
 			zap.String("address", address.String()),
 			zap.Error(err),
 		)
-		return err
+		return false, err
 	}
 
 	zap.L().Info("Added address to interface",
@@ -62,14 +386,98 @@ func AddAddress(link NetworkLink, address CIDRAddress) error {
 		zap.String("address", address.String()),
 	)
 
-	err = AdvertiseAddress(link, address)
+	return true, nil
+}
+
+// Checks whether options were applied to a cidr address
+func hasAddressOptions(address CIDRAddress) bool {
+	return address.Flags != 0 || address.ValidLft != 0 || address.PreferedLft != 0 || address.Label != "" || address.Scope != unix.RT_SCOPE_UNIVERSE
+}
+
+// Applies the flags and lifetimes of a cidr address to the same address, that
+// is already present on a network link (the label, the scope and the flags of
+// IPv4 addresses can't be changed in place)
+func updateAddressOptions(link NetworkLink, existingAddress CIDRAddress, address CIDRAddress) error {
+	if !hasAddressOptions(address) {
+		return nil
+	}
+
+	if address.Label != "" && address.Label != existingAddress.Label {
+		return &AddressOptionConflictError{"label"}
+	}
+	if address.Scope != unix.RT_SCOPE_UNIVERSE && address.Scope != existingAddress.Scope {
+		return &AddressOptionConflictError{"scope"}
+	}
+
+	// The kernel only replaces the lifetimes of IPv4 addresses
+	if address.IP.To4() != nil && address.Flags != existingAddress.Flags & (unix.IFA_F_NODAD | unix.IFA_F_NOPREFIXROUTE | unix.IFA_F_HOMEADDRESS) {
+		return &AddressOptionConflictError{"flags"}
+	}
+
+	if err := link.Namespace.netlinkHandle().AddrReplace(link.Link, address); err != nil {
+		zap.L().Error("Failed to update options of address on interface",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.String("address", address.String()),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	zap.L().Info("Updated options of address on interface",
+		zap.String("interface-name", (*link).Attrs().Name),
+		zap.String("address", address.String()),
+	)
+
+	return nil
+}
+
+// Waits for the duplicate address detection of a newly added cidr address and
+// advertises it (only usable addresses are advertised)
+func settleAddress(link NetworkLink, address CIDRAddress, advertisement Advertisement) error {
+	if address.IP.To4() == nil && advertisement.DADTimeout.Duration > 0 && address.Flags & unix.IFA_F_NODAD == 0 {
+		if err := waitForDAD(link, address, advertisement.DADTimeout.Duration); err != nil {
+			zap.L().Error("Duplicate address detection failed for address on interface",
+				zap.String("interface-name", (*link).Attrs().Name),
+				zap.String("address", address.String()),
+				zap.Error(err),
+			)
+			return err
+		}
+	}
+
+	return AnnounceAddress(link, address, advertisement)
+}
+
+// Checks whether an error reports a duplicate or still tentative address
+func isDADFailure(err error) bool {
+	var duplicateAddressError *DuplicateAddressError
+	var dadTimeoutError *DADTimeoutError
+	return errors.As(err, &duplicateAddressError) || errors.As(err, &dadTimeoutError)
+}
+
+// Removes a cidr address, that failed duplicate address detection, from a
+// network link, as it isn't usable
+func removeFailedAddress(link NetworkLink, address CIDRAddress) {
+	if err := link.Namespace.netlinkHandle().AddrDel(link.Link, address); err != nil {
+		zap.L().Error("Failed to remove address from interface after duplicate address detection",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.String("address", address.String()),
+			zap.Error(err),
+		)
+	}
+}
+
+// Advertises an cidr address on a network link (the first packet is sent
+// synchronously, the remaining ones of the burst in the background)
+func AnnounceAddress(link NetworkLink, address CIDRAddress, advertisement Advertisement) error {
+	err := AdvertiseAddress(link, address, advertisement)
 	if err != nil {
 		zap.L().Error("Failed to advertise address to interface",
 			zap.String("interface-name", (*link).Attrs().Name),
 			zap.String("address", address.String()),
 			zap.Error(err),
 		)
-		return err
+		return &AdvertiseError{err}
 	}
 
 	zap.L().Info("Advertised address on interface",
@@ -77,12 +485,91 @@ func AddAddress(link NetworkLink, address CIDRAddress) error {
 		zap.String("address", address.String()),
 	)
 
+	if advertisement.PacketCount() > 1 {
+		go repeatAdvertisement(link, address, advertisement)
+	}
+
 	return nil
 }
 
+// Returns a cidr address present on a network link with its current flags (or
+// nil, if it's not present)
+func findAddress(link NetworkLink, address CIDRAddress) (CIDRAddress, error) {
+	existingAddresses, err := ListAddresses(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, existingAddress := range existingAddresses {
+		if existingAddress.Equal(*address) {
+			return existingAddress, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Waits until an IPv6 address on a network link leaves the tentative state
+// of the duplicate address detection
+func waitForDAD(link NetworkLink, address CIDRAddress, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		existingAddress, err := findAddress(link, address)
+		if err != nil {
+			return err
+		}
+		if existingAddress == nil {
+			return fmt.Errorf("address vanished during duplicate address detection")
+		}
+
+		if existingAddress.Flags & unix.IFA_F_DADFAILED != 0 {
+			return &DuplicateAddressError{}
+		}
+		if existingAddress.Flags & unix.IFA_F_TENTATIVE == 0 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return &DADTimeoutError{timeout}
+		}
+		time.Sleep(dadPollInterval)
+	}
+}
+
+// Sends the remaining packets of the burst of an advertisement
+func repeatAdvertisement(link NetworkLink, address CIDRAddress, advertisement Advertisement) {
+	for i := 1; i < advertisement.PacketCount(); i++ {
+		time.Sleep(advertisement.PacketInterval())
+
+		if err := AdvertiseAddress(link, address, advertisement); err != nil {
+			zap.L().Error("Failed to repeat advertisement of address on interface",
+				zap.String("interface-name", (*link).Attrs().Name),
+				zap.String("address", address.String()),
+				zap.Int("packet", i + 1),
+				zap.Error(err),
+			)
+			return
+		}
+	}
+
+	zap.L().Debug("Finished advertisement of address on interface",
+		zap.String("interface-name", (*link).Attrs().Name),
+		zap.String("address", address.String()),
+		zap.Int("packets", advertisement.PacketCount()),
+	)
+}
+
+// Returns the solicited-node multicast address of an IPv6 address
+func solicitedNodeAddress(ip net.IP) net.IP {
+	solicitedNodeIP := net.ParseIP("ff02::1:ff00:0")
+	copy(solicitedNodeIP[13:], ip.To16()[13:])
+	return solicitedNodeIP
+}
 
-// Advertises an cidr address on a network link
-func AdvertiseAddress(link NetworkLink, address CIDRAddress) error {
+// Builds the packet for advertising an cidr address on a network link and
+// returns it together with its ethernet protocol
+func buildAdvertisementPacket(link NetworkLink, address CIDRAddress, advertisement Advertisement) (uint16, []byte, error) {
 	var proto uint16
 	buffer := gopacket.NewSerializeBuffer()
 	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
@@ -96,12 +583,17 @@ func AdvertiseAddress(link NetworkLink, address CIDRAddress) error {
 			EthernetType: layers.EthernetTypeARP,
 		}
 
+		operation := uint16(layers.ARPRequest)
+		if advertisement.ARPOperation == ARPOperationReply {
+			operation = layers.ARPReply
+		}
+
 		arpLayer := &layers.ARP{
 			AddrType:          layers.LinkTypeEthernet,
 			Protocol:          layers.EthernetTypeIPv4,
 			HwAddressSize:     6,
 			ProtAddressSize:   4,
-			Operation:         layers.ARPRequest,
+			Operation:         operation,
 			SourceHwAddress:   (*link).Attrs().HardwareAddr,
 			SourceProtAddress: address.IP.To4(),
 			DstHwAddress:      net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
@@ -112,21 +604,28 @@ func AdvertiseAddress(link NetworkLink, address CIDRAddress) error {
 			ethLayer,
 			arpLayer,
 		); err != nil {
-			return err
+			return 0, nil, err
 		}
 	} else {  // It's an IPv6 address
 		proto = unix.ETH_P_IPV6
 
+		dstIP := net.IPv6linklocalallnodes
+		dstMAC := net.HardwareAddr{0x33, 0x33, 0x00, 0x00, 0x00, 0x01}
+		if advertisement.SolicitedNode {
+			dstIP = solicitedNodeAddress(address.IP)
+			dstMAC = net.HardwareAddr{0x33, 0x33, dstIP[12], dstIP[13], dstIP[14], dstIP[15]}
+		}
+
 		ethLayer := &layers.Ethernet{
 			SrcMAC:       (*link).Attrs().HardwareAddr,
-			DstMAC:       net.HardwareAddr{0x33, 0x33, 0x00, 0x00, 0x00, 0x01},
+			DstMAC:       dstMAC,
 			EthernetType: layers.EthernetTypeIPv6,
 		}
 
 		ipv6Layer := &layers.IPv6{
 			Version:    6,
 			SrcIP:      address.IP,
-			DstIP:      net.IPv6linklocalallnodes,
+			DstIP:      dstIP,
 			NextHeader: layers.IPProtocolICMPv6,
 			HopLimit:   255,
 		}
@@ -136,8 +635,13 @@ func AdvertiseAddress(link NetworkLink, address CIDRAddress) error {
 		}
 		icmpv6Layer.SetNetworkLayerForChecksum(ipv6Layer)
 
+		var flags uint8
+		if advertisement.IsOverride() {
+			flags |= 0x20
+		}
+
 		icmpv6NALayer := &layers.ICMPv6NeighborAdvertisement{
-			Flags:         0x20,
+			Flags:         flags,
 			TargetAddress: address.IP,
 			Options: []layers.ICMPv6Option{
 				layers.ICMPv6Option{
@@ -153,11 +657,106 @@ func AdvertiseAddress(link NetworkLink, address CIDRAddress) error {
 			icmpv6Layer,
 			icmpv6NALayer,
 		); err != nil {
-			return err
+			return 0, nil, err
+		}
+	}
+
+	return proto, buffer.Bytes(), nil
+}
+
+// Converts a value from host to network byte order
+func htons(v uint16) uint16 {
+	return v << 8 | v >> 8
+}
+
+// Sends RFC 5227 ARP probes for an IPv4 address on a network link and returns
+// the hardware address of a host, that uses or probes for the address as well
+// (or nil, if no host answered until one interval after the last probe)
+func ProbeAddress(link NetworkLink, address CIDRAddress, count int, interval time.Duration) (net.HardwareAddr, error) {
+	ownHardwareAddr := (*link).Attrs().HardwareAddr
+
+	buffer := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true},
+		&layers.Ethernet{
+			SrcMAC:       ownHardwareAddr,
+			DstMAC:       net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+			EthernetType: layers.EthernetTypeARP,
+		},
+		&layers.ARP{
+			AddrType:          layers.LinkTypeEthernet,
+			Protocol:          layers.EthernetTypeIPv4,
+			HwAddressSize:     6,
+			ProtAddressSize:   4,
+			Operation:         layers.ARPRequest,
+			SourceHwAddress:   ownHardwareAddr,
+			SourceProtAddress: net.IPv4zero.To4(),
+			DstHwAddress:      net.HardwareAddr{0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			DstProtAddress:    address.IP.To4(),
+		},
+	); err != nil {
+		return nil, err
+	}
+
+	fd, err := link.Namespace.socket(unix.AF_PACKET, unix.SOCK_RAW, int(htons(unix.ETH_P_ARP)))
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(fd)
+
+	sll := &unix.SockaddrLinklayer{
+		Ifindex:  (*link).Attrs().Index,
+		Protocol: htons(unix.ETH_P_ARP),
+	}
+
+	if err := unix.Bind(fd, sll); err != nil {
+		return nil, err
+	}
+
+	receiveTimeout := unix.NsecToTimeval(probeReceiveTimeout.Nanoseconds())
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &receiveTimeout); err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, 1500)
+	for i := 0; i < count; i++ {
+		if err := unix.Sendto(fd, buffer.Bytes(), 0, sll); err != nil {
+			return nil, err
+		}
+
+		deadline := time.Now().Add(interval)
+		for time.Now().Before(deadline) {
+			n, _, err := unix.Recvfrom(fd, frame, 0)
+			if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+
+			packet := gopacket.NewPacket(frame[:n], layers.LayerTypeEthernet, gopacket.NoCopy)
+			arpLayer, ok := packet.Layer(layers.LayerTypeARP).(*layers.ARP)
+			if !ok || bytes.Equal(arpLayer.SourceHwAddress, ownHardwareAddr) {
+				continue
+			}
+
+			// Another host uses the address or probes for it at the same time
+			if net.IP(arpLayer.SourceProtAddress).Equal(address.IP) ||
+				arpLayer.Operation == layers.ARPRequest && net.IP(arpLayer.SourceProtAddress).Equal(net.IPv4zero) && net.IP(arpLayer.DstProtAddress).Equal(address.IP) {
+				return net.HardwareAddr(append([]byte{}, arpLayer.SourceHwAddress...)), nil
+			}
 		}
 	}
 
-	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(proto))
+	return nil, nil
+}
+
+// Advertises an cidr address on a network link by sending a single packet
+func AdvertiseAddress(link NetworkLink, address CIDRAddress, advertisement Advertisement) error {
+	proto, packet, err := buildAdvertisementPacket(link, address, advertisement)
+	if err != nil {
+		return err
+	}
+
+	fd, err := link.Namespace.socket(unix.AF_PACKET, unix.SOCK_RAW, int(proto))
 	if err != nil {
 		return err
 	}
@@ -172,7 +771,7 @@ func AdvertiseAddress(link NetworkLink, address CIDRAddress) error {
 		return err
 	}
 
-	if err := unix.Sendto(fd, buffer.Bytes(), 0, sll); err != nil {
+	if err := unix.Sendto(fd, packet, 0, sll); err != nil {
 		return err
 	}
 
@@ -181,7 +780,7 @@ func AdvertiseAddress(link NetworkLink, address CIDRAddress) error {
 
 // Checks whether a cidr address is already present on a network link
 func AddressExists(link NetworkLink, address CIDRAddress) (bool, error) {
-	existingAddresses, err := netlink.AddrList(*link, netlink.FAMILY_ALL)
+	existingAddresses, err := link.Namespace.netlinkHandle().AddrList(link.Link, netlink.FAMILY_ALL)
 	if err != nil {
 		zap.L().Error("Error while retreiving existing addresses on interface",
 			zap.String("interface-name", (*link).Attrs().Name),
@@ -210,6 +809,70 @@ func AddressExists(link NetworkLink, address CIDRAddress) (bool, error) {
 	return false, nil
 }
 
+// Returns the cidr addresses present on a network link
+func ListAddresses(link NetworkLink, family int) ([]CIDRAddress, error) {
+	existingAddresses, err := link.Namespace.netlinkHandle().AddrList(link.Link, family)
+	if err != nil {
+		zap.L().Error("Error while retreiving existing addresses on interface",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	addresses := make([]CIDRAddress, len(existingAddresses))
+	for i := range existingAddresses {
+		addresses[i] = &existingAddresses[i]
+	}
+
+	return addresses, nil
+}
+
+// Describes a cidr address present on a network link
+func DescribeAddress(link NetworkLink, address CIDRAddress) AddressInfo {
+	prefixLength, _ := address.Mask.Size()
+
+	info := AddressInfo{
+		InterfaceName: (*link).Attrs().Name,
+		Address: address.IPNet.String(),
+		PrefixLength: prefixLength,
+		Family: "ipv6",
+		Scope: addressScopeNames[address.Scope],
+		Flags: []string{},
+	}
+
+	if address.IP.To4() != nil {
+		info.Family = "ipv4"
+		if address.Flags & unix.IFA_F_SECONDARY != 0 {
+			info.Flags = append(info.Flags, "secondary")
+		}
+	} else if address.Flags & unix.IFA_F_TEMPORARY != 0 {
+		info.Flags = append(info.Flags, "temporary")
+	}
+
+	for _, f := range addressFlagNames {
+		if address.Flags & f.flag != 0 {
+			info.Flags = append(info.Flags, f.name)
+		}
+	}
+
+	if info.Scope == "" {
+		info.Scope = fmt.Sprintf("%d", address.Scope)
+	}
+
+	// A lifetime of 0xffffffff means forever, which is represented as null
+	if uint32(address.ValidLft) != math.MaxUint32 {
+		validLifetime := address.ValidLft
+		info.ValidLifetime = &validLifetime
+	}
+	if uint32(address.PreferedLft) != math.MaxUint32 {
+		preferredLifetime := address.PreferedLft
+		info.PreferredLifetime = &preferredLifetime
+	}
+
+	return info
+}
+
 // Removes a cidr address from a network link
 func DeleteAddress(link NetworkLink, address CIDRAddress) error {
 	addressExists, err := AddressExists(link, address)
@@ -224,7 +887,7 @@ func DeleteAddress(link NetworkLink, address CIDRAddress) error {
 		return nil
 	}
 
-	err = netlink.AddrDel(*link, address)
+	err = link.Namespace.netlinkHandle().AddrDel(link.Link, address)
 	if err != nil {
 		zap.L().Error("Failed to delete address from interface",
 			zap.String("interface-name", (*link).Attrs().Name),
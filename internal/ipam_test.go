@@ -1,9 +1,17 @@
 package internal
 
 import (
+	"math"
+	"net"
 	"os"
+	"regexp"
 	"testing"
+	"time"
 
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 	"gotest.tools/assert"
 )
 
@@ -67,7 +75,7 @@ func TestAddAndDeleteAddress(t *testing.T) {
 	assert.NilError(t, err)
 	assert.Equal(t, addressExists, false)
 
-	err = AddAddress(link, address)
+	err = AddAddress(link, address, Advertisement{})
 	assert.NilError(t, err)
 
 	addressExists, err = AddressExists(link, address)
@@ -81,3 +89,350 @@ func TestAddAndDeleteAddress(t *testing.T) {
 	assert.NilError(t, err)
 	assert.Equal(t, addressExists, false)
 }
+
+func TestListAddresses(t *testing.T) {
+	link, err := LinkByName("lo")
+	assert.NilError(t, err)
+
+	family, err := ParseAddressFamily("ipv4")
+	assert.NilError(t, err)
+
+	addresses, err := ListAddresses(link, family)
+	assert.NilError(t, err)
+
+	found := false
+	for _, address := range addresses {
+		info := DescribeAddress(link, address)
+		assert.Equal(t, info.Family, "ipv4")
+		if info.Address == "127.0.0.1/8" {
+			found = true
+			assert.Equal(t, info.InterfaceName, "lo")
+			assert.Equal(t, info.PrefixLength, 8)
+			assert.Equal(t, info.Scope, "host")
+		}
+	}
+	assert.Assert(t, found)
+}
+
+func TestInvalidAddressFamily(t *testing.T) {
+	_, err := ParseAddressFamily("ipx")
+	assert.Error(t, err, "invalid address family (expected \"ipv4\" or \"ipv6\")")
+}
+
+func TestAddressOptions(t *testing.T) {
+	address, err := ParseAddress("192.0.2.1/24")
+	assert.NilError(t, err)
+
+	validLifetime, preferredLifetime := 300, 120
+	options := AddressOptions{
+		ValidLifetime: &validLifetime,
+		PreferredLifetime: &preferredLifetime,
+		Flags: []string{"noprefixroute", "nodad"},
+		Label: "eth0:vip",
+		Scope: "link",
+	}
+	assert.NilError(t, options.Apply("eth0", address))
+	assert.Equal(t, address.ValidLft, 300)
+	assert.Equal(t, address.PreferedLft, 120)
+	assert.Equal(t, address.Label, "eth0:vip")
+	assert.Equal(t, address.Flags, unix.IFA_F_NODAD | unix.IFA_F_NOPREFIXROUTE)
+	assert.Equal(t, address.Scope, unix.RT_SCOPE_LINK)
+
+	// Lifetimes are not kept
+	assert.DeepEqual(t, PersistentAddressOptions(address), &AddressOptions{
+		ValidLifetime: &validLifetime,
+		PreferredLifetime: &preferredLifetime,
+		Flags: []string{"nodad", "noprefixroute"},
+		Label: "eth0:vip",
+		Scope: "link",
+	})
+
+	address, err = ParseAddress("192.0.2.1/24")
+	assert.NilError(t, err)
+	assert.NilError(t, AddressOptions{Flags: []string{"deprecated"}}.Apply("eth0", address))
+	assert.Equal(t, address.PreferedLft, 0)
+	assert.Equal(t, address.ValidLft, int(math.MaxUint32))
+	assert.DeepEqual(t, PersistentAddressOptions(address), &AddressOptions{Flags: []string{"deprecated"}})
+
+	// A preferred lifetime of zero with a finite valid lifetime isn't turned into the flag
+	validLifetime, zero := 60, 0
+	address, err = ParseAddress("192.0.2.1/24")
+	assert.NilError(t, err)
+	assert.NilError(t, AddressOptions{ValidLifetime: &validLifetime, PreferredLifetime: &zero}.Apply("eth0", address))
+	assert.DeepEqual(t, PersistentAddressOptions(address), &AddressOptions{ValidLifetime: &validLifetime, PreferredLifetime: &zero})
+
+	address, err = ParseAddress("192.0.2.1/24")
+	assert.NilError(t, err)
+	assert.Assert(t, PersistentAddressOptions(address) == nil)
+}
+
+func TestInvalidAddressOptions(t *testing.T) {
+	address, err := ParseAddress("fd69:decd:7b66:8220::1/64")
+	assert.NilError(t, err)
+
+	zero, validLifetime, preferredLifetime := 0, 60, 120
+
+	assert.ErrorContains(t, AddressOptions{Flags: []string{"permanent"}}.Apply("eth0", address), "invalid address flag \"permanent\"")
+	assert.ErrorContains(t, AddressOptions{ValidLifetime: &zero}.Apply("eth0", address), "invalid valid lifetime 0")
+	assert.ErrorContains(t, AddressOptions{ValidLifetime: &validLifetime, PreferredLifetime: &preferredLifetime}.Apply("eth0", address), "invalid preferred lifetime 120")
+	assert.ErrorContains(t, AddressOptions{Label: "eth0:vip"}.Apply("eth0", address), "labels are only supported for IPv4 addresses")
+	assert.ErrorContains(t, AddressOptions{Scope: "nowhere"}.Apply("eth0", address), "invalid address scope \"nowhere\"")
+
+	address, err = ParseAddress("192.0.2.1/24")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, AddressOptions{Label: "eth1:vip"}.Apply("eth0", address), "invalid label \"eth1:vip\"")
+}
+
+func TestAddAddressWithOptions(t *testing.T) {
+	assert.Assert(t, os.Getenv("NET_LINK") != "")
+
+	link, err := LinkByName(os.Getenv("NET_LINK"))
+	assert.NilError(t, err)
+
+	address, err := ParseAddress("fd69:decd:7b66:8220::10/64")
+	assert.NilError(t, err)
+
+	validLifetime := 300
+	options := AddressOptions{ValidLifetime: &validLifetime, Flags: []string{"nodad", "noprefixroute"}}
+	assert.NilError(t, options.Apply(os.Getenv("NET_LINK"), address))
+	assert.NilError(t, AddAddress(link, address, Advertisement{}))
+
+	addresses, err := ListAddresses(link, netlink.FAMILY_V6)
+	assert.NilError(t, err)
+
+	found := false
+	for _, a := range addresses {
+		if a.Equal(*address) {
+			info := DescribeAddress(link, a)
+			assert.Assert(t, containsString(info.Flags, "nodad"))
+			assert.Assert(t, containsString(info.Flags, "noprefixroute"))
+			assert.Assert(t, info.ValidLifetime != nil && *info.ValidLifetime <= 300)
+			found = true
+		}
+	}
+	assert.Assert(t, found)
+
+	assert.NilError(t, DeleteAddress(link, address))
+}
+
+func TestAdvertisementPackets(t *testing.T) {
+	assert.Assert(t, os.Getenv("NET_LINK") != "")
+
+	link, err := LinkByName(os.Getenv("NET_LINK"))
+	assert.NilError(t, err)
+
+	address, err := ParseAddress("192.0.2.1/24")
+	assert.NilError(t, err)
+
+	proto, data, err := buildAdvertisementPacket(link, address, Advertisement{ARPOperation: ARPOperationReply})
+	assert.NilError(t, err)
+	assert.Equal(t, proto, uint16(unix.ETH_P_ARP))
+
+	packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+	arpLayer := packet.Layer(layers.LayerTypeARP).(*layers.ARP)
+	assert.Equal(t, arpLayer.Operation, uint16(layers.ARPReply))
+	assert.DeepEqual(t, net.IP(arpLayer.DstProtAddress), address.IP.To4())
+
+	address, err = ParseAddress("fd69:decd:7b66:8220::1:2345/64")
+	assert.NilError(t, err)
+
+	override := false
+	proto, data, err = buildAdvertisementPacket(link, address, Advertisement{Override: &override, SolicitedNode: true})
+	assert.NilError(t, err)
+	assert.Equal(t, proto, uint16(unix.ETH_P_IPV6))
+
+	packet = gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+	ethLayer := packet.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	assert.Equal(t, ethLayer.DstMAC.String(), "33:33:ff:01:23:45")
+	ipv6Layer := packet.Layer(layers.LayerTypeIPv6).(*layers.IPv6)
+	assert.Equal(t, ipv6Layer.DstIP.String(), "ff02::1:ff01:2345")
+	naLayer := packet.Layer(layers.LayerTypeICMPv6NeighborAdvertisement).(*layers.ICMPv6NeighborAdvertisement)
+	assert.Assert(t, !naLayer.Override())
+
+	// Defaults to the all-nodes address with the override flag set
+	_, data, err = buildAdvertisementPacket(link, address, Advertisement{})
+	assert.NilError(t, err)
+
+	packet = gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+	ipv6Layer = packet.Layer(layers.LayerTypeIPv6).(*layers.IPv6)
+	assert.Equal(t, ipv6Layer.DstIP.String(), "ff02::1")
+	naLayer = packet.Layer(layers.LayerTypeICMPv6NeighborAdvertisement).(*layers.ICMPv6NeighborAdvertisement)
+	assert.Assert(t, naLayer.Override())
+}
+
+func TestAddAddressWithDuplicateAddressDetection(t *testing.T) {
+	veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "ipam-dad0"}, PeerName: "ipam-dad1"}
+	assert.NilError(t, netlink.LinkAdd(veth))
+	defer netlink.LinkDel(veth)
+
+	for _, name := range []string{"ipam-dad0", "ipam-dad1"} {
+		link, err := netlink.LinkByName(name)
+		assert.NilError(t, err)
+		assert.NilError(t, netlink.LinkSetUp(link))
+	}
+
+	link, err := LinkByName("ipam-dad0")
+	assert.NilError(t, err)
+	peerLink, err := LinkByName("ipam-dad1")
+	assert.NilError(t, err)
+
+	// Wait for the carrier, otherwise the duplicate address detection is postponed
+	for i := 0; i < 50 && !isNetworkLinkUp(link); i++ {
+		time.Sleep(100 * time.Millisecond)
+		link, err = LinkByName("ipam-dad0")
+		assert.NilError(t, err)
+	}
+
+	// The peer already uses the address
+	address, err := ParseAddress("fd69:decd:7b66:8220::20/64")
+	assert.NilError(t, err)
+	address.Flags = unix.IFA_F_NODAD
+	assert.NilError(t, netlink.AddrAdd(*peerLink, address))
+
+	advertisement := Advertisement{DADTimeout: Duration{5 * time.Second}}
+
+	address, err = ParseAddress("fd69:decd:7b66:8220::20/64")
+	assert.NilError(t, err)
+	err = AddAddress(link, address, advertisement)
+	assert.ErrorType(t, err, &DuplicateAddressError{})
+
+	// The duplicate address doesn't stay on the interface
+	addressExists, err := AddressExists(link, address)
+	assert.NilError(t, err)
+	assert.Assert(t, !addressExists)
+
+	// Adding it again reports the conflict as well
+	err = AddAddress(link, address, advertisement)
+	assert.ErrorType(t, err, &DuplicateAddressError{})
+
+	addressExists, err = AddressExists(link, address)
+	assert.NilError(t, err)
+	assert.Assert(t, !addressExists)
+
+	address, err = ParseAddress("fd69:decd:7b66:8220::21/64")
+	assert.NilError(t, err)
+	assert.NilError(t, AddAddress(link, address, advertisement))
+
+	addresses, err := ListAddresses(link, netlink.FAMILY_V6)
+	assert.NilError(t, err)
+	for _, a := range addresses {
+		if a.Equal(*address) {
+			assert.Assert(t, a.Flags & unix.IFA_F_TENTATIVE == 0)
+		}
+	}
+
+	address, err = ParseAddress("fd69:decd:7b66:8220::22/64")
+	assert.NilError(t, err)
+	err = AddAddress(link, address, Advertisement{DADTimeout: Duration{time.Millisecond}})
+	assert.ErrorType(t, err, &DADTimeoutError{})
+
+	addressExists, err = AddressExists(link, address)
+	assert.NilError(t, err)
+	assert.Assert(t, !addressExists)
+
+	// An address, that failed duplicate address detection before, is detected again
+	address, err = ParseAddress("fd69:decd:7b66:8220::20/64")
+	assert.NilError(t, err)
+	assert.NilError(t, netlink.AddrAdd(*link, address))
+	for i := 0; i < 50; i++ {
+		existingAddress, err := findAddress(link, address)
+		assert.NilError(t, err)
+		if existingAddress.Flags & unix.IFA_F_DADFAILED != 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.NilError(t, netlink.AddrDel(*peerLink, address))
+
+	assert.NilError(t, AddAddress(link, address, advertisement))
+	existingAddress, err := findAddress(link, address)
+	assert.NilError(t, err)
+	assert.Assert(t, existingAddress.Flags & (unix.IFA_F_DADFAILED | unix.IFA_F_TENTATIVE) == 0)
+}
+
+func TestAddAddressReleasesMutexDuringDAD(t *testing.T) {
+	veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "ipam-dadmx0"}, PeerName: "ipam-dadmx1"}
+	assert.NilError(t, netlink.LinkAdd(veth))
+	defer netlink.LinkDel(veth)
+
+	for _, name := range []string{"ipam-dadmx0", "ipam-dadmx1"} {
+		link, err := netlink.LinkByName(name)
+		assert.NilError(t, err)
+		assert.NilError(t, netlink.LinkSetUp(link))
+	}
+
+	link, err := LinkByName("ipam-dadmx0")
+	assert.NilError(t, err)
+	for i := 0; i < 50 && !isNetworkLinkUp(link); i++ {
+		time.Sleep(100 * time.Millisecond)
+		link, err = LinkByName("ipam-dadmx0")
+		assert.NilError(t, err)
+	}
+
+	_, policyIPNetwork, err := net.ParseCIDR("fd69:decd:7b66:8220::/64")
+	assert.NilError(t, err)
+
+	server := &Server{
+		AddressPolicies: []AddressPolicy{
+			{
+				IPNetwork: IPNetwork{*policyIPNetwork},
+				InterfaceNameRegex: Regexp{*regexp.MustCompile("^ipam-dadmx")},
+				Advertisement: Advertisement{DADTimeout: Duration{5 * time.Second}},
+			},
+		},
+	}
+
+	address, err := ParseAddress("fd69:decd:7b66:8220::30/64")
+	assert.NilError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- server.addAddress(link, address, server.AddressPolicies, nil, "")
+	}()
+
+	// Other requests aren't blocked, while the address is tentative
+	time.Sleep(300 * time.Millisecond)
+	existingAddress, err := findAddress(link, address)
+	assert.NilError(t, err)
+	assert.Assert(t, existingAddress != nil && existingAddress.Flags & unix.IFA_F_TENTATIVE != 0)
+	assert.Assert(t, server.mutex.TryLock())
+	server.mutex.Unlock()
+
+	assert.NilError(t, <-done)
+}
+
+func TestAddAddressWithARPProbe(t *testing.T) {
+	veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "ipam-probe0"}, PeerName: "ipam-probe1"}
+	assert.NilError(t, netlink.LinkAdd(veth))
+	defer netlink.LinkDel(veth)
+
+	for _, name := range []string{"ipam-probe0", "ipam-probe1"} {
+		link, err := netlink.LinkByName(name)
+		assert.NilError(t, err)
+		assert.NilError(t, netlink.LinkSetUp(link))
+	}
+
+	link, err := LinkByName("ipam-probe0")
+	assert.NilError(t, err)
+	peerLink, err := LinkByName("ipam-probe1")
+	assert.NilError(t, err)
+
+	// The peer already uses the address
+	address, err := ParseAddress("198.51.100.50/24")
+	assert.NilError(t, err)
+	assert.NilError(t, netlink.AddrAdd(*peerLink, address))
+
+	advertisement := Advertisement{ProbeCount: 2, ProbeInterval: Duration{200 * time.Millisecond}}
+
+	address, err = ParseAddress("198.51.100.50/24")
+	assert.NilError(t, err)
+	err = AddAddress(link, address, advertisement)
+	assert.ErrorType(t, err, &DuplicateAddressError{})
+	assert.Equal(t, err.(*DuplicateAddressError).HardwareAddr.String(), (*peerLink).Attrs().HardwareAddr.String())
+	assertAddressExists(t, link, "198.51.100.50/24", false)
+
+	address, err = ParseAddress("198.51.100.51/24")
+	assert.NilError(t, err)
+	assert.NilError(t, AddAddress(link, address, advertisement))
+	assertAddressExists(t, link, "198.51.100.51/24", true)
+}
@@ -0,0 +1,268 @@
+package internal
+
+import (
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Interval in which expired leases are reaped
+const leaseReapInterval = time.Second
+
+// Holds the lease of an address
+type Lease struct {
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Returns the expiry of a lease with a duration in seconds (nil, if the
+// duration is zero) or writes an error response, if it's invalid
+func (s *Server) leaseExpiry(w http.ResponseWriter, r *http.Request, requestAction string, leaseDuration int, options AddressOptions, response Response) (*time.Time, bool) {
+	if leaseDuration < 0 {
+		zap.L().Error("Validation of request body failed: Lease duration is negative",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+			zap.Int("lease-duration", leaseDuration),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Lease duration (\"lease_duration\") must not be negative", nil, response)
+		return nil, false
+	}
+
+	if leaseDuration == 0 {
+		return nil, true
+	}
+
+	if options.HasFiniteLifetime() {
+		zap.L().Error("Validation of request body failed: Lease duration and valid lifetime are both set",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Lease duration (\"lease_duration\") can't be combined with a valid lifetime (\"valid_lifetime\")", nil, response)
+		return nil, false
+	}
+
+	// Leases are reaped through the store, which only holds the server's namespace
+	if response.Netns != "" {
+		zap.L().Error("Rejected lease, because it targets another network namespace",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+			zap.String("netns", response.Netns),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Leases are only supported in the network namespace of the server", nil, response)
+		return nil, false
+	}
+
+	// Leases must survive restarts, otherwise the addresses would never expire
+	if s.Store == nil {
+		zap.L().Error("Rejected lease, because no state directory is configured",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Leases require a state directory to be configured", nil, response)
+		return nil, false
+	}
+
+	expiresAt := time.Now().UTC().Add(time.Duration(leaseDuration) * time.Second)
+	return &expiresAt, true
+}
+
+// Handles an authenticated request for renewing the lease of an address
+func (s *Server) handleRenewRequest(w http.ResponseWriter, r *http.Request, policy []AddressPolicy) {
+	if !checkRequestMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var rd RequestData
+	if !decodeRequestBody(w, r, "renew", &rd) {
+		return
+	}
+
+	if rd.Address == "" {
+		zap.L().Error("Validation of request body failed: Address is missing in request",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "renew"),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Address (\"address\") is missing in request", nil, Response{})
+		return
+	}
+
+	if rd.InterfaceName == "" {
+		zap.L().Error("Validation of request body failed: Interface name is missing in request",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "renew"),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Interface name (\"interface_name\") is missing in request", nil, Response{})
+		return
+	}
+
+	address, err := ParseAddress(rd.Address)
+	if err != nil {
+		zap.L().Error("Failed to parse cidr address",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "renew"),
+			zap.String("address", rd.Address),
+			zap.Error(err),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeAddressParseError, "Failed to parse cidr address", err, Response{
+			InterfaceName: rd.InterfaceName,
+		})
+		return
+	}
+
+	response := Response{
+		Address: address.IPNet.String(),
+		InterfaceName: rd.InterfaceName,
+	}
+
+	if decision := checkAddressPolicies(r, "renew", policiesBeforeLink(policy), rd.InterfaceName, address); !decision.Allowed {
+		writeError(w, r, http.StatusForbidden, ErrorCodePolicyDenied, "Rejected cidr address for interface, because " + decision.Reason(), nil, response)
+		return
+	}
+
+	link, err := LinkByName(rd.InterfaceName)
+	if err != nil {
+		zap.L().Error("Failed to retreive interface",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "renew"),
+			zap.String("interface-name", rd.InterfaceName),
+			zap.Error(err),
+		)
+		writeError(w, r, linkErrorStatus(err), linkErrorCode(err), "Failed to retreive interface", err, response)
+		return
+	}
+
+	response.InterfaceIndex = (*link).Attrs().Index
+
+	if _, ok := checkLinkPolicies(w, r, "renew", policy, link, address, response); !ok {
+		return
+	}
+
+	if rd.LeaseDuration == 0 {
+		zap.L().Error("Validation of request body failed: Lease duration is missing in request",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "renew"),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Lease duration (\"lease_duration\") is missing in request", nil, response)
+		return
+	}
+
+	expiresAt, ok := s.leaseExpiry(w, r, "renew", rd.LeaseDuration, AddressOptions{}, response)
+	if !ok {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record, recorded := s.Store.Record(rd.InterfaceName, address)
+	if !recorded || record.ExpiresAt == nil || record.Expired(time.Now()) {
+		zap.L().Error("Failed to renew lease, because the address has no active lease",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("interface-name", rd.InterfaceName),
+			zap.String("address", rd.Address),
+		)
+		writeError(w, r, http.StatusNotFound, ErrorCodeLeaseNotFound, "Failed to renew lease, because the address has no active lease", nil, response)
+		return
+	}
+
+	// Only the client, that added the address, may keep it alive
+	if identity := requestIdentity(r).String(); record.Owner != "" && record.Owner != identity {
+		zap.L().Error("Failed to renew lease, because the address belongs to another client",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("interface-name", rd.InterfaceName),
+			zap.String("address", rd.Address),
+			zap.String("identity", identity),
+			zap.String("owner", record.Owner),
+		)
+		writeError(w, r, http.StatusForbidden, ErrorCodeLeaseNotOwned, "Failed to renew lease, because the address belongs to another client", nil, response)
+		return
+	}
+
+	record.ExpiresAt = expiresAt
+	if err := s.Store.PutRecord(record); err != nil {
+		zap.L().Error("Failed to record renewed lease in state store",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("interface-name", rd.InterfaceName),
+			zap.String("address", rd.Address),
+			zap.Error(err),
+		)
+		writeError(w, r, http.StatusInternalServerError, ErrorCodeStoreFailure, "Failed to record renewed lease", err, response)
+		return
+	}
+
+	zap.L().Info("Renewed lease of address",
+		zap.String("remote-addr", r.RemoteAddr),
+		zap.String("interface-name", rd.InterfaceName),
+		zap.String("address", rd.Address),
+		zap.Time("expires-at", *expiresAt),
+	)
+
+	response.Message = "Successfully renewed lease of address"
+	response.Data = Lease{ExpiresAt: *expiresAt}
+	writeSuccess(w, r, response)
+}
+
+// Removes the addresses with expired leases from their interfaces
+func (s *Server) reapExpiredLeases(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, record := range s.Store.Records() {
+		if !record.Expired(now) {
+			continue
+		}
+
+		address, err := ParseAddress(record.Address)
+		if err != nil {
+			zap.L().Error("Failed to parse recorded cidr address",
+				zap.String("interface-name", record.InterfaceName),
+				zap.String("address", record.Address),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		link, err := LinkByName(record.InterfaceName)
+		if IsLinkNotFound(err) {
+			// The address vanished together with the interface
+			err = s.Store.Remove(record.InterfaceName, address)
+		} else if err == nil {
+			err = s.deleteAddress(link, address)
+		}
+
+		if err != nil {
+			zap.L().Error("Failed to delete address with expired lease",
+				zap.String("interface-name", record.InterfaceName),
+				zap.String("address", record.Address),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		zap.L().Info("Deleted address with expired lease",
+			zap.String("interface-name", record.InterfaceName),
+			zap.String("address", record.Address),
+		)
+		s.Events.Publish(Event{
+			Type: EventTypeLeaseExpired,
+			InterfaceName: record.InterfaceName,
+			Address: record.Address,
+			Message: "Deleted address with expired lease",
+		})
+	}
+}
+
+// Runs the lease reaper (blocks until done is closed)
+func (s *Server) RunLeaseReaper(done <-chan struct{}) {
+	ticker := time.NewTicker(leaseReapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			s.reapExpiredLeases(now)
+		}
+	}
+}
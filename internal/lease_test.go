@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestStoreLeasePersistence(t *testing.T) {
+	stateDirectoryPath := filepath.Join(t.TempDir(), "state")
+
+	store, err := OpenStore(stateDirectoryPath)
+	assert.NilError(t, err)
+
+	address, err := ParseAddress("192.0.2.1/24")
+	assert.NilError(t, err)
+
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.NilError(t, store.Put("eth0", address, &expiresAt, ""))
+
+	store, err = OpenStore(stateDirectoryPath)
+	assert.NilError(t, err)
+
+	record, ok := store.Record("eth0", address)
+	assert.Assert(t, ok)
+	assert.Assert(t, record.ExpiresAt.Equal(expiresAt))
+	assert.Assert(t, !record.Expired(expiresAt.Add(-time.Second)))
+	assert.Assert(t, record.Expired(expiresAt))
+
+	// Adding the address without lease makes it permanent
+	assert.NilError(t, store.Put("eth0", address, nil, ""))
+	record, ok = store.Record("eth0", address)
+	assert.Assert(t, ok)
+	assert.Assert(t, record.ExpiresAt == nil)
+	assert.Assert(t, !record.Expired(expiresAt))
+}
+
+func TestLeaseWithoutStore(t *testing.T) {
+	_, policyIPNetwork, err := net.ParseCIDR("192.0.2.0/24")
+	assert.NilError(t, err)
+
+	server := &Server{AddressPolicies: []AddressPolicy{
+		AddressPolicy{IPNetwork: IPNetwork{*policyIPNetwork}, InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")}},
+	}}
+
+	code, response := sendPostRequest(t, server, "/add", RequestData{Address: "192.0.2.1/24", InterfaceName: "lo", LeaseDuration: 60})
+	assert.Equal(t, code, http.StatusBadRequest)
+	assert.Equal(t, response.Error.Code, ErrorCodeInvalidRequest)
+
+	code, response = sendPostRequest(t, server, "/allocate", AllocateRequestData{InterfaceName: "lo", LeaseDuration: -1})
+	assert.Equal(t, code, http.StatusBadRequest)
+	assert.Equal(t, response.Error.Code, ErrorCodeInvalidRequest)
+}
+
+func TestLeaseRenewalAndExpiry(t *testing.T) {
+	assert.Assert(t, os.Getenv("NET_LINK") != "")
+
+	link, err := LinkByName(os.Getenv("NET_LINK"))
+	assert.NilError(t, err)
+
+	_, policyIPNetwork, err := net.ParseCIDR("198.51.100.0/24")
+	assert.NilError(t, err)
+
+	store, err := OpenStore(t.TempDir())
+	assert.NilError(t, err)
+
+	server := &Server{
+		AddressPolicies: []AddressPolicy{
+			AddressPolicy{IPNetwork: IPNetwork{*policyIPNetwork}, InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")}},
+		},
+		Store: store,
+		Events: NewEventLog(),
+	}
+
+	rd := RequestData{Address: "198.51.100.1/24", InterfaceName: os.Getenv("NET_LINK"), LeaseDuration: 60}
+
+	client := withClientCertificate(testClientCertificate(t))
+	code, response := sendPostRequest(t, server, "/add", rd, client)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Assert(t, response.Data.(map[string]interface{})["expires_at"] != nil)
+	assertAddressExists(t, link, "198.51.100.1/24", true)
+
+	address, err := ParseAddress(rd.Address)
+	assert.NilError(t, err)
+	record, ok := store.Record(rd.InterfaceName, address)
+	assert.Assert(t, ok)
+	expiresAt := *record.ExpiresAt
+
+	rd.LeaseDuration = 120
+	code, _ = sendPostRequest(t, server, "/renew", rd, client)
+	assert.Equal(t, code, http.StatusOK)
+	record, _ = store.Record(rd.InterfaceName, address)
+	assert.Assert(t, record.ExpiresAt.After(expiresAt))
+
+	// Other clients can't keep the address alive
+	code, response = sendPostRequest(t, server, "/renew", rd, withClientCertificate(&x509.Certificate{
+		Subject: pkix.Name{CommonName: "team-b"},
+	}))
+	assert.Equal(t, code, http.StatusForbidden)
+	assert.Equal(t, response.Error.Code, ErrorCodeLeaseNotOwned)
+	code, _ = sendPostRequest(t, server, "/renew", rd)
+	assert.Equal(t, code, http.StatusForbidden)
+
+	code, response = sendPostRequest(t, server, "/renew", RequestData{Address: "198.51.100.2/24", InterfaceName: rd.InterfaceName, LeaseDuration: 60})
+	assert.Equal(t, code, http.StatusNotFound)
+	assert.Equal(t, response.Error.Code, ErrorCodeLeaseNotFound)
+
+	// Nothing is reaped before the lease expires
+	server.reapExpiredLeases(time.Now())
+	assertAddressExists(t, link, "198.51.100.1/24", true)
+
+	server.reapExpiredLeases(record.ExpiresAt.Add(time.Second))
+	assertAddressExists(t, link, "198.51.100.1/24", false)
+	assert.Assert(t, !store.Contains(rd.InterfaceName, address))
+
+	events := server.Events.Events()
+	assert.Equal(t, len(events), 1)
+	assert.Equal(t, events[0].Type, EventTypeLeaseExpired)
+	assert.Equal(t, events[0].Address, "198.51.100.1/24")
+}
@@ -0,0 +1,189 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+)
+
+// Error returned, when adding an address would exceed an address limit of an
+// address policy
+type AddressLimitError struct {
+	PolicyName string
+	Limit int
+	PerIdentity bool
+	// Why the address can't be counted against the limit per client identity
+	// (empty, if the limit is reached)
+	Reason string
+}
+
+func (e *AddressLimitError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("the address policy \"%s\" limits the addresses per client identity, but %s", e.PolicyName, e.Reason)
+	}
+	if e.PerIdentity {
+		return fmt.Sprintf("the address policy \"%s\" allows at most %d addresses per client identity", e.PolicyName, e.Limit)
+	}
+	return fmt.Sprintf("the address policy \"%s\" allows at most %d addresses", e.PolicyName, e.Limit)
+}
+
+// Holds an address, that counts against the address limits
+type managedAddress struct {
+	interfaceName string
+	address CIDRAddress
+	recorded bool
+	owner string
+}
+
+// Returns the addresses configured on any network link of a network namespace
+// and the addresses recorded in the store (for the server's namespace), keyed
+// by interface name and address
+func (s *Server) managedAddresses(ns *Namespace) (map[string]*managedAddress, error) {
+	managed := make(map[string]*managedAddress)
+
+	links, err := ns.ListLinks()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, link := range links {
+		addresses, err := ListAddresses(link, netlink.FAMILY_ALL)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, address := range addresses {
+			managed[managedAddressKey((*link).Attrs().Name, address)] = &managedAddress{
+				interfaceName: (*link).Attrs().Name,
+				address: address,
+			}
+		}
+	}
+
+	if ns != nil {
+		return managed, nil
+	}
+
+	// Recorded addresses may be missing temporarily (e.g. on links, that are down)
+	for _, record := range s.Store.Records() {
+		address, err := ParseAddress(record.Address)
+		if err != nil {
+			continue
+		}
+
+		key := managedAddressKey(record.InterfaceName, address)
+		if _, ok := managed[key]; !ok {
+			managed[key] = &managedAddress{
+				interfaceName: record.InterfaceName,
+				address: address,
+			}
+		}
+		managed[key].recorded = true
+		managed[key].owner = record.Owner
+	}
+
+	return managed, nil
+}
+
+// Returns the key of an address of an interface
+func managedAddressKey(interfaceName string, address CIDRAddress) string {
+	return interfaceName + " " + address.IPNet.String()
+}
+
+// Returns why an address added to a network link wouldn't be recorded with its
+// owner (or an empty string, if it would be)
+func (s *Server) unrecordedReason(link NetworkLink, address CIDRAddress) string {
+	switch {
+	case s.Store == nil:
+		return "no state directory is configured"
+	case link.Namespace != nil:
+		return "addresses in other network namespaces aren't recorded"
+	case hasFiniteLifetime(address):
+		return "addresses with a finite lifetime aren't recorded"
+	}
+	return ""
+}
+
+// Checks whether adding a cidr address to a network link on behalf of a
+// client stays within the address limits of every address policy allowing it
+// (addresses, that are already recorded, don't count again)
+func (s *Server) checkAddressLimits(link NetworkLink, address CIDRAddress, policy []AddressPolicy, owner string) error {
+	interfaceName := (*link).Attrs().Name
+
+	var limitedPolicies []AddressPolicy
+	for _, p := range policy {
+		if (p.MaxAddresses > 0 || p.MaxAddressesPerIdentity > 0) && p.Allows(interfaceName, address) {
+			limitedPolicies = append(limitedPolicies, p)
+		}
+	}
+	if len(limitedPolicies) == 0 {
+		return nil
+	}
+
+	managed, err := s.managedAddresses(link.Namespace)
+	if err != nil {
+		return err
+	}
+
+	existing, exists := managed[managedAddressKey(interfaceName, address)]
+	if exists && (existing.recorded || link.Namespace != nil) {
+		return nil
+	}
+
+	for _, p := range limitedPolicies {
+		// Addresses, that aren't recorded with their owner, would escape the limit
+		if p.MaxAddressesPerIdentity > 0 {
+			reason := s.unrecordedReason(link, address)
+			// Clients identified by neither common name, uri nor dns name would all
+			// share the count of records without owner
+			if reason == "" && owner == "" {
+				reason = "the client has no identity to count the address against"
+			}
+			if reason != "" {
+				zap.L().Error("Rejected cidr address for interface, because it can't be counted against the address limit per client identity of a policy",
+					zap.String("interface-name", interfaceName),
+					zap.String("address", address.IPNet.String()),
+					zap.String("policy", p.DisplayName()),
+					zap.String("reason", reason),
+				)
+				return &AddressLimitError{p.DisplayName(), p.MaxAddressesPerIdentity, true, reason}
+			}
+		}
+
+		count, ownerCount := 0, 0
+		for _, m := range managed {
+			if !p.Allows(m.interfaceName, m.address) {
+				continue
+			}
+			count++
+			if m.recorded && m.owner == owner {
+				ownerCount++
+			}
+		}
+
+		// Addresses, that are already configured, don't increase the total
+		if !exists && p.MaxAddresses > 0 && count >= p.MaxAddresses {
+			zap.L().Error("Rejected cidr address for interface, because it exceeds the address limit of a policy",
+				zap.String("interface-name", interfaceName),
+				zap.String("address", address.IPNet.String()),
+				zap.String("policy", p.DisplayName()),
+				zap.Int("limit", p.MaxAddresses),
+			)
+			return &AddressLimitError{p.DisplayName(), p.MaxAddresses, false, ""}
+		}
+
+		if p.MaxAddressesPerIdentity > 0 && ownerCount >= p.MaxAddressesPerIdentity {
+			zap.L().Error("Rejected cidr address for interface, because it exceeds the address limit per client identity of a policy",
+				zap.String("interface-name", interfaceName),
+				zap.String("address", address.IPNet.String()),
+				zap.String("policy", p.DisplayName()),
+				zap.String("identity", owner),
+				zap.Int("limit", p.MaxAddressesPerIdentity),
+			)
+			return &AddressLimitError{p.DisplayName(), p.MaxAddressesPerIdentity, true, ""}
+		}
+	}
+
+	return nil
+}
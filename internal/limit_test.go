@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestAddressLimit(t *testing.T) {
+	assert.Assert(t, os.Getenv("NET_LINK") != "")
+
+	_, policyIPNetwork, err := net.ParseCIDR("198.51.100.0/24")
+	assert.NilError(t, err)
+
+	server := &Server{
+		AddressPolicies: []AddressPolicy{
+			{
+				Name: "limited",
+				IPNetwork: IPNetwork{*policyIPNetwork},
+				InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")},
+				MaxAddresses: 2,
+			},
+		},
+	}
+
+	addRequest := func(address string) RequestData {
+		return RequestData{Address: address, InterfaceName: os.Getenv("NET_LINK")}
+	}
+	defer sendPostRequest(t, server, "/delete", addRequest("198.51.100.1/24"))
+	defer sendPostRequest(t, server, "/delete", addRequest("198.51.100.2/24"))
+	defer sendPostRequest(t, server, "/delete", addRequest("198.51.100.3/24"))
+
+	status, _ := sendPostRequest(t, server, "/add", addRequest("198.51.100.1/24"))
+	assert.Equal(t, status, http.StatusOK)
+	status, _ = sendPostRequest(t, server, "/add", addRequest("198.51.100.2/24"))
+	assert.Equal(t, status, http.StatusOK)
+
+	status, response := sendPostRequest(t, server, "/add", addRequest("198.51.100.3/24"))
+	assert.Equal(t, status, http.StatusForbidden)
+	assert.Equal(t, response.Error.Code, ErrorCodeAddressLimitExceeded)
+	assert.ErrorContains(t, &AddressLimitError{"limited", 2, false, ""}, response.Error.Detail)
+
+	// Adding an address, that is already configured, doesn't count again
+	status, _ = sendPostRequest(t, server, "/add", addRequest("198.51.100.1/24"))
+	assert.Equal(t, status, http.StatusOK)
+
+	// Deletions earlier in a batch free up addresses for later additions
+	status, response = sendPostRequest(t, server, "/batch", BatchRequestData{
+		Operations: []BatchOperation{
+			{Action: "delete", Address: "198.51.100.2/24", InterfaceName: os.Getenv("NET_LINK")},
+			{Action: "add", Address: "198.51.100.3/24", InterfaceName: os.Getenv("NET_LINK")},
+		},
+	})
+	assert.Equal(t, status, http.StatusOK, response.Message)
+
+	status, response = sendPostRequest(t, server, "/allocate", AllocateRequestData{
+		InterfaceName: os.Getenv("NET_LINK"),
+	})
+	assert.Equal(t, status, http.StatusForbidden)
+	assert.Equal(t, response.Error.Code, ErrorCodeAddressLimitExceeded)
+}
+
+func TestAddressLimitPerIdentity(t *testing.T) {
+	assert.Assert(t, os.Getenv("NET_LINK") != "")
+
+	_, policyIPNetwork, err := net.ParseCIDR("198.51.100.0/24")
+	assert.NilError(t, err)
+
+	store, err := OpenStore(t.TempDir())
+	assert.NilError(t, err)
+
+	// An address recorded for another client doesn't count against this one
+	otherAddress, err := ParseAddress("198.51.100.10/24")
+	assert.NilError(t, err)
+	assert.NilError(t, store.Put(os.Getenv("NET_LINK"), otherAddress, nil, "cn:other"))
+
+	server := &Server{
+		AddressPolicies: []AddressPolicy{
+			{
+				IPNetwork: IPNetwork{*policyIPNetwork},
+				InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")},
+				MaxAddressesPerIdentity: 1,
+				AllowLifetimes: true,
+			},
+		},
+		Store: store,
+	}
+
+	addRequest := func(address string) RequestData {
+		return RequestData{Address: address, InterfaceName: os.Getenv("NET_LINK")}
+	}
+	client := withClientCertificate(testClientCertificate(t))
+	defer sendPostRequest(t, server, "/delete", addRequest("198.51.100.1/24"), client)
+
+	status, _ := sendPostRequest(t, server, "/add", addRequest("198.51.100.1/24"), client)
+	assert.Equal(t, status, http.StatusOK)
+
+	status, response := sendPostRequest(t, server, "/add", addRequest("198.51.100.2/24"), client)
+	assert.Equal(t, status, http.StatusForbidden)
+	assert.Equal(t, response.Error.Code, ErrorCodeAddressLimitExceeded)
+
+	// Clients without identity can't be told apart from each other
+	status, response = sendPostRequest(t, server, "/add", addRequest("198.51.100.4/24"), withClientCertificate(&x509.Certificate{
+		Subject: pkix.Name{OrganizationalUnit: []string{"team-a"}},
+	}))
+	assert.Equal(t, status, http.StatusForbidden)
+	assert.Equal(t, response.Error.Code, ErrorCodeAddressLimitExceeded)
+	assert.Assert(t, strings.Contains(response.Error.Detail, "no identity"))
+
+	// Addresses with a finite lifetime aren't recorded and can't be counted
+	validLifetime := 60
+	status, response = sendPostRequest(t, server, "/add", RequestData{
+		Address: "198.51.100.3/24",
+		InterfaceName: os.Getenv("NET_LINK"),
+		AddressOptions: AddressOptions{ValidLifetime: &validLifetime},
+	}, client)
+	assert.Equal(t, status, http.StatusForbidden)
+	assert.Equal(t, response.Error.Code, ErrorCodeAddressLimitExceeded)
+	assert.Assert(t, strings.Contains(response.Error.Detail, "finite lifetime"))
+}
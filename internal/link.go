@@ -0,0 +1,171 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+)
+
+// Operational states of network links (as reported by netlink)
+var linkOperStates = []string{"unknown", "not-present", "down", "lower-layer-down", "testing", "dormant", "up"}
+
+// Parses the prefix of a hardware address (e.g. an OUI like "02:00:5e")
+func ParseHardwareAddressPrefix(prefix string) ([]byte, error) {
+	parts := strings.Split(prefix, ":")
+	if len(parts) > 20 {
+		return nil, fmt.Errorf("invalid hardware address prefix \"%s\"", prefix)
+	}
+
+	bs := make([]byte, len(parts))
+	for i, part := range parts {
+		b, err := hex.DecodeString(part)
+		if err != nil || len(b) != 1 {
+			return nil, fmt.Errorf("invalid hardware address prefix \"%s\"", prefix)
+		}
+		bs[i] = b[0]
+	}
+
+	return bs, nil
+}
+
+// Validates the link matcher of an address policy
+func (lm *LinkMatcher) validate(policyIndex int) error {
+	if lm == nil {
+		return nil
+	}
+
+	if lm.HardwareAddressPrefix != "" {
+		if _, err := ParseHardwareAddressPrefix(lm.HardwareAddressPrefix); err != nil {
+			return fmt.Errorf("The address policy %d matches an invalid hardware address prefix \"%s\"", policyIndex, lm.HardwareAddressPrefix)
+		}
+	}
+
+	if lm.VLANID < 0 || lm.VLANID > 4094 {
+		return fmt.Errorf("The address policy %d matches an invalid vlan id %d", policyIndex, lm.VLANID)
+	}
+
+	for _, operState := range lm.OperStates {
+		if !containsString(linkOperStates, operState) {
+			return fmt.Errorf("The address policy %d matches an unknown operstate \"%s\"", policyIndex, operState)
+		}
+	}
+
+	return nil
+}
+
+// Returns the name of a network link in the namespace of another link by its
+// index (empty, if there is none)
+func relatedLinkName(link NetworkLink, index int) string {
+	if index == 0 {
+		return ""
+	}
+
+	relatedLink, err := link.Namespace.netlinkHandle().LinkByIndex(index)
+	if err != nil {
+		zap.L().Warn("Failed to retreive related interface",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.Int("interface-index", index),
+			zap.Error(err),
+		)
+		return ""
+	}
+
+	return relatedLink.Attrs().Name
+}
+
+// Checks whether a network link has the attributes of a link matcher (a nil
+// matcher matches every link)
+func (lm *LinkMatcher) Matches(link NetworkLink) bool {
+	if lm == nil {
+		return true
+	}
+
+	attrs := (*link).Attrs()
+
+	if len(lm.Types) > 0 && !containsString(lm.Types, (*link).Type()) {
+		return false
+	}
+
+	if lm.Master != "" && relatedLinkName(link, attrs.MasterIndex) != lm.Master {
+		return false
+	}
+
+	if lm.Parent != "" && relatedLinkName(link, attrs.ParentIndex) != lm.Parent {
+		return false
+	}
+
+	if lm.HardwareAddressPrefix != "" {
+		prefix, err := ParseHardwareAddressPrefix(lm.HardwareAddressPrefix)
+		if err != nil || !bytes.HasPrefix(attrs.HardwareAddr, prefix) {
+			return false
+		}
+	}
+
+	if lm.VLANID != 0 {
+		vlan, ok := link.Link.(*netlink.Vlan)
+		if !ok || vlan.VlanId != lm.VLANID {
+			return false
+		}
+	}
+
+	if lm.AliasRegex != nil && !lm.AliasRegex.MatchString(attrs.Alias) {
+		return false
+	}
+
+	if lm.Group != nil && attrs.Group != *lm.Group {
+		return false
+	}
+
+	if len(lm.OperStates) > 0 && !containsString(lm.OperStates, attrs.OperState.String()) {
+		return false
+	}
+
+	return true
+}
+
+// Checks whether any of the address policies matches link attributes
+func hasLinkMatchers(policy []AddressPolicy) bool {
+	for _, p := range policy {
+		if p.Link != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the address policies, that apply to a network link (policies
+// without link matcher apply to every link)
+func PoliciesForLink(policy []AddressPolicy, link NetworkLink) []AddressPolicy {
+	if !hasLinkMatchers(policy) {
+		return policy
+	}
+
+	var linkPolicies []AddressPolicy
+	for _, p := range policy {
+		if p.Link.Matches(link) {
+			linkPolicies = append(linkPolicies, p)
+		}
+	}
+	return linkPolicies
+}
+
+// Returns the address policies, that can be evaluated before the interface of
+// a request is resolved (deny policies matching link attributes are left out,
+// as they might not apply to the interface)
+func policiesBeforeLink(policy []AddressPolicy) []AddressPolicy {
+	if !hasLinkMatchers(policy) {
+		return policy
+	}
+
+	var namePolicies []AddressPolicy
+	for _, p := range policy {
+		if !p.IsDeny() || p.Link == nil {
+			namePolicies = append(namePolicies, p)
+		}
+	}
+	return namePolicies
+}
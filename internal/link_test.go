@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"net"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"gotest.tools/assert"
+)
+
+func TestParseHardwareAddressPrefix(t *testing.T) {
+	prefix, err := ParseHardwareAddressPrefix("02:00:5e")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, prefix, []byte{0x02, 0x00, 0x5e})
+
+	_, err = ParseHardwareAddressPrefix("02:0:5e")
+	assert.ErrorContains(t, err, "invalid hardware address prefix")
+
+	_, err = ParseHardwareAddressPrefix("02:00:zz")
+	assert.ErrorContains(t, err, "invalid hardware address prefix")
+}
+
+func TestLinkMatcherMatches(t *testing.T) {
+	hardwareAddress, err := net.ParseMAC("02:00:5e:10:00:01")
+	assert.NilError(t, err)
+
+	group := uint32(7)
+	link := &Link{&netlink.Vlan{
+		LinkAttrs: netlink.LinkAttrs{
+			Name: "bond0.120",
+			HardwareAddr: hardwareAddress,
+			Alias: "uplink",
+			Group: group,
+			OperState: netlink.OperUp,
+		},
+		VlanId: 120,
+	}, nil}
+
+	var lm *LinkMatcher
+	assert.Assert(t, lm.Matches(link))
+
+	assert.Assert(t, (&LinkMatcher{Types: []string{"vlan"}}).Matches(link))
+	assert.Assert(t, !(&LinkMatcher{Types: []string{"bridge", "veth"}}).Matches(link))
+
+	assert.Assert(t, (&LinkMatcher{VLANID: 120}).Matches(link))
+	assert.Assert(t, !(&LinkMatcher{VLANID: 121}).Matches(link))
+
+	assert.Assert(t, (&LinkMatcher{HardwareAddressPrefix: "02:00:5e"}).Matches(link))
+	assert.Assert(t, !(&LinkMatcher{HardwareAddressPrefix: "02:00:5f"}).Matches(link))
+
+	assert.Assert(t, (&LinkMatcher{AliasRegex: &Regexp{*regexp.MustCompile("^up")}}).Matches(link))
+	assert.Assert(t, !(&LinkMatcher{AliasRegex: &Regexp{*regexp.MustCompile("^down")}}).Matches(link))
+
+	assert.Assert(t, (&LinkMatcher{Group: &group}).Matches(link))
+	otherGroup := uint32(8)
+	assert.Assert(t, !(&LinkMatcher{Group: &otherGroup}).Matches(link))
+
+	assert.Assert(t, (&LinkMatcher{OperStates: []string{"up", "unknown"}}).Matches(link))
+	assert.Assert(t, !(&LinkMatcher{OperStates: []string{"down"}}).Matches(link))
+
+	// Every attribute must match
+	assert.Assert(t, !(&LinkMatcher{Types: []string{"vlan"}, VLANID: 121}).Matches(link))
+
+	// Only vlan links have a vlan id
+	bridge := &Link{&netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: "br0"}}, nil}
+	assert.Assert(t, !(&LinkMatcher{VLANID: 120}).Matches(bridge))
+}
+
+func TestAddAddressWithLinkMatcher(t *testing.T) {
+	bridge := &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: "ipam-lmbr0"}}
+	assert.NilError(t, netlink.LinkAdd(bridge))
+	defer netlink.LinkDel(bridge)
+
+	veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "ipam-lm0"}, PeerName: "ipam-lm1"}
+	assert.NilError(t, netlink.LinkAdd(veth))
+	defer netlink.LinkDel(veth)
+
+	port, err := netlink.LinkByName("ipam-lm0")
+	assert.NilError(t, err)
+	assert.NilError(t, netlink.LinkSetMaster(port, bridge))
+
+	for _, name := range []string{"ipam-lmbr0", "ipam-lm0", "ipam-lm1"} {
+		link, err := netlink.LinkByName(name)
+		assert.NilError(t, err)
+		assert.NilError(t, netlink.LinkSetUp(link))
+	}
+
+	_, policyIPNetwork, err := net.ParseCIDR("198.51.100.0/24")
+	assert.NilError(t, err)
+	_, deniedIPNetwork, err := net.ParseCIDR("198.51.100.128/25")
+	assert.NilError(t, err)
+
+	server := &Server{
+		AddressPolicies: []AddressPolicy{
+			{
+				IPNetwork: IPNetwork{*policyIPNetwork},
+				InterfaceNameRegex: Regexp{*regexp.MustCompile("^ipam-lm")},
+				Link: &LinkMatcher{
+					Types: []string{"veth"},
+					Master: "ipam-lmbr0",
+				},
+			},
+			{
+				Action: PolicyActionDeny,
+				IPNetwork: IPNetwork{*deniedIPNetwork},
+				InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")},
+				Link: &LinkMatcher{
+					Master: "ipam-lmbr0",
+				},
+			},
+		},
+	}
+
+	// The port of the bridge matches the allow policy
+	status, response := sendPostRequest(t, server, "/add", RequestData{
+		Address: "198.51.100.10/24",
+		InterfaceName: "ipam-lm0",
+	})
+	assert.Equal(t, status, http.StatusOK, response.Message)
+
+	// The peer isn't a port of the bridge
+	status, response = sendPostRequest(t, server, "/add", RequestData{
+		Address: "198.51.100.11/24",
+		InterfaceName: "ipam-lm1",
+	})
+	assert.Equal(t, status, http.StatusForbidden)
+	assert.Equal(t, response.Error.Code, ErrorCodePolicyDenied)
+
+	// The deny policy only applies to ports of the bridge
+	status, response = sendPostRequest(t, server, "/add", RequestData{
+		Address: "198.51.100.130/24",
+		InterfaceName: "ipam-lm0",
+	})
+	assert.Equal(t, status, http.StatusForbidden)
+	assert.Equal(t, response.Error.Code, ErrorCodePolicyDenied)
+
+	// Converging the peer to no addresses doesn't remove addresses, that the
+	// policy only allows on ports of the bridge
+	peerLink, err := LinkByName("ipam-lm1")
+	assert.NilError(t, err)
+	address, err := ParseAddress("198.51.100.12/24")
+	assert.NilError(t, err)
+	assert.NilError(t, netlink.AddrAdd(*peerLink, address))
+
+	code, result := sendDesiredStateRequest(t, server.AddressPolicies, DesiredStateRequestData{
+		InterfaceName: "ipam-lm1",
+		Addresses: []string{},
+	})
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, len(result.Operations), 0)
+	assertAddressExists(t, peerLink, "198.51.100.12/24", true)
+
+	// Leases are only renewed on interfaces matching the policy
+	status, response = sendPostRequest(t, server, "/renew", RequestData{
+		Address: "198.51.100.12/24",
+		InterfaceName: "ipam-lm1",
+		LeaseDuration: 60,
+	})
+	assert.Equal(t, status, http.StatusForbidden)
+	assert.Equal(t, response.Error.Code, ErrorCodePolicyDenied)
+}
@@ -0,0 +1,271 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+	"go.uber.org/zap"
+)
+
+// Directory, in which iproute2 keeps the named network namespaces
+const namedNamespaceDirectory = "/var/run/netns"
+
+// Netlink handle operating in the network namespace of the server
+var ownNetlinkHandle = &netlink.Handle{}
+
+// Holds a network link together with the network namespace it lives in
+type Link struct {
+	netlink.Link
+	Namespace *Namespace
+}
+
+// Network namespace, in which address operations are executed (a nil
+// namespace is the network namespace of the server)
+type Namespace struct {
+	// Name of the namespace as given in the request
+	Name string
+	path string
+	handle *netlink.Handle
+}
+
+// Error returned, when a network namespace reference is malformed
+type InvalidNamespaceError struct {
+	Name string
+}
+
+func (e *InvalidNamespaceError) Error() string {
+	return fmt.Sprintf("invalid network namespace \"%s\" (expected a name in %s, a pid or a clean absolute path)", e.Name, namedNamespaceDirectory)
+}
+
+// Checks whether a network namespace reference is an absolute path, that
+// isn't clean (the netns_regex is matched against the reference as given, so
+// "/run/netns/a/../../proc/1/ns/net" would otherwise pass "^/run/netns/")
+func isUncleanNamespacePath(name string) bool {
+	return filepath.IsAbs(name) && filepath.Clean(name) != name
+}
+
+// Returns the path of a network namespace referenced by the name of a namespace
+// in /var/run/netns, the pid of a process or a clean absolute path
+func NamespacePath(name string) (string, error) {
+	if filepath.IsAbs(name) {
+		if isUncleanNamespacePath(name) {
+			return "", &InvalidNamespaceError{name}
+		}
+		return name, nil
+	}
+
+	if pid, err := strconv.Atoi(name); err == nil {
+		if pid <= 0 {
+			return "", &InvalidNamespaceError{name}
+		}
+		return fmt.Sprintf("/proc/%d/ns/net", pid), nil
+	}
+
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return "", &InvalidNamespaceError{name}
+	}
+	return filepath.Join(namedNamespaceDirectory, name), nil
+}
+
+// Opens a network namespace by its reference (an empty reference returns the
+// nil namespace of the server)
+func OpenNamespace(name string) (*Namespace, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	path, err := NamespacePath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	nsHandle, err := netns.GetFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+	defer nsHandle.Close()
+
+	// The netlink sockets of the handle stay bound to the namespace
+	handle, err := netlink.NewHandleAt(nsHandle)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Namespace{
+		Name: name,
+		path: path,
+		handle: handle,
+	}, nil
+}
+
+// Releases the netlink handle of a network namespace
+func (ns *Namespace) Close() {
+	if ns != nil && ns.handle != nil {
+		ns.handle.Delete()
+	}
+}
+
+// Returns the reference of a network namespace (empty for the server's own)
+func (ns *Namespace) String() string {
+	if ns == nil {
+		return ""
+	}
+	return ns.Name
+}
+
+// Returns the netlink handle operating in a network namespace
+func (ns *Namespace) netlinkHandle() *netlink.Handle {
+	if ns == nil {
+		return ownNetlinkHandle
+	}
+	return ns.handle
+}
+
+// Opens a socket in a network namespace (the socket stays bound to the
+// namespace, after the thread switched back)
+func (ns *Namespace) socket(domain int, typ int, proto int) (int, error) {
+	if ns == nil {
+		return unix.Socket(domain, typ, proto)
+	}
+
+	// The namespace is opened again, as advertisements may outlive the request
+	target, err := netns.GetFromPath(ns.path)
+	if err != nil {
+		return -1, err
+	}
+	defer target.Close()
+
+	runtime.LockOSThread()
+
+	origin, err := netns.Get()
+	if err != nil {
+		runtime.UnlockOSThread()
+		return -1, err
+	}
+	defer origin.Close()
+
+	if err := netns.Set(target); err != nil {
+		runtime.UnlockOSThread()
+		return -1, err
+	}
+
+	fd, socketErr := unix.Socket(domain, typ, proto)
+
+	// A thread, that can't switch back, must not be reused by other goroutines
+	if err := netns.Set(origin); err != nil {
+		if socketErr == nil {
+			unix.Close(fd)
+		}
+		return -1, err
+	}
+	runtime.UnlockOSThread()
+
+	return fd, socketErr
+}
+
+// Returns a network link of a network namespace based on the interface name
+func (ns *Namespace) LinkByName(interfaceName string) (NetworkLink, error) {
+	link, err := ns.netlinkHandle().LinkByName(interfaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Link{link, ns}, nil
+}
+
+// Returns all network links of a network namespace
+func (ns *Namespace) ListLinks() ([]NetworkLink, error) {
+	links, err := ns.netlinkHandle().LinkList()
+	if err != nil {
+		return nil, err
+	}
+
+	networkLinks := make([]NetworkLink, len(links))
+	for i := range links {
+		networkLinks[i] = &Link{links[i], ns}
+	}
+
+	return networkLinks, nil
+}
+
+// Checks whether a network namespace is allowed by an address policy (a policy
+// without namespace matcher only allows the namespace of the server, unclean
+// absolute paths aren't allowed by any policy)
+func (ap AddressPolicy) AllowsNamespace(name string) bool {
+	if ap.NetnsRegex == nil {
+		return name == ""
+	}
+	if isUncleanNamespacePath(name) {
+		return false
+	}
+	return ap.NetnsRegex.MatchString(name)
+}
+
+// Returns the address policies, that allow a network namespace
+func PoliciesForNamespace(policies []AddressPolicy, name string) []AddressPolicy {
+	var namespacePolicies []AddressPolicy
+	for _, p := range policies {
+		if p.AllowsNamespace(name) {
+			namespacePolicies = append(namespacePolicies, p)
+		}
+	}
+	return namespacePolicies
+}
+
+// Opens the network namespace of a request, if it's allowed by any of the
+// address policies, and returns it together with the policies allowing it, or
+// writes an error response
+func openRequestNamespace(w http.ResponseWriter, r *http.Request, requestAction string, policy []AddressPolicy, name string, response Response) (*Namespace, []AddressPolicy, bool) {
+	policy = PoliciesForNamespace(policy, name)
+	if name == "" {
+		return nil, policy, true
+	}
+
+	if _, err := NamespacePath(name); err != nil {
+		zap.L().Error("Validation of request failed: Invalid network namespace",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+			zap.String("netns", name),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Invalid network namespace (\"netns\")", err, response)
+		return nil, nil, false
+	}
+
+	if len(policy) == 0 {
+		zap.L().Error("Rejected network namespace, because no matching policy was found",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+			zap.String("netns", name),
+		)
+		writeError(w, r, http.StatusForbidden, ErrorCodePolicyDenied, "Rejected network namespace, because no matching policy was found", nil, response)
+		return nil, nil, false
+	}
+
+	ns, err := OpenNamespace(name)
+	if err != nil {
+		zap.L().Error("Failed to open network namespace",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+			zap.String("netns", name),
+			zap.Error(err),
+		)
+
+		if errors.Is(err, os.ErrNotExist) {
+			writeError(w, r, http.StatusNotFound, ErrorCodeNamespaceNotFound, "Network namespace not found", err, response)
+		} else {
+			writeError(w, r, http.StatusInternalServerError, ErrorCodeNetlinkFailure, "Failed to open network namespace", err, response)
+		}
+		return nil, nil, false
+	}
+
+	return ns, policy, true
+}
@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"gotest.tools/assert"
+)
+
+// Creates an unnamed network namespace and returns its path
+func createTestNamespace(t *testing.T) string {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origin, err := netns.Get()
+	assert.NilError(t, err)
+	defer origin.Close()
+
+	nsHandle, err := netns.New()
+	assert.NilError(t, err)
+	assert.NilError(t, netns.Set(origin))
+	t.Cleanup(func() { nsHandle.Close() })
+
+	return fmt.Sprintf("/proc/%d/fd/%d", os.Getpid(), int(nsHandle))
+}
+
+func TestNamespacePath(t *testing.T) {
+	for name, expectedPath := range map[string]string{
+		"blue": "/var/run/netns/blue",
+		"1234": "/proc/1234/ns/net",
+		"/run/netns/red": "/run/netns/red",
+	} {
+		path, err := NamespacePath(name)
+		assert.NilError(t, err)
+		assert.Equal(t, path, expectedPath)
+	}
+
+	for _, name := range []string{"", "..", "blue/red", "0", "-1", "/run/netns/../netns/red", "/run/netns/tenant-x/../../../proc/1/ns/net", "/run/netns/red/"} {
+		_, err := NamespacePath(name)
+		assert.ErrorType(t, err, &InvalidNamespaceError{})
+	}
+}
+
+func TestAllowsNamespace(t *testing.T) {
+	ownPolicy := AddressPolicy{}
+	assert.Assert(t, ownPolicy.AllowsNamespace(""))
+	assert.Assert(t, !ownPolicy.AllowsNamespace("blue"))
+
+	namespacePolicy := AddressPolicy{NetnsRegex: &Regexp{*regexp.MustCompile("^blue$")}}
+	assert.Assert(t, !namespacePolicy.AllowsNamespace(""))
+	assert.Assert(t, namespacePolicy.AllowsNamespace("blue"))
+	assert.Assert(t, !namespacePolicy.AllowsNamespace("red"))
+
+	assert.Equal(t, len(PoliciesForNamespace([]AddressPolicy{ownPolicy, namespacePolicy}, "blue")), 1)
+
+	// Path traversal doesn't escape the directory allowed by a policy
+	pathPolicy := AddressPolicy{NetnsRegex: &Regexp{*regexp.MustCompile("^/run/netns/tenant-")}}
+	assert.Assert(t, pathPolicy.AllowsNamespace("/run/netns/tenant-x"))
+	assert.Assert(t, !pathPolicy.AllowsNamespace("/run/netns/tenant-x/../../../proc/1/ns/net"))
+}
+
+func TestAddAddressInNamespace(t *testing.T) {
+	path := createTestNamespace(t)
+
+	veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "ipam-ns0"}, PeerName: "ipam-ns1"}
+	assert.NilError(t, netlink.LinkAdd(veth))
+	defer netlink.LinkDel(veth)
+
+	nsHandle, err := netns.GetFromPath(path)
+	assert.NilError(t, err)
+	defer nsHandle.Close()
+
+	peerLink, err := netlink.LinkByName("ipam-ns1")
+	assert.NilError(t, err)
+	assert.NilError(t, netlink.LinkSetNsFd(peerLink, int(nsHandle)))
+
+	hostLink, err := LinkByName("ipam-ns0")
+	assert.NilError(t, err)
+	assert.NilError(t, netlink.LinkSetUp(hostLink.Link))
+
+	ns, err := OpenNamespace(path)
+	assert.NilError(t, err)
+	defer ns.Close()
+
+	// The peer isn't visible in the server's namespace anymore
+	_, err = LinkByName("ipam-ns1")
+	assert.Assert(t, IsLinkNotFound(err))
+
+	link, err := ns.LinkByName("ipam-ns1")
+	assert.NilError(t, err)
+	assert.NilError(t, ns.netlinkHandle().LinkSetUp(link.Link))
+
+	// Advertising the address requires a raw socket in the namespace
+	address, err := ParseAddress("198.51.100.1/24")
+	assert.NilError(t, err)
+	assert.NilError(t, AddAddress(link, address, Advertisement{}))
+
+	exists, err := AddressExists(link, address)
+	assert.NilError(t, err)
+	assert.Assert(t, exists)
+
+	exists, err = AddressExists(hostLink, address)
+	assert.NilError(t, err)
+	assert.Assert(t, !exists)
+
+	assert.NilError(t, DeleteAddress(link, address))
+
+	exists, err = AddressExists(link, address)
+	assert.NilError(t, err)
+	assert.Assert(t, !exists)
+}
+
+func TestAddAddressWithNamespacePolicy(t *testing.T) {
+	_, policyIPNetwork, err := net.ParseCIDR("198.51.100.0/24")
+	assert.NilError(t, err)
+
+	server := &Server{
+		AddressPolicies: []AddressPolicy{
+			{
+				IPNetwork: IPNetwork{*policyIPNetwork},
+				InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")},
+				NetnsRegex: &Regexp{*regexp.MustCompile("^ipam-test-")},
+			},
+		},
+	}
+
+	// The policy doesn't allow the server's own namespace
+	status, response := sendPostRequest(t, server, "/add", RequestData{
+		Address: "198.51.100.1/24",
+		InterfaceName: "lo",
+	})
+	assert.Equal(t, status, http.StatusForbidden)
+	assert.Equal(t, response.Error.Code, ErrorCodePolicyDenied)
+
+	status, response = sendPostRequest(t, server, "/add", RequestData{
+		Address: "198.51.100.1/24",
+		InterfaceName: "lo",
+		Netns: "other",
+	})
+	assert.Equal(t, status, http.StatusForbidden)
+	assert.Equal(t, response.Error.Code, ErrorCodePolicyDenied)
+
+	status, response = sendPostRequest(t, server, "/add", RequestData{
+		Address: "198.51.100.1/24",
+		InterfaceName: "lo",
+		Netns: "ipam-test-/..",
+	})
+	assert.Equal(t, status, http.StatusBadRequest)
+	assert.Equal(t, response.Error.Code, ErrorCodeInvalidRequest)
+
+	status, response = sendPostRequest(t, server, "/add", RequestData{
+		Address: "198.51.100.1/24",
+		InterfaceName: "lo",
+		Netns: "ipam-test-missing",
+	})
+	assert.Equal(t, status, http.StatusNotFound)
+	assert.Equal(t, response.Error.Code, ErrorCodeNamespaceNotFound)
+	assert.Equal(t, response.Netns, "ipam-test-missing")
+}
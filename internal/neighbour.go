@@ -0,0 +1,481 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+)
+
+// Holds the request data of a static neighbour operation
+type NeighbourRequestData struct {
+	Address string `json:"address"`
+	InterfaceName string `json:"interface_name"`
+	HardwareAddress string `json:"hardware_address"`
+	State string `json:"state"`
+}
+
+// Holds information about a neighbour entry of a network link
+type NeighbourInfo struct {
+	InterfaceName string `json:"interface_name"`
+	Address string `json:"address"`
+	HardwareAddress string `json:"hardware_address"`
+	State string `json:"state"`
+	Family string `json:"family"`
+}
+
+// Holds the list of neighbour entries returned by a list request
+type NeighbourList struct {
+	Neighbours []NeighbourInfo `json:"neighbours"`
+}
+
+// Renders the neighbour list as plain text (one entry per line)
+func (nl NeighbourList) PlainText() string {
+	var sb strings.Builder
+	for _, n := range nl.Neighbours {
+		fmt.Fprintf(&sb, "%s dev %s lladdr %s %s\n", n.Address, n.InterfaceName, n.HardwareAddress, n.State)
+	}
+	return sb.String()
+}
+
+// Neighbour states, that can be configured via the api
+var neighbourStates = map[string]int{
+	"permanent": netlink.NUD_PERMANENT,
+	"reachable": netlink.NUD_REACHABLE,
+	"noarp": netlink.NUD_NOARP,
+}
+
+// Neighbour state of entries, if none is requested
+const defaultNeighbourState = "permanent"
+
+// Parses the name of a neighbour state (defaults to permanent)
+func ParseNeighbourState(state string) (int, error) {
+	if state == "" {
+		state = defaultNeighbourState
+	}
+
+	if nudState, ok := neighbourStates[state]; ok {
+		return nudState, nil
+	}
+	return 0, fmt.Errorf("invalid neighbour state \"%s\" (expected \"permanent\", \"reachable\" or \"noarp\")", state)
+}
+
+// Returns the name of a neighbour state, if it can be configured via the api
+func neighbourStateName(nudState int) (string, bool) {
+	for name, s := range neighbourStates {
+		if s == nudState {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Checks whether a neighbour policy applies to a client identity (a policy
+// without identities applies to every client)
+func (np NeighbourPolicy) AppliesTo(identity ClientIdentity) bool {
+	return matchesAnyIdentity(np.Identities, identity)
+}
+
+// Checks whether a neighbour entry for an ip address on an interface is
+// allowed by a neighbour policy (an empty state is allowed by every policy,
+// a policy without states only allows permanent entries)
+func (np NeighbourPolicy) Allows(interfaceName string, ip net.IP, state string) bool {
+	if !np.InterfaceNameRegex.MatchString(interfaceName) || !np.IPNetwork.Contains(ip) {
+		return false
+	}
+
+	if state == "" {
+		return true
+	}
+	if len(np.States) == 0 {
+		return state == defaultNeighbourState
+	}
+	return containsString(np.States, state)
+}
+
+// Returns the neighbour policies, that apply to a client identity
+func NeighbourPoliciesForIdentity(policies []NeighbourPolicy, identity ClientIdentity) []NeighbourPolicy {
+	var identityPolicies []NeighbourPolicy
+	for _, p := range policies {
+		if p.AppliesTo(identity) {
+			identityPolicies = append(identityPolicies, p)
+		}
+	}
+	return identityPolicies
+}
+
+// Checks whether any of the neighbour policies allows a neighbour entry for
+// an ip address on an interface
+func neighbourPoliciesAllow(policy []NeighbourPolicy, interfaceName string, ip net.IP, state string) bool {
+	for _, p := range policy {
+		if p.Allows(interfaceName, ip, state) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the neighbour entries of a network link, that are in a state
+// configurable via the api
+func ListNeighbours(link NetworkLink, family int) ([]netlink.Neigh, error) {
+	neighs, err := link.Namespace.netlinkHandle().NeighList((*link).Attrs().Index, family)
+	if err != nil {
+		zap.L().Error("Error while retreiving neighbour entries of interface",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	var configurableNeighs []netlink.Neigh
+	for _, neigh := range neighs {
+		if neigh.Flags & netlink.NTF_PROXY != 0 || neigh.IP == nil {
+			continue
+		}
+		if _, ok := neighbourStateName(neigh.State); ok {
+			configurableNeighs = append(configurableNeighs, neigh)
+		}
+	}
+
+	return configurableNeighs, nil
+}
+
+// Returns the neighbour entry of an ip address on a network link or nil, if
+// there is none
+func findNeighbour(link NetworkLink, ip net.IP) (*netlink.Neigh, error) {
+	neighs, err := link.Namespace.netlinkHandle().NeighList((*link).Attrs().Index, netlink.FAMILY_ALL)
+	if err != nil {
+		zap.L().Error("Error while retreiving neighbour entries of interface",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	for _, neigh := range neighs {
+		if neigh.Flags & netlink.NTF_PROXY == 0 && neigh.IP.Equal(ip) {
+			return &neigh, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Returns the address family of an ip address
+func ipFamily(ip net.IP) int {
+	if ip.To4() != nil {
+		return netlink.FAMILY_V4
+	}
+	return netlink.FAMILY_V6
+}
+
+// Sets the neighbour entry of an ip address on a network link, replacing an
+// existing entry of the ip address
+func SetNeighbour(link NetworkLink, ip net.IP, hardwareAddr net.HardwareAddr, nudState int) error {
+	existingNeigh, err := findNeighbour(link, ip)
+	if err != nil {
+		return err
+	}
+	if existingNeigh != nil && existingNeigh.State == nudState && bytes.Equal(existingNeigh.HardwareAddr, hardwareAddr) {
+		zap.L().Info("Neighbour entry already exists on interface",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.Stringer("address", ip),
+			zap.Stringer("hardware-address", hardwareAddr),
+		)
+		return nil
+	}
+
+	err = link.Namespace.netlinkHandle().NeighSet(&netlink.Neigh{
+		LinkIndex: (*link).Attrs().Index,
+		Family: ipFamily(ip),
+		State: nudState,
+		IP: ip,
+		HardwareAddr: hardwareAddr,
+	})
+	if err != nil {
+		zap.L().Error("Failed to set neighbour entry on interface",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.Stringer("address", ip),
+			zap.Stringer("hardware-address", hardwareAddr),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	zap.L().Info("Set neighbour entry on interface",
+		zap.String("interface-name", (*link).Attrs().Name),
+		zap.Stringer("address", ip),
+		zap.Stringer("hardware-address", hardwareAddr),
+	)
+
+	return nil
+}
+
+// Removes the neighbour entry of an ip address from a network link
+func DeleteNeighbour(link NetworkLink, ip net.IP) error {
+	existingNeigh, err := findNeighbour(link, ip)
+	if err != nil {
+		return err
+	}
+	if existingNeigh == nil {
+		zap.L().Info("Neighbour entry is already gone from interface",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.Stringer("address", ip),
+		)
+		return nil
+	}
+
+	err = link.Namespace.netlinkHandle().NeighDel(&netlink.Neigh{
+		LinkIndex: (*link).Attrs().Index,
+		Family: ipFamily(ip),
+		IP: ip,
+	})
+	if err != nil {
+		zap.L().Error("Failed to delete neighbour entry from interface",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.Stringer("address", ip),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	zap.L().Info("Deleted neighbour entry from interface",
+		zap.String("interface-name", (*link).Attrs().Name),
+		zap.Stringer("address", ip),
+	)
+
+	return nil
+}
+
+// Handles an authenticated request for setting or deleting a static neighbour entry
+func (s *Server) handleNeighbourRequest(w http.ResponseWriter, r *http.Request, requestAction string, neighbourPolicy []NeighbourPolicy) {
+	if !checkRequestMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var rd NeighbourRequestData
+	if !decodeRequestBody(w, r, requestAction, &rd) {
+		return
+	}
+
+	if rd.Address == "" {
+		zap.L().Error("Validation of request body failed: Address is missing in request",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Address (\"address\") is missing in request", nil, Response{})
+		return
+	}
+
+	if rd.InterfaceName == "" {
+		zap.L().Error("Validation of request body failed: Interface name is missing in request",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Interface name (\"interface_name\") is missing in request", nil, Response{})
+		return
+	}
+
+	ip := net.ParseIP(rd.Address)
+	if ip == nil {
+		zap.L().Error("Failed to parse ip address",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+			zap.String("address", rd.Address),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeAddressParseError, "Failed to parse ip address", fmt.Errorf("invalid ip address \"%s\"", rd.Address), Response{
+			InterfaceName: rd.InterfaceName,
+		})
+		return
+	}
+
+	// Deleting an entry doesn't depend on its state
+	var hardwareAddr net.HardwareAddr
+	var nudState int
+	state := ""
+	if requestAction == "add" {
+		if rd.HardwareAddress == "" {
+			zap.L().Error("Validation of request body failed: Hardware address is missing in request",
+				zap.String("remote-addr", r.RemoteAddr),
+				zap.String("action", requestAction),
+			)
+			writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Hardware address (\"hardware_address\") is missing in request", nil, Response{})
+			return
+		}
+
+		var err error
+		hardwareAddr, err = net.ParseMAC(rd.HardwareAddress)
+		if err != nil {
+			zap.L().Error("Validation of request body failed: Invalid hardware address",
+				zap.String("remote-addr", r.RemoteAddr),
+				zap.String("action", requestAction),
+				zap.String("hardware-address", rd.HardwareAddress),
+				zap.Error(err),
+			)
+			writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Failed to parse hardware address", err, Response{
+				Address: ip.String(),
+				InterfaceName: rd.InterfaceName,
+			})
+			return
+		}
+
+		nudState, err = ParseNeighbourState(rd.State)
+		if err != nil {
+			zap.L().Error("Validation of request body failed: Invalid neighbour state",
+				zap.String("remote-addr", r.RemoteAddr),
+				zap.String("action", requestAction),
+				zap.String("state", rd.State),
+				zap.Error(err),
+			)
+			writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Failed to parse neighbour state", err, Response{
+				Address: ip.String(),
+				InterfaceName: rd.InterfaceName,
+			})
+			return
+		}
+		state, _ = neighbourStateName(nudState)
+	}
+
+	if !neighbourPoliciesAllow(neighbourPolicy, rd.InterfaceName, ip, state) {
+		zap.L().Error("Rejected neighbour entry for interface, because no matching policy was found",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+			zap.String("address", rd.Address),
+			zap.String("state", state),
+		)
+		writeError(w, r, http.StatusForbidden, ErrorCodePolicyDenied, "Rejected neighbour entry for interface, because no matching policy was found", nil, Response{
+			Address: ip.String(),
+			InterfaceName: rd.InterfaceName,
+		})
+		return
+	}
+
+	link, err := LinkByName(rd.InterfaceName)
+	if err != nil {
+		zap.L().Error("Failed to retreive interface",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+			zap.String("interface-name", rd.InterfaceName),
+			zap.Error(err),
+		)
+		writeError(w, r, linkErrorStatus(err), linkErrorCode(err), "Failed to retreive interface", err, Response{
+			Address: ip.String(),
+			InterfaceName: rd.InterfaceName,
+		})
+		return
+	}
+
+	response := Response{
+		Address: ip.String(),
+		InterfaceName: (*link).Attrs().Name,
+		InterfaceIndex: (*link).Attrs().Index,
+	}
+
+	switch requestAction {
+	case "add":
+		response.HardwareAddress = hardwareAddr.String()
+		if err := SetNeighbour(link, ip, hardwareAddr, nudState); err != nil {
+			writeError(w, r, http.StatusInternalServerError, ErrorCodeNetlinkFailure, "Failed to set neighbour entry on interface", err, response)
+			return
+		}
+		response.Message = "Successfully set neighbour entry on interface"
+	case "delete":
+		if err := DeleteNeighbour(link, ip); err != nil {
+			writeError(w, r, http.StatusInternalServerError, ErrorCodeNetlinkFailure, "Failed to delete neighbour entry from interface", err, response)
+			return
+		}
+		response.Message = "Successfully deleted neighbour entry from interface"
+	}
+
+	writeSuccess(w, r, response)
+}
+
+// Handles an authenticated request for listing the managed neighbour entries
+func (s *Server) handleListNeighboursRequest(w http.ResponseWriter, r *http.Request, neighbourPolicy []NeighbourPolicy) {
+	if !checkRequestMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	query := r.URL.Query()
+	interfaceName := query.Get("interface_name")
+
+	family, err := ParseAddressFamily(query.Get("family"))
+	if err != nil {
+		zap.L().Error("Validation of request query failed: Invalid address family",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("family", query.Get("family")),
+			zap.Error(err),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Failed to parse address family", err, Response{})
+		return
+	}
+
+	var links []NetworkLink
+	if interfaceName != "" {
+		link, err := LinkByName(interfaceName)
+		if err != nil {
+			zap.L().Error("Failed to retreive interface",
+				zap.String("remote-addr", r.RemoteAddr),
+				zap.String("interface-name", interfaceName),
+				zap.Error(err),
+			)
+			writeError(w, r, linkErrorStatus(err), linkErrorCode(err), "Failed to retreive interface", err, Response{
+				InterfaceName: interfaceName,
+			})
+			return
+		}
+		links = []NetworkLink{link}
+	} else {
+		links, err = ListLinks()
+		if err != nil {
+			zap.L().Error("Failed to retreive interfaces",
+				zap.String("remote-addr", r.RemoteAddr),
+				zap.Error(err),
+			)
+			writeError(w, r, http.StatusInternalServerError, ErrorCodeNetlinkFailure, "Failed to retreive interfaces", err, Response{})
+			return
+		}
+	}
+
+	neighbourList := NeighbourList{Neighbours: []NeighbourInfo{}}
+	for _, link := range links {
+		neighs, err := ListNeighbours(link, family)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, ErrorCodeNetlinkFailure, "Failed to retreive neighbour entries of interface", err, Response{
+				InterfaceName: (*link).Attrs().Name,
+			})
+			return
+		}
+
+		for _, neigh := range neighs {
+			state, _ := neighbourStateName(neigh.State)
+
+			// Only show entries, that could be managed by the client
+			if !neighbourPoliciesAllow(neighbourPolicy, (*link).Attrs().Name, neigh.IP, state) {
+				continue
+			}
+
+			info := NeighbourInfo{
+				InterfaceName: (*link).Attrs().Name,
+				Address: neigh.IP.String(),
+				HardwareAddress: neigh.HardwareAddr.String(),
+				State: state,
+				Family: "ipv6",
+			}
+			if neigh.IP.To4() != nil {
+				info.Family = "ipv4"
+			}
+			neighbourList.Neighbours = append(neighbourList.Neighbours, info)
+		}
+	}
+
+	writeSuccess(w, r, Response{
+		Message: fmt.Sprintf("Found %d managed neighbour entries", len(neighbourList.Neighbours)),
+		InterfaceName: interfaceName,
+		Data: neighbourList,
+	})
+}
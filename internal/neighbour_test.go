@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestNeighbourPolicyAllows(t *testing.T) {
+	_, policyIPNetwork, err := net.ParseCIDR("198.51.100.0/24")
+	assert.NilError(t, err)
+
+	policy := NeighbourPolicy{
+		IPNetwork: IPNetwork{*policyIPNetwork},
+		InterfaceNameRegex: Regexp{*regexp.MustCompile("^eth0$")},
+	}
+
+	ip := net.ParseIP("198.51.100.1")
+	assert.Assert(t, policy.Allows("eth0", ip, "permanent"))
+	assert.Assert(t, !policy.Allows("eth0", ip, "reachable"))
+	assert.Assert(t, !policy.Allows("eth1", ip, "permanent"))
+	assert.Assert(t, !policy.Allows("eth0", net.ParseIP("192.0.2.1"), "permanent"))
+
+	// Deleting doesn't depend on the state
+	assert.Assert(t, policy.Allows("eth0", ip, ""))
+
+	policy.States = []string{"reachable", "noarp"}
+	assert.Assert(t, !policy.Allows("eth0", ip, "permanent"))
+	assert.Assert(t, policy.Allows("eth0", ip, "noarp"))
+
+	_, err = ParseNeighbourState("stale")
+	assert.ErrorContains(t, err, "invalid neighbour state")
+}
+
+func TestSetListAndDeleteNeighbour(t *testing.T) {
+	assert.Assert(t, os.Getenv("NET_LINK") != "")
+
+	_, policyIPNetwork, err := net.ParseCIDR("198.51.100.0/24")
+	assert.NilError(t, err)
+
+	server := &Server{
+		NeighbourPolicies: []NeighbourPolicy{
+			{
+				IPNetwork: IPNetwork{*policyIPNetwork},
+				InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")},
+				States: []string{"permanent", "reachable"},
+			},
+		},
+	}
+
+	rd := NeighbourRequestData{
+		Address: "198.51.100.9",
+		InterfaceName: os.Getenv("NET_LINK"),
+		HardwareAddress: "02:00:5e:00:00:09",
+	}
+
+	status, response := sendPostRequest(t, server, "/neighbours/add", rd)
+	assert.Equal(t, status, http.StatusOK, response.Message)
+	assert.Equal(t, response.HardwareAddress, "02:00:5e:00:00:09")
+
+	// Setting it again is a no-op
+	status, _ = sendPostRequest(t, server, "/neighbours/add", rd)
+	assert.Equal(t, status, http.StatusOK)
+
+	listNeighbours := func() []NeighbourInfo {
+		req, err := http.NewRequest("GET", "/neighbours?interface_name=" + os.Getenv("NET_LINK"), nil)
+		assert.NilError(t, err)
+
+		rr := httptest.NewRecorder()
+		server.handleRequest(rr, req)
+		assert.Equal(t, rr.Code, http.StatusOK)
+
+		var response struct {
+			Response
+			Data NeighbourList `json:"data"`
+		}
+		assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		return response.Data.Neighbours
+	}
+
+	neighbours := listNeighbours()
+	assert.Equal(t, len(neighbours), 1)
+	assert.Equal(t, neighbours[0].Address, "198.51.100.9")
+	assert.Equal(t, neighbours[0].HardwareAddress, "02:00:5e:00:00:09")
+	assert.Equal(t, neighbours[0].State, "permanent")
+
+	// Replacing the entry changes its hardware address
+	rd.HardwareAddress = "02:00:5e:00:00:0a"
+	status, _ = sendPostRequest(t, server, "/neighbours/add", rd)
+	assert.Equal(t, status, http.StatusOK)
+	neighbours = listNeighbours()
+	assert.Equal(t, len(neighbours), 1)
+	assert.Equal(t, neighbours[0].HardwareAddress, "02:00:5e:00:00:0a")
+
+	rd.State = "noarp"
+	status, response = sendPostRequest(t, server, "/neighbours/add", rd)
+	assert.Equal(t, status, http.StatusForbidden)
+	assert.Equal(t, response.Error.Code, ErrorCodePolicyDenied)
+
+	rd.State = "stale"
+	status, response = sendPostRequest(t, server, "/neighbours/add", rd)
+	assert.Equal(t, status, http.StatusBadRequest)
+	assert.Equal(t, response.Error.Code, ErrorCodeInvalidRequest)
+
+	rd = NeighbourRequestData{
+		Address: "198.51.100.9",
+		InterfaceName: os.Getenv("NET_LINK"),
+	}
+	status, _ = sendPostRequest(t, server, "/neighbours/delete", rd)
+	assert.Equal(t, status, http.StatusOK)
+	assert.Equal(t, len(listNeighbours()), 0)
+
+	// Deleting it again is a no-op
+	status, _ = sendPostRequest(t, server, "/neighbours/delete", rd)
+	assert.Equal(t, status, http.StatusOK)
+}
@@ -0,0 +1,245 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Result of a policy check for an address policy, that doesn't apply to the
+// client, network namespace or interface
+const PolicyCheckResultNotApplicable = "not_applicable"
+
+// Holds the data of a policy check request (the address policies are always
+// evaluated for the identity of the client)
+type PolicyCheckRequestData struct {
+	Address string `json:"address"`
+	InterfaceName string `json:"interface_name"`
+	Netns string `json:"netns"`
+}
+
+// Holds the evaluation of each criterion of an address policy for an address
+// (link is omitted for policies without link matcher)
+type PolicyCheck struct {
+	Policy string `json:"policy"`
+	Action string `json:"action"`
+	Network bool `json:"network"`
+	PrefixLength bool `json:"prefix_length"`
+	InterfaceName bool `json:"interface_name"`
+	Identity bool `json:"identity"`
+	Netns bool `json:"netns"`
+	Link *bool `json:"link,omitempty"`
+	Excluded bool `json:"excluded"`
+	Result string `json:"result"`
+}
+
+// Holds the evaluation of all address policies for an address and the final
+// decision
+type PolicyExplanation struct {
+	Identity string `json:"identity"`
+	Address string `json:"address"`
+	InterfaceName string `json:"interface_name"`
+	Netns string `json:"netns,omitempty"`
+	InterfaceFound bool `json:"interface_found"`
+	Policies []PolicyCheck `json:"policies"`
+	Decision PolicyDecision `json:"decision"`
+	Reason string `json:"reason"`
+}
+
+// Renders the explanation as plain text (one policy per line followed by the
+// decision)
+func (pe PolicyExplanation) PlainText() string {
+	var sb strings.Builder
+	for _, pc := range pe.Policies {
+		link := "-"
+		if pc.Link != nil {
+			link = yesNo(*pc.Link)
+		}
+		fmt.Fprintf(&sb, "%s %s network=%s prefix_length=%s interface_name=%s identity=%s netns=%s link=%s excluded=%s result=%s\n",
+			pc.Policy, pc.Action, yesNo(pc.Network), yesNo(pc.PrefixLength), yesNo(pc.InterfaceName), yesNo(pc.Identity), yesNo(pc.Netns), link, yesNo(pc.Excluded), pc.Result)
+	}
+	fmt.Fprintf(&sb, "decision: %s (%s)\n", pe.Decision.Outcome, pe.Reason)
+	return sb.String()
+}
+
+// Returns "yes" or "no" for a boolean
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// Returns the action of an address policy (defaults to allow)
+func (ap AddressPolicy) ActionName() string {
+	if ap.Action == "" {
+		return PolicyActionAllow
+	}
+	return ap.Action
+}
+
+// Evaluates every criterion of an address policy for an address on behalf of
+// a client identity (a nil link means the interface wasn't found)
+func (ap AddressPolicy) Check(identity ClientIdentity, netns string, interfaceName string, link NetworkLink, address CIDRAddress) PolicyCheck {
+	pc := PolicyCheck{
+		Policy: ap.DisplayName(),
+		Action: ap.ActionName(),
+		Network: ap.IPNetwork.Contains(address.IP),
+		// Deny policies match addresses regardless of their prefix length
+		PrefixLength: ap.IsDeny() || ap.IPNetwork.Mask.String() == address.Mask.String(),
+		InterfaceName: ap.InterfaceNameRegex.MatchString(interfaceName),
+		Identity: ap.AppliesTo(identity),
+		Netns: ap.AllowsNamespace(netns),
+		Excluded: !ap.IsDeny() && ap.excludes(address),
+		Result: PolicyOutcomeNoMatch,
+	}
+
+	applies := pc.Identity && pc.Netns
+	if ap.Link != nil {
+		linkMatches := link != nil && ap.Link.Matches(link)
+		pc.Link = &linkMatches
+		applies = applies && linkMatches
+	}
+
+	switch {
+	case !applies:
+		pc.Result = PolicyCheckResultNotApplicable
+	case ap.Denies(interfaceName, address):
+		pc.Result = PolicyOutcomeDenied
+	case ap.Allows(interfaceName, address):
+		pc.Result = PolicyOutcomeAllowed
+	case !ap.IsDeny() && ap.matches(interfaceName, address):
+		pc.Result = PolicyOutcomeExcluded
+	}
+
+	return pc
+}
+
+// Evaluates the address policies for an address on behalf of a client identity
+// without changing anything (a nil link means the interface wasn't found)
+func ExplainAddress(policies []AddressPolicy, identity ClientIdentity, netns string, interfaceName string, link NetworkLink, address CIDRAddress) PolicyExplanation {
+	pe := PolicyExplanation{
+		Identity: identity.String(),
+		Address: address.IPNet.String(),
+		InterfaceName: interfaceName,
+		Netns: netns,
+		InterfaceFound: link != nil,
+		Policies: []PolicyCheck{},
+	}
+
+	var applying []AddressPolicy
+	for _, p := range policies {
+		pc := p.Check(identity, netns, interfaceName, link, address)
+		pe.Policies = append(pe.Policies, pc)
+		if pc.Result != PolicyCheckResultNotApplicable {
+			applying = append(applying, p)
+		}
+	}
+
+	pe.Decision = DecideAddress(applying, interfaceName, address)
+	pe.Reason = pe.Decision.Reason()
+
+	return pe
+}
+
+// Evaluates address policies for an address on behalf of a client identity,
+// looking up the interface in the network namespace, if any policy of the
+// client allows it
+func CheckAddress(policies []AddressPolicy, identity ClientIdentity, netns string, interfaceName string, address CIDRAddress) PolicyExplanation {
+	var link NetworkLink
+
+	if len(PoliciesForNamespace(PoliciesForIdentity(policies, identity), netns)) > 0 {
+		if ns, err := OpenNamespace(netns); err == nil {
+			defer ns.Close()
+			if l, err := ns.LinkByName(interfaceName); err == nil {
+				link = l
+			}
+		}
+	}
+
+	return ExplainAddress(policies, identity, netns, interfaceName, link, address)
+}
+
+// Handles an authenticated request for checking the address policies of the
+// client for an address (policies bound to other identities aren't disclosed)
+func (s *Server) handlePolicyCheckRequest(w http.ResponseWriter, r *http.Request, policy []AddressPolicy) {
+	if !checkRequestMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var rd PolicyCheckRequestData
+	if !decodeRequestBody(w, r, "check", &rd) {
+		return
+	}
+
+	if rd.Address == "" {
+		zap.L().Error("Validation of request body failed: Address is missing in request",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "check"),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Address (\"address\") is missing in request", nil, Response{})
+		return
+	}
+
+	if rd.InterfaceName == "" {
+		zap.L().Error("Validation of request body failed: Interface name is missing in request",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "check"),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Interface name (\"interface_name\") is missing in request", nil, Response{})
+		return
+	}
+
+	address, err := ParseAddress(rd.Address)
+	if err != nil {
+		zap.L().Error("Failed to parse cidr address",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "check"),
+			zap.String("address", rd.Address),
+			zap.Error(err),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeAddressParseError, "Failed to parse cidr address", err, Response{
+			InterfaceName: rd.InterfaceName,
+		})
+		return
+	}
+
+	identity := requestIdentity(r)
+	explanation := CheckAddress(policy, identity, rd.Netns, rd.InterfaceName, address)
+
+	zap.L().Info("Checked address policies for cidr address",
+		zap.String("remote-addr", r.RemoteAddr),
+		zap.Stringer("identity", identity),
+		zap.String("interface-name", rd.InterfaceName),
+		zap.String("address", address.IPNet.String()),
+		zap.String("outcome", explanation.Decision.Outcome),
+	)
+
+	writeSuccess(w, r, Response{
+		Message: "Checked address policies: " + explanation.Reason,
+		Address: address.IPNet.String(),
+		InterfaceName: rd.InterfaceName,
+		Netns: rd.Netns,
+		Data: explanation,
+	})
+}
+
+// Reads the configuration and evaluates all of its address policies for an
+// address on behalf of any client identity
+func CheckPolicies(configFilePath string, identity ClientIdentity, netns string, interfaceName string, rawAddress string) (*PolicyExplanation, error) {
+	config, err := ReadConfiguration(configFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	address, err := ParseAddress(rawAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	explanation := CheckAddress(config.AddressPolicies, identity, netns, interfaceName, address)
+
+	return &explanation, nil
+}
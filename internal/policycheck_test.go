@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"net"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestExplainAddress(t *testing.T) {
+	_, teamIPNetwork, err := net.ParseCIDR("198.51.100.0/24")
+	assert.NilError(t, err)
+	_, excludedIPNetwork, err := net.ParseCIDR("198.51.100.0/28")
+	assert.NilError(t, err)
+	_, gatewayIPNetwork, err := net.ParseCIDR("198.51.100.1/32")
+	assert.NilError(t, err)
+
+	policies := []AddressPolicy{
+		{
+			Name: "gateway",
+			Action: PolicyActionDeny,
+			IPNetwork: IPNetwork{*gatewayIPNetwork},
+			InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")},
+		},
+		{
+			Name: "team-a",
+			IPNetwork: IPNetwork{*teamIPNetwork},
+			ExcludedNetworks: []IPNetwork{{*excludedIPNetwork}},
+			InterfaceNameRegex: Regexp{*regexp.MustCompile("^team-a-")},
+			Identities: []IdentityMatcher{ParseIdentityMatcher("cn:team-a")},
+		},
+	}
+
+	identity := ClientIdentity{CommonName: "team-a"}
+
+	address, err := ParseAddress("198.51.100.20/24")
+	assert.NilError(t, err)
+	pe := ExplainAddress(policies, identity, "", "team-a-0", nil, address)
+	assert.Equal(t, pe.Identity, "cn:team-a")
+	assert.Equal(t, len(pe.Policies), 2)
+	assert.Equal(t, pe.Policies[0].Result, PolicyOutcomeNoMatch)
+	assert.Assert(t, !pe.Policies[0].Network)
+	assert.Equal(t, pe.Policies[1].Result, PolicyOutcomeAllowed)
+	assert.DeepEqual(t, pe.Decision, PolicyDecision{true, PolicyOutcomeAllowed, "team-a"})
+
+	// Every failing criterion is reported
+	address, err = ParseAddress("198.51.100.20/25")
+	assert.NilError(t, err)
+	pe = ExplainAddress(policies, ClientIdentity{CommonName: "team-b"}, "", "team-b-0", nil, address)
+	assert.DeepEqual(t, pe.Policies[1], PolicyCheck{
+		Policy: "team-a",
+		Action: PolicyActionAllow,
+		Network: true,
+		PrefixLength: false,
+		InterfaceName: false,
+		Identity: false,
+		Netns: true,
+		Result: PolicyCheckResultNotApplicable,
+	})
+	assert.Equal(t, pe.Decision.Outcome, PolicyOutcomeNoMatch)
+	assert.Equal(t, pe.Reason, "no matching policy was found")
+
+	address, err = ParseAddress("198.51.100.5/24")
+	assert.NilError(t, err)
+	pe = ExplainAddress(policies, identity, "", "team-a-0", nil, address)
+	assert.Assert(t, pe.Policies[1].Excluded)
+	assert.Equal(t, pe.Policies[1].Result, PolicyOutcomeExcluded)
+	assert.Equal(t, pe.Decision.Outcome, PolicyOutcomeExcluded)
+
+	address, err = ParseAddress("198.51.100.1/24")
+	assert.NilError(t, err)
+	pe = ExplainAddress(policies, identity, "", "team-a-0", nil, address)
+	assert.Assert(t, pe.Policies[0].PrefixLength)
+	assert.Equal(t, pe.Policies[0].Result, PolicyOutcomeDenied)
+	assert.Equal(t, pe.Reason, "it's denied by policy \"gateway\"")
+
+	// Policies matching link attributes don't apply to missing interfaces
+	policies[1].Link = &LinkMatcher{Types: []string{"dummy"}}
+	address, err = ParseAddress("198.51.100.20/24")
+	assert.NilError(t, err)
+	pe = ExplainAddress(policies, identity, "", "team-a-0", nil, address)
+	assert.Assert(t, !pe.InterfaceFound)
+	assert.Assert(t, pe.Policies[1].Link != nil && !*pe.Policies[1].Link)
+	assert.Equal(t, pe.Policies[1].Result, PolicyCheckResultNotApplicable)
+	assert.Assert(t, !pe.Decision.Allowed)
+}
+
+func TestPolicyCheckRequest(t *testing.T) {
+	_, policyIPNetwork, err := net.ParseCIDR("198.51.100.0/24")
+	assert.NilError(t, err)
+
+	server := &Server{
+		AddressPolicies: []AddressPolicy{
+			{
+				Name: "team-a",
+				IPNetwork: IPNetwork{*policyIPNetwork},
+				InterfaceNameRegex: Regexp{*regexp.MustCompile("^lo$")},
+				Identities: []IdentityMatcher{ParseIdentityMatcher("cn:team-a")},
+			},
+			{
+				Name: "team-b",
+				IPNetwork: IPNetwork{*policyIPNetwork},
+				InterfaceNameRegex: Regexp{*regexp.MustCompile("^lo$")},
+				Identities: []IdentityMatcher{ParseIdentityMatcher("cn:team-b")},
+			},
+		},
+	}
+
+	status, response := sendPostRequest(t, server, "/policy/check", PolicyCheckRequestData{
+		Address: "198.51.100.7/24",
+		InterfaceName: "lo",
+	}, withClientCertificate(testClientCertificate(t)))
+	assert.Equal(t, status, http.StatusOK, response.Message)
+	assert.Equal(t, response.Message, "Checked address policies: it's allowed by policy \"team-a\"")
+
+	var pe PolicyExplanation
+	decodeResponseData(t, response, &pe)
+	assert.Equal(t, pe.Identity, "cn:team-a")
+	assert.Assert(t, pe.InterfaceFound)
+	assert.Assert(t, pe.Decision.Allowed)
+
+	// Policies of other identities aren't disclosed
+	assert.Equal(t, len(pe.Policies), 1)
+	assert.Equal(t, pe.Policies[0].Policy, "team-a")
+
+	// Another identity can't be checked on behalf of the client (none without certificate)
+	status, response = sendPostRequest(t, server, "/policy/check", map[string]interface{}{
+		"identity": map[string]string{"common_name": "team-a"},
+		"address": "198.51.100.7/24",
+		"interface_name": "lo",
+	})
+	assert.Equal(t, status, http.StatusOK)
+	assert.Equal(t, response.Message, "Checked address policies: no matching policy was found")
+
+	// Nothing is changed
+	link, err := LinkByName("lo")
+	assert.NilError(t, err)
+	assertAddressExists(t, link, "198.51.100.7/24", false)
+
+	status, response = sendPostRequest(t, server, "/policy/check", PolicyCheckRequestData{
+		Address: "198.51.100.7/24",
+	})
+	assert.Equal(t, status, http.StatusBadRequest)
+	assert.Equal(t, response.Error.Code, ErrorCodeInvalidRequest)
+}
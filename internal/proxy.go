@@ -0,0 +1,406 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+)
+
+// Holds the request data of a proxy neighbour operation
+type ProxyRequestData struct {
+	Address string `json:"address"`
+	InterfaceName string `json:"interface_name"`
+}
+
+// Holds information about a proxy neighbour entry of a network link
+type ProxyEntryInfo struct {
+	InterfaceName string `json:"interface_name"`
+	Address string `json:"address"`
+	Family string `json:"family"`
+}
+
+// Holds the list of proxy neighbour entries returned by a list request
+type ProxyEntryList struct {
+	Entries []ProxyEntryInfo `json:"entries"`
+}
+
+// Renders the proxy neighbour entry list as plain text (one entry per line)
+func (pl ProxyEntryList) PlainText() string {
+	var sb strings.Builder
+	for _, e := range pl.Entries {
+		fmt.Fprintf(&sb, "%s %s\n", e.InterfaceName, e.Address)
+	}
+	return sb.String()
+}
+
+// Parses the ip address of a proxy neighbour entry as host address (which is
+// what advertisements are built from)
+func ParseProxyAddress(address string) (CIDRAddress, error) {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid ip address \"%s\"", address)
+	}
+
+	if ip.To4() != nil {
+		return ParseAddress(ip.String() + "/32")
+	}
+	return ParseAddress(ip.String() + "/128")
+}
+
+// Checks whether a proxy policy applies to a client identity (a policy
+// without identities applies to every client)
+func (pp ProxyPolicy) AppliesTo(identity ClientIdentity) bool {
+	return matchesAnyIdentity(pp.Identities, identity)
+}
+
+// Checks whether a proxy neighbour entry for an ip address on an interface is
+// allowed by a proxy policy
+func (pp ProxyPolicy) Allows(interfaceName string, ip net.IP) bool {
+	return pp.InterfaceNameRegex.MatchString(interfaceName) && pp.IPNetwork.Contains(ip)
+}
+
+// Returns the proxy policies, that apply to a client identity
+func ProxyPoliciesForIdentity(policies []ProxyPolicy, identity ClientIdentity) []ProxyPolicy {
+	var identityPolicies []ProxyPolicy
+	for _, p := range policies {
+		if p.AppliesTo(identity) {
+			identityPolicies = append(identityPolicies, p)
+		}
+	}
+	return identityPolicies
+}
+
+// Checks whether any of the proxy policies allows a proxy neighbour entry for
+// an ip address on an interface
+func proxyPoliciesAllow(policy []ProxyPolicy, interfaceName string, ip net.IP) bool {
+	for _, p := range policy {
+		if p.Allows(interfaceName, ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the advertisement settings of the first proxy policy allowing an
+// interface name and ip address
+func proxyAdvertisementFor(policies []ProxyPolicy, interfaceName string, ip net.IP) Advertisement {
+	for _, p := range policies {
+		if p.Allows(interfaceName, ip) {
+			return p.Advertisement
+		}
+	}
+	return Advertisement{}
+}
+
+// Returns the ip addresses of the proxy neighbour entries of a network link
+func ListProxyEntries(link NetworkLink, family int) ([]net.IP, error) {
+	entries, err := link.Namespace.netlinkHandle().NeighProxyList((*link).Attrs().Index, family)
+	if err != nil {
+		zap.L().Error("Error while retreiving proxy neighbour entries of interface",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	ips := make([]net.IP, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Flags & netlink.NTF_PROXY != 0 {
+			ips = append(ips, entry.IP)
+		}
+	}
+
+	return ips, nil
+}
+
+// Checks whether a proxy neighbour entry for an ip address exists on a network link
+func ProxyEntryExists(link NetworkLink, ip net.IP) (bool, error) {
+	ips, err := ListProxyEntries(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return false, err
+	}
+
+	for _, existingIP := range ips {
+		if existingIP.Equal(ip) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Returns the proxy neighbour entry of an ip address on a network link
+func proxyNeigh(link NetworkLink, ip net.IP) *netlink.Neigh {
+	family := netlink.FAMILY_V6
+	if ip.To4() != nil {
+		family = netlink.FAMILY_V4
+	}
+
+	return &netlink.Neigh{
+		LinkIndex: (*link).Attrs().Index,
+		Family: family,
+		Flags: netlink.NTF_PROXY,
+		IP: ip,
+	}
+}
+
+// Adds a proxy neighbour entry for a host address to a network link, so the
+// kernel answers ARP and neighbour solicitations for it, and advertises it
+func AddProxyEntry(link NetworkLink, address CIDRAddress, advertisement Advertisement) error {
+	entryExists, err := ProxyEntryExists(link, address.IP)
+	if err != nil {
+		return err
+	}
+	if entryExists {
+		zap.L().Info("Proxy neighbour entry already exists on interface",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.Stringer("address", address.IP),
+		)
+		return nil
+	}
+
+	err = link.Namespace.netlinkHandle().NeighAdd(proxyNeigh(link, address.IP))
+	if err != nil {
+		zap.L().Error("Failed to add proxy neighbour entry to interface",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.Stringer("address", address.IP),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	zap.L().Info("Added proxy neighbour entry to interface",
+		zap.String("interface-name", (*link).Attrs().Name),
+		zap.Stringer("address", address.IP),
+	)
+
+	return AnnounceAddress(link, address, advertisement)
+}
+
+// Removes a proxy neighbour entry for an ip address from a network link
+func DeleteProxyEntry(link NetworkLink, ip net.IP) error {
+	entryExists, err := ProxyEntryExists(link, ip)
+	if err != nil {
+		return err
+	}
+	if !entryExists {
+		zap.L().Info("Proxy neighbour entry is already gone from interface",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.Stringer("address", ip),
+		)
+		return nil
+	}
+
+	err = link.Namespace.netlinkHandle().NeighDel(proxyNeigh(link, ip))
+	if err != nil {
+		zap.L().Error("Failed to delete proxy neighbour entry from interface",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.Stringer("address", ip),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	zap.L().Info("Deleted proxy neighbour entry from interface",
+		zap.String("interface-name", (*link).Attrs().Name),
+		zap.Stringer("address", ip),
+	)
+
+	return nil
+}
+
+// Handles an authenticated request for adding or deleting a proxy neighbour entry
+func (s *Server) handleProxyRequest(w http.ResponseWriter, r *http.Request, requestAction string, proxyPolicy []ProxyPolicy) {
+	if !checkRequestMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var rd ProxyRequestData
+	if !decodeRequestBody(w, r, requestAction, &rd) {
+		return
+	}
+
+	if rd.Address == "" {
+		zap.L().Error("Validation of request body failed: Address is missing in request",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Address (\"address\") is missing in request", nil, Response{})
+		return
+	}
+
+	if rd.InterfaceName == "" {
+		zap.L().Error("Validation of request body failed: Interface name is missing in request",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Interface name (\"interface_name\") is missing in request", nil, Response{})
+		return
+	}
+
+	address, err := ParseProxyAddress(rd.Address)
+	if err != nil {
+		zap.L().Error("Failed to parse ip address",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+			zap.String("address", rd.Address),
+			zap.Error(err),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeAddressParseError, "Failed to parse ip address", err, Response{
+			InterfaceName: rd.InterfaceName,
+		})
+		return
+	}
+
+	if !proxyPoliciesAllow(proxyPolicy, rd.InterfaceName, address.IP) {
+		zap.L().Error("Rejected proxy neighbour entry for interface, because no matching policy was found",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+			zap.String("address", rd.Address),
+		)
+		writeError(w, r, http.StatusForbidden, ErrorCodePolicyDenied, "Rejected proxy neighbour entry for interface, because no matching policy was found", nil, Response{
+			Address: address.IP.String(),
+			InterfaceName: rd.InterfaceName,
+		})
+		return
+	}
+
+	link, err := LinkByName(rd.InterfaceName)
+	if err != nil {
+		zap.L().Error("Failed to retreive interface",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+			zap.String("interface-name", rd.InterfaceName),
+			zap.Error(err),
+		)
+		writeError(w, r, linkErrorStatus(err), linkErrorCode(err), "Failed to retreive interface", err, Response{
+			Address: address.IP.String(),
+			InterfaceName: rd.InterfaceName,
+		})
+		return
+	}
+
+	response := Response{
+		Address: address.IP.String(),
+		InterfaceName: (*link).Attrs().Name,
+		InterfaceIndex: (*link).Attrs().Index,
+	}
+
+	switch requestAction {
+	case "add":
+		advertisement := proxyAdvertisementFor(proxyPolicy, rd.InterfaceName, address.IP)
+		err := AddProxyEntry(link, address, advertisement)
+		// The entry is in place, even if it couldn't be advertised
+		var advertiseError *AdvertiseError
+		if errors.As(err, &advertiseError) {
+			zap.L().Warn("Added proxy neighbour entry to interface, but failed to advertise it",
+				zap.String("remote-addr", r.RemoteAddr),
+				zap.String("interface-name", rd.InterfaceName),
+				zap.Stringer("address", address.IP),
+				zap.Error(err),
+			)
+			response.Message = "Successfully added proxy neighbour entry to interface, but failed to advertise it"
+			break
+		}
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, addressErrorCode(err), "Failed to add proxy neighbour entry to interface", err, response)
+			return
+		}
+		response.Message = "Successfully added proxy neighbour entry to interface"
+	case "delete":
+		if err := DeleteProxyEntry(link, address.IP); err != nil {
+			writeError(w, r, http.StatusInternalServerError, ErrorCodeNetlinkFailure, "Failed to delete proxy neighbour entry from interface", err, response)
+			return
+		}
+		response.Message = "Successfully deleted proxy neighbour entry from interface"
+	}
+
+	writeSuccess(w, r, response)
+}
+
+// Handles an authenticated request for listing the managed proxy neighbour entries
+func (s *Server) handleListProxyEntriesRequest(w http.ResponseWriter, r *http.Request, proxyPolicy []ProxyPolicy) {
+	if !checkRequestMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	query := r.URL.Query()
+	interfaceName := query.Get("interface_name")
+
+	family, err := ParseAddressFamily(query.Get("family"))
+	if err != nil {
+		zap.L().Error("Validation of request query failed: Invalid address family",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("family", query.Get("family")),
+			zap.Error(err),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Failed to parse address family", err, Response{})
+		return
+	}
+
+	var links []NetworkLink
+	if interfaceName != "" {
+		link, err := LinkByName(interfaceName)
+		if err != nil {
+			zap.L().Error("Failed to retreive interface",
+				zap.String("remote-addr", r.RemoteAddr),
+				zap.String("interface-name", interfaceName),
+				zap.Error(err),
+			)
+			writeError(w, r, linkErrorStatus(err), linkErrorCode(err), "Failed to retreive interface", err, Response{
+				InterfaceName: interfaceName,
+			})
+			return
+		}
+		links = []NetworkLink{link}
+	} else {
+		links, err = ListLinks()
+		if err != nil {
+			zap.L().Error("Failed to retreive interfaces",
+				zap.String("remote-addr", r.RemoteAddr),
+				zap.Error(err),
+			)
+			writeError(w, r, http.StatusInternalServerError, ErrorCodeNetlinkFailure, "Failed to retreive interfaces", err, Response{})
+			return
+		}
+	}
+
+	entryList := ProxyEntryList{Entries: []ProxyEntryInfo{}}
+	for _, link := range links {
+		ips, err := ListProxyEntries(link, family)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, ErrorCodeNetlinkFailure, "Failed to retreive proxy neighbour entries of interface", err, Response{
+				InterfaceName: (*link).Attrs().Name,
+			})
+			return
+		}
+
+		for _, ip := range ips {
+			// Only show entries, that could be managed by the client
+			if !proxyPoliciesAllow(proxyPolicy, (*link).Attrs().Name, ip) {
+				continue
+			}
+
+			info := ProxyEntryInfo{
+				InterfaceName: (*link).Attrs().Name,
+				Address: ip.String(),
+				Family: "ipv6",
+			}
+			if ip.To4() != nil {
+				info.Family = "ipv4"
+			}
+			entryList.Entries = append(entryList.Entries, info)
+		}
+	}
+
+	writeSuccess(w, r, Response{
+		Message: fmt.Sprintf("Found %d managed proxy neighbour entries", len(entryList.Entries)),
+		InterfaceName: interfaceName,
+		Data: entryList,
+	})
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"gotest.tools/assert"
+)
+
+func TestParseProxyAddress(t *testing.T) {
+	address, err := ParseProxyAddress("198.51.100.7")
+	assert.NilError(t, err)
+	assert.Equal(t, address.String(), "198.51.100.7/32")
+
+	address, err = ParseProxyAddress("fd69:decd:7b66:8220::7")
+	assert.NilError(t, err)
+	assert.Equal(t, address.String(), "fd69:decd:7b66:8220::7/128")
+
+	_, err = ParseProxyAddress("198.51.100.7/24")
+	assert.ErrorContains(t, err, "invalid ip address")
+}
+
+func TestAddListAndDeleteProxyEntry(t *testing.T) {
+	assert.Assert(t, os.Getenv("NET_LINK") != "")
+
+	_, policyIPNetwork, err := net.ParseCIDR("198.51.100.0/24")
+	assert.NilError(t, err)
+
+	server := &Server{
+		ProxyPolicies: []ProxyPolicy{
+			{
+				IPNetwork: IPNetwork{*policyIPNetwork},
+				InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")},
+			},
+		},
+	}
+
+	rd := ProxyRequestData{
+		Address: "198.51.100.7",
+		InterfaceName: os.Getenv("NET_LINK"),
+	}
+
+	status, response := sendPostRequest(t, server, "/proxy/add", rd)
+	assert.Equal(t, status, http.StatusOK, response.Message)
+
+	// Adding it again is a no-op
+	status, _ = sendPostRequest(t, server, "/proxy/add", rd)
+	assert.Equal(t, status, http.StatusOK)
+
+	listProxyEntries := func() []ProxyEntryInfo {
+		req, err := http.NewRequest("GET", "/proxy?interface_name=" + os.Getenv("NET_LINK"), nil)
+		assert.NilError(t, err)
+
+		rr := httptest.NewRecorder()
+		server.handleRequest(rr, req)
+		assert.Equal(t, rr.Code, http.StatusOK)
+
+		var response struct {
+			Response
+			Data ProxyEntryList `json:"data"`
+		}
+		assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		return response.Data.Entries
+	}
+
+	entries := listProxyEntries()
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].Address, "198.51.100.7")
+	assert.Equal(t, entries[0].Family, "ipv4")
+
+	// The address isn't configured on the interface
+	link, err := LinkByName(os.Getenv("NET_LINK"))
+	assert.NilError(t, err)
+	assertAddressExists(t, link, "198.51.100.7/32", false)
+
+	status, response = sendPostRequest(t, server, "/proxy/add", ProxyRequestData{
+		Address: "192.0.2.7",
+		InterfaceName: os.Getenv("NET_LINK"),
+	})
+	assert.Equal(t, status, http.StatusForbidden)
+	assert.Equal(t, response.Error.Code, ErrorCodePolicyDenied)
+
+	status, _ = sendPostRequest(t, server, "/proxy/delete", rd)
+	assert.Equal(t, status, http.StatusOK)
+	assert.Equal(t, len(listProxyEntries()), 0)
+
+	// Deleting it again is a no-op
+	status, _ = sendPostRequest(t, server, "/proxy/delete", rd)
+	assert.Equal(t, status, http.StatusOK)
+}
+
+func TestAddProxyEntryFailingAdvertisement(t *testing.T) {
+	// Advertisements can't be sent on an interface, that is down
+	veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "ipam-proxy0"}, PeerName: "ipam-proxy1"}
+	assert.NilError(t, netlink.LinkAdd(veth))
+	defer netlink.LinkDel(veth)
+
+	_, policyIPNetwork, err := net.ParseCIDR("198.51.100.0/24")
+	assert.NilError(t, err)
+
+	server := &Server{
+		ProxyPolicies: []ProxyPolicy{
+			{
+				IPNetwork: IPNetwork{*policyIPNetwork},
+				InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")},
+			},
+		},
+	}
+
+	status, response := sendPostRequest(t, server, "/proxy/add", ProxyRequestData{
+		Address: "198.51.100.8",
+		InterfaceName: "ipam-proxy0",
+	})
+	assert.Equal(t, status, http.StatusOK, response.Message)
+	assert.Equal(t, response.Message, "Successfully added proxy neighbour entry to interface, but failed to advertise it")
+
+	link, err := LinkByName("ipam-proxy0")
+	assert.NilError(t, err)
+	entryExists, err := ProxyEntryExists(link, net.ParseIP("198.51.100.8"))
+	assert.NilError(t, err)
+	assert.Assert(t, entryExists)
+}
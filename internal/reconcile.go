@@ -0,0 +1,212 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+)
+
+// Holds the request data of a desired state of an interface
+type DesiredStateRequestData struct {
+	InterfaceName string `json:"interface_name"`
+	Addresses []string `json:"addresses"`
+	DryRun bool `json:"dry_run"`
+}
+
+// Holds the outcome of a reconciliation of an interface
+type ReconcileResult struct {
+	BatchResult
+	DryRun bool `json:"dry_run"`
+	Unchanged []string `json:"unchanged"`
+}
+
+// Computes the operations, that converge the addresses of a network link within
+// the scope of the address policies to the desired addresses
+func planReconciliation(link NetworkLink, desiredAddresses []CIDRAddress, policy []AddressPolicy) ([]*resolvedOperation, []string, error) {
+	existingAddresses, err := ListAddresses(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var operations []*resolvedOperation
+	unchanged := []string{}
+
+	// Remove addresses in the scope of the policies, that are not desired
+	for _, existingAddress := range existingAddresses {
+		if !policiesAllow(policy, (*link).Attrs().Name, existingAddress) {
+			continue
+		}
+
+		desired := false
+		for _, desiredAddress := range desiredAddresses {
+			if existingAddress.Equal(*desiredAddress) {
+				desired = true
+				break
+			}
+		}
+
+		if desired {
+			unchanged = append(unchanged, existingAddress.IPNet.String())
+		} else {
+			operations = append(operations, &resolvedOperation{action: "delete", link: link, address: existingAddress, policy: policy})
+		}
+	}
+
+	// Add desired addresses, that are missing
+	for _, desiredAddress := range desiredAddresses {
+		exists := false
+		for _, existingAddress := range existingAddresses {
+			if existingAddress.Equal(*desiredAddress) {
+				exists = true
+				break
+			}
+		}
+
+		if !exists {
+			operations = append(operations, &resolvedOperation{action: "add", link: link, address: desiredAddress, policy: policy})
+		}
+	}
+
+	return operations, unchanged, nil
+}
+
+// Handles an authenticated request for converging an interface to a desired state
+func (s *Server) handleDesiredStateRequest(w http.ResponseWriter, r *http.Request, policy []AddressPolicy) {
+	if !checkRequestMethod(w, r, http.MethodPut) {
+		return
+	}
+
+	var rd DesiredStateRequestData
+	if !decodeRequestBody(w, r, "reconcile", &rd) {
+		return
+	}
+
+	if rd.InterfaceName == "" {
+		zap.L().Error("Validation of request body failed: Interface name is missing in request",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "reconcile"),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Interface name (\"interface_name\") is missing in request", nil, Response{})
+		return
+	}
+
+	if rd.Addresses == nil {
+		zap.L().Error("Validation of request body failed: Addresses are missing in request",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "reconcile"),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Addresses (\"addresses\") are missing in request", nil, Response{
+			InterfaceName: rd.InterfaceName,
+		})
+		return
+	}
+
+	desiredAddresses := make([]CIDRAddress, len(rd.Addresses))
+	for i, a := range rd.Addresses {
+		address, err := ParseAddress(a)
+		if err != nil {
+			zap.L().Error("Failed to parse cidr address",
+				zap.String("remote-addr", r.RemoteAddr),
+				zap.String("action", "reconcile"),
+				zap.String("address", a),
+				zap.Error(err),
+			)
+			writeError(w, r, http.StatusBadRequest, ErrorCodeAddressParseError, "Failed to parse cidr address", err, Response{
+				Address: a,
+				InterfaceName: rd.InterfaceName,
+			})
+			return
+		}
+
+		if decision := checkAddressPolicies(r, "reconcile", policiesBeforeLink(policy), rd.InterfaceName, address); !decision.Allowed {
+			writeError(w, r, http.StatusForbidden, ErrorCodePolicyDenied, "Rejected cidr address for interface, because " + decision.Reason(), nil, Response{
+				Address: address.IPNet.String(),
+				InterfaceName: rd.InterfaceName,
+			})
+			return
+		}
+
+		desiredAddresses[i] = address
+	}
+
+	link, err := LinkByName(rd.InterfaceName)
+	if err != nil {
+		zap.L().Error("Failed to retreive interface",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", "reconcile"),
+			zap.String("interface-name", rd.InterfaceName),
+			zap.Error(err),
+		)
+		writeError(w, r, linkErrorStatus(err), linkErrorCode(err), "Failed to retreive interface", err, Response{
+			InterfaceName: rd.InterfaceName,
+		})
+		return
+	}
+
+	response := Response{
+		InterfaceName: (*link).Attrs().Name,
+		InterfaceIndex: (*link).Attrs().Index,
+	}
+
+	// Policies, that don't match the interface, neither allow keeping nor
+	// removing any of its addresses (even if no address is desired)
+	if hasLinkMatchers(policy) {
+		policy = PoliciesForLink(policy, link)
+		for _, address := range desiredAddresses {
+			if decision := checkAddressPolicies(r, "reconcile", policy, (*link).Attrs().Name, address); !decision.Allowed {
+				writeError(w, r, http.StatusForbidden, ErrorCodePolicyDenied, "Rejected cidr address for interface, because " + decision.Reason(), nil, Response{
+					Address: address.IPNet.String(),
+					InterfaceName: (*link).Attrs().Name,
+					InterfaceIndex: (*link).Attrs().Index,
+				})
+				return
+			}
+		}
+	}
+
+	operations, unchanged, err := planReconciliation(link, desiredAddresses, policy)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, ErrorCodeNetlinkFailure, "Failed to retreive addresses of interface", err, response)
+		return
+	}
+
+	result := ReconcileResult{
+		BatchResult: BatchResult{Operations: make([]OperationResult, len(operations))},
+		DryRun: rd.DryRun,
+		Unchanged: unchanged,
+	}
+	for i, operation := range operations {
+		result.Operations[i] = OperationResult{
+			Index: i,
+			Action: operation.action,
+			Address: operation.address.IPNet.String(),
+			InterfaceName: (*link).Attrs().Name,
+			Status: OperationStatusPlanned,
+		}
+	}
+	response.Data = result
+
+	if rd.DryRun {
+		response.Message = fmt.Sprintf("Planned %d operations to converge interface", len(operations))
+		writeSuccess(w, r, response)
+		return
+	}
+
+	if i, err := s.applyOperations(r, operations, &result.BatchResult); err != nil {
+		response.Data = result
+		writeError(w, r, addressErrorStatus(err), addressErrorCode(err), fmt.Sprintf("Failed to apply operation %d of reconciliation, the reconciliation was rolled back", i), err, response)
+		return
+	}
+
+	zap.L().Info("Converged interface to desired state",
+		zap.String("remote-addr", r.RemoteAddr),
+		zap.String("interface-name", rd.InterfaceName),
+		zap.Int("operations", len(operations)),
+	)
+
+	response.Message = fmt.Sprintf("Successfully applied %d operations to converge interface", len(operations))
+	response.Data = result
+	writeSuccess(w, r, response)
+}
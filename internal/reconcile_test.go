@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func sendDesiredStateRequest(t *testing.T, policies []AddressPolicy, rd DesiredStateRequestData) (int, ReconcileResult) {
+	status, response := sendPostRequest(t, &Server{AddressPolicies: policies}, "/addresses", rd, withMethod("PUT"))
+
+	var result ReconcileResult
+	decodeResponseData(t, response, &result)
+
+	return status, result
+}
+
+func assertAddressExists(t *testing.T, link NetworkLink, a string, exists bool) {
+	address, err := ParseAddress(a)
+	assert.NilError(t, err)
+
+	addressExists, err := AddressExists(link, address)
+	assert.NilError(t, err)
+	assert.Equal(t, addressExists, exists, a)
+}
+
+func TestDesiredStateWithPolicyMismatch(t *testing.T) {
+	_, policyIPNetwork, err := net.ParseCIDR("192.0.2.0/24")
+	assert.NilError(t, err)
+
+	policies := []AddressPolicy{
+		AddressPolicy{IPNetwork: IPNetwork{*policyIPNetwork}, InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")}},
+	}
+
+	code, _ := sendDesiredStateRequest(t, policies, DesiredStateRequestData{
+		InterfaceName: "lo",
+		Addresses: []string{"198.51.100.1/24"},
+	})
+	assert.Equal(t, code, http.StatusForbidden)
+}
+
+func TestDesiredStateReconciliation(t *testing.T) {
+	assert.Assert(t, os.Getenv("NET_LINK") != "")
+
+	link, err := LinkByName(os.Getenv("NET_LINK"))
+	assert.NilError(t, err)
+
+	for _, a := range []string{"192.0.2.1/24", "192.0.2.2/24", "198.51.100.1/24"} {
+		address, err := ParseAddress(a)
+		assert.NilError(t, err)
+		assert.NilError(t, AddAddress(link, address, Advertisement{}))
+	}
+
+	_, policyIPNetwork, err := net.ParseCIDR("192.0.2.0/24")
+	assert.NilError(t, err)
+
+	policies := []AddressPolicy{
+		AddressPolicy{IPNetwork: IPNetwork{*policyIPNetwork}, InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")}},
+	}
+
+	rd := DesiredStateRequestData{
+		InterfaceName: os.Getenv("NET_LINK"),
+		Addresses: []string{"192.0.2.1/24", "192.0.2.3/24"},
+		DryRun: true,
+	}
+
+	code, result := sendDesiredStateRequest(t, policies, rd)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, result.DryRun, true)
+	assert.DeepEqual(t, result.Unchanged, []string{"192.0.2.1/24"})
+	assert.Equal(t, len(result.Operations), 2)
+	assert.Equal(t, result.Operations[0].Action, "delete")
+	assert.Equal(t, result.Operations[0].Address, "192.0.2.2/24")
+	assert.Equal(t, result.Operations[0].Status, OperationStatusPlanned)
+	assert.Equal(t, result.Operations[1].Action, "add")
+	assert.Equal(t, result.Operations[1].Address, "192.0.2.3/24")
+	assertAddressExists(t, link, "192.0.2.2/24", true)
+	assertAddressExists(t, link, "192.0.2.3/24", false)
+
+	rd.DryRun = false
+	code, result = sendDesiredStateRequest(t, policies, rd)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, result.Operations[0].Status, OperationStatusApplied)
+	assert.Equal(t, result.Operations[1].Status, OperationStatusApplied)
+	assertAddressExists(t, link, "192.0.2.1/24", true)
+	assertAddressExists(t, link, "192.0.2.2/24", false)
+	assertAddressExists(t, link, "192.0.2.3/24", true)
+	assertAddressExists(t, link, "198.51.100.1/24", true)
+
+	rd.Addresses = []string{}
+	code, result = sendDesiredStateRequest(t, policies, rd)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, len(result.Operations), 2)
+	assertAddressExists(t, link, "192.0.2.1/24", false)
+	assertAddressExists(t, link, "192.0.2.3/24", false)
+	assertAddressExists(t, link, "198.51.100.1/24", true)
+
+	address, err := ParseAddress("198.51.100.1/24")
+	assert.NilError(t, err)
+	assert.NilError(t, DeleteAddress(link, address))
+}
@@ -0,0 +1,199 @@
+package internal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Interval between checks of the configuration files for changes
+const reloadPollInterval = 2 * time.Second
+
+// Reads the server certificate and the client ca certificate pool of a
+// configuration
+func loadTLSMaterial(config *Config) (*tls.Certificate, *x509.CertPool, error) {
+	certificate, err := tls.LoadX509KeyPair(config.ServerCertificatePath, config.ServerKeyPath)
+	if err != nil {
+		zap.L().Error("Failed to read server certificate",
+			zap.String("certificate-path", config.ServerCertificatePath),
+			zap.String("key-path", config.ServerKeyPath),
+			zap.Error(err),
+		)
+		return nil, nil, err
+	}
+
+	clientCACertificatePool, err := buildClientCACertificatPool(config.ClientCACertificatePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &certificate, clientCACertificatePool, nil
+}
+
+// Swaps in the policies, TLS material and revocation checker of a configuration
+// (keeping the cached OCSP answers, if the OCSP configuration is unchanged)
+func (s *Server) applyConfiguration(config *Config, certificate *tls.Certificate, clientCACertificatePool *x509.CertPool, revocation *RevocationChecker) {
+	s.configMutex.Lock()
+	// The responder would be queried again for every client otherwise
+	revocation.adoptOCSPCache(s.revocation)
+	s.config = config
+	s.AddressPolicies = config.AddressPolicies
+	s.RoutePolicies = config.RoutePolicies
+	s.ProxyPolicies = config.ProxyPolicies
+	s.NeighbourPolicies = config.NeighbourPolicies
+	s.certificate = certificate
+	s.clientCACertificatePool = clientCACertificatePool
+	s.revocation = revocation
+	s.configMutex.Unlock()
+
+	if s.watcher != nil {
+		s.watcher.SetAddressPolicies(config.AddressPolicies)
+	}
+}
+
+// Returns the current address policies of the server
+func (s *Server) addressPolicies() []AddressPolicy {
+	s.configMutex.RLock()
+	defer s.configMutex.RUnlock()
+	return s.AddressPolicies
+}
+
+// Returns the current client ca certificate pool of the server
+func (s *Server) clientCAs() *x509.CertPool {
+	s.configMutex.RLock()
+	defer s.configMutex.RUnlock()
+	return s.clientCACertificatePool
+}
+
+// Returns the current revocation checker of the server
+func (s *Server) revocationChecker() *RevocationChecker {
+	s.configMutex.RLock()
+	defer s.configMutex.RUnlock()
+	return s.revocation
+}
+
+// Returns the current server certificate for a TLS handshake
+func (s *Server) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.configMutex.RLock()
+	defer s.configMutex.RUnlock()
+	return s.certificate, nil
+}
+
+// Reads the configuration file again and swaps in its policies and TLS
+// material (an invalid configuration is logged and the previous one is kept)
+func (s *Server) Reload() error {
+	config, err := ReadConfiguration(s.configFilePath)
+	if err != nil {
+		zap.L().Error("Failed to reload configuration, keeping the previous one",
+			zap.String("path", s.configFilePath),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	certificate, clientCACertificatePool, err := loadTLSMaterial(config)
+	if err != nil {
+		zap.L().Error("Failed to reload TLS material, keeping the previous configuration",
+			zap.String("path", s.configFilePath),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	revocation, err := NewRevocationChecker(config)
+	if err != nil {
+		zap.L().Error("Failed to reload certificate revocation lists, keeping the previous configuration",
+			zap.String("path", s.configFilePath),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	s.configMutex.RLock()
+	previous := s.config
+	s.configMutex.RUnlock()
+
+	// The listener and the state store aren't replaced at runtime
+	if previous != nil && (config.Port != previous.Port || config.HealthzPort != previous.HealthzPort || config.StateDirectoryPath != previous.StateDirectoryPath) {
+		zap.L().Warn("Changes of the ports and the state directory require a restart",
+			zap.String("path", s.configFilePath),
+		)
+	}
+
+	s.applyConfiguration(config, certificate, clientCACertificatePool, revocation)
+
+	zap.L().Info("Reloaded configuration",
+		zap.String("path", s.configFilePath),
+		zap.Int("address-policies", len(config.AddressPolicies)),
+	)
+	return nil
+}
+
+// Returns the paths of the files, that a reload reads
+func (s *Server) reloadedFilePaths() []string {
+	s.configMutex.RLock()
+	defer s.configMutex.RUnlock()
+
+	paths := []string{s.configFilePath}
+	if s.config != nil {
+		paths = append(paths, s.config.ClientCACertificatePath, s.config.ServerCertificatePath, s.config.ServerKeyPath)
+	}
+	return paths
+}
+
+// Returns a fingerprint of the modification times and sizes of files, that
+// changes, whenever one of them is written, replaced or removed
+func filesFingerprint(paths []string) string {
+	var sb strings.Builder
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(&sb, "%s missing\n", path)
+			continue
+		}
+		fmt.Fprintf(&sb, "%s %d %d\n", path, info.ModTime().UnixNano(), info.Size())
+	}
+	return sb.String()
+}
+
+// Reloads the configuration on SIGHUP and whenever the configuration file or
+// one of the certificate files changes, until the stop channel is closed
+func (s *Server) RunReloader(stop <-chan struct{}) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	ticker := time.NewTicker(reloadPollInterval)
+	defer ticker.Stop()
+
+	fingerprint := filesFingerprint(s.reloadedFilePaths())
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-signals:
+			zap.L().Info("Received SIGHUP, reloading configuration",
+				zap.String("path", s.configFilePath),
+			)
+		case <-ticker.C:
+			if filesFingerprint(s.reloadedFilePaths()) == fingerprint {
+				continue
+			}
+			zap.L().Info("Configuration files changed, reloading configuration",
+				zap.String("path", s.configFilePath),
+			)
+		}
+
+		// A failed reload isn't retried until the files change again
+		s.Reload()
+		fingerprint = filesFingerprint(s.reloadedFilePaths())
+	}
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+// Writes a configuration with a single address policy, that refers to the
+// certificates of the test directory
+func writeReloadConfiguration(t *testing.T, path string, ipNetwork string) {
+	testDirectoryPath, err := filepath.Abs("../test")
+	assert.NilError(t, err)
+
+	config := fmt.Sprintf(`{
+	"port": 44813,
+	"client_ca_certificate_path": "%s/client-ca.crt",
+	"server_certificate_path": "%s/server.crt",
+	"server_key_path": "%s/server.key",
+	"address_policies": [{"ip_network": "%s", "interface_name_regex": ".*"}]
+}`, testDirectoryPath, testDirectoryPath, testDirectoryPath, ipNetwork)
+	assert.NilError(t, os.WriteFile(path, []byte(config), 0600))
+}
+
+func TestReload(t *testing.T) {
+	configFilePath := filepath.Join(t.TempDir(), "config.json")
+	writeReloadConfiguration(t, configFilePath, "198.51.100.0/24")
+
+	watcher := &Watcher{}
+	server := &Server{configFilePath: configFilePath, watcher: watcher}
+	assert.NilError(t, server.Reload())
+	assert.Equal(t, server.addressPolicies()[0].IPNetwork.String(), "198.51.100.0/24")
+	assert.Equal(t, watcher.addressPolicies()[0].IPNetwork.String(), "198.51.100.0/24")
+	assert.Assert(t, server.clientCAs() != nil)
+
+	certificate, err := server.getCertificate(nil)
+	assert.NilError(t, err)
+	assert.Assert(t, certificate != nil)
+
+	// An invalid configuration keeps the previous one
+	assert.NilError(t, os.WriteFile(configFilePath, []byte(`{"port": 44813, "address_policies": [{"ip_network": "invalid"}]}`), 0600))
+	assert.Assert(t, server.Reload() != nil)
+	assert.Equal(t, server.addressPolicies()[0].IPNetwork.String(), "198.51.100.0/24")
+
+	writeReloadConfiguration(t, configFilePath, "192.0.2.0/24")
+	assert.NilError(t, server.Reload())
+	assert.Equal(t, server.addressPolicies()[0].IPNetwork.String(), "192.0.2.0/24")
+	assert.Equal(t, watcher.addressPolicies()[0].IPNetwork.String(), "192.0.2.0/24")
+}
+
+func TestRunReloader(t *testing.T) {
+	configFilePath := filepath.Join(t.TempDir(), "config.json")
+	writeReloadConfiguration(t, configFilePath, "198.51.100.0/24")
+
+	server := &Server{configFilePath: configFilePath}
+	assert.NilError(t, server.Reload())
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go server.RunReloader(stop)
+
+	waitForPolicy := func(ipNetwork string) {
+		for i := 0; i < 50 && server.addressPolicies()[0].IPNetwork.String() != ipNetwork; i++ {
+			time.Sleep(100 * time.Millisecond)
+		}
+		assert.Equal(t, server.addressPolicies()[0].IPNetwork.String(), ipNetwork)
+	}
+
+	// Changes of the configuration file are picked up
+	time.Sleep(100 * time.Millisecond)
+	writeReloadConfiguration(t, configFilePath, "192.0.2.0/24")
+	waitForPolicy("192.0.2.0/24")
+
+	// SIGHUP reloads the configuration as well, even if the file looks unchanged
+	info, err := os.Stat(configFilePath)
+	assert.NilError(t, err)
+	writeReloadConfiguration(t, configFilePath, "192.0.2.0/25")
+	assert.NilError(t, os.Chtimes(configFilePath, info.ModTime(), info.ModTime()))
+	assert.NilError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	waitForPolicy("192.0.2.0/25")
+}
@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Version of the json response envelope
+const ResponseVersion = 1
+
+// Machine-readable error code of a response
+type ErrorCode string
+
+const (
+	ErrorCodeUnauthorized ErrorCode = "unauthorized"
+	ErrorCodeAccessDenied ErrorCode = "access_denied"
+	ErrorCodePathNotFound ErrorCode = "path_not_found"
+	ErrorCodeMethodNotAllowed ErrorCode = "method_not_allowed"
+	ErrorCodeInvalidRequest ErrorCode = "invalid_request"
+	ErrorCodeAddressParseError ErrorCode = "address_parse_error"
+	ErrorCodePolicyDenied ErrorCode = "policy_denied"
+	ErrorCodeLinkNotFound ErrorCode = "link_not_found"
+	ErrorCodeNetlinkFailure ErrorCode = "netlink_failure"
+	ErrorCodeAdvertiseFailed ErrorCode = "advertise_failed"
+	ErrorCodeStoreFailure ErrorCode = "store_failure"
+	ErrorCodePoolExhausted ErrorCode = "pool_exhausted"
+	ErrorCodeAddressNotFound ErrorCode = "address_not_found"
+	ErrorCodeLeaseNotFound ErrorCode = "lease_not_found"
+	ErrorCodeLeaseNotOwned ErrorCode = "lease_not_owned"
+	ErrorCodeAddressConflict ErrorCode = "address_conflict"
+	ErrorCodeDADTimeout ErrorCode = "dad_timeout"
+	ErrorCodeNamespaceNotFound ErrorCode = "netns_not_found"
+	ErrorCodeAddressLimitExceeded ErrorCode = "address_limit_exceeded"
+)
+
+// Holds the json response envelope for successful and failed requests
+type Response struct {
+	Version int `json:"version"`
+	Success bool `json:"success"`
+	Message string `json:"message"`
+	Error *ResponseError `json:"error,omitempty"`
+	Address string `json:"address,omitempty"`
+	InterfaceName string `json:"interface_name,omitempty"`
+	InterfaceIndex int `json:"interface_index,omitempty"`
+	Netns string `json:"netns,omitempty"`
+	HardwareAddress string `json:"hardware_address,omitempty"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// Holds the error details of a failed request
+type ResponseError struct {
+	Code ErrorCode `json:"code"`
+	Detail string `json:"detail,omitempty"`
+	HardwareAddress string `json:"hardware_address,omitempty"`
+}
+
+// Response data, that can be rendered as plain text
+type PlainTextData interface {
+	PlainText() string
+}
+
+// Checks whether the client prefers a plain text response over json via
+// the accept header (json is used, if nothing is specified)
+func prefersPlainText(r *http.Request) bool {
+	plainTextQuality, jsonQuality := -1.0, -1.0
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if _, err := fmt.Sscanf(q, "%g", &quality); err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case "text/plain":
+			plainTextQuality = max(plainTextQuality, quality)
+		case "application/json":
+			jsonQuality = max(jsonQuality, quality)
+		}
+	}
+
+	return plainTextQuality > 0 && plainTextQuality > jsonQuality
+}
+
+// Writes a response in the format negotiated with the client
+func writeResponse(w http.ResponseWriter, r *http.Request, statusCode int, response Response) {
+	response.Version = ResponseVersion
+	response.Success = response.Error == nil
+
+	if prefersPlainText(r) {
+		if !response.Success {
+			http.Error(w, response.Message, statusCode)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(statusCode)
+		fmt.Fprintf(w, "%s\n", response.Message)
+		if data, ok := response.Data.(PlainTextData); ok {
+			fmt.Fprint(w, data.PlainText())
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		zap.L().Error("Failed to encode response",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.Error(err),
+		)
+	}
+}
+
+// Writes a successful response
+func writeSuccess(w http.ResponseWriter, r *http.Request, response Response) {
+	writeResponse(w, r, http.StatusOK, response)
+}
+
+// Writes an error response with a human readable message and a machine-readable error code
+func writeError(w http.ResponseWriter, r *http.Request, statusCode int, code ErrorCode, message string, err error, response Response) {
+	response.Error = &ResponseError{Code: code}
+	response.Message = message
+
+	// Tell the client which host uses a conflicting address
+	var duplicateAddressError *DuplicateAddressError
+	if errors.As(err, &duplicateAddressError) && duplicateAddressError.HardwareAddr != nil {
+		response.Error.HardwareAddress = duplicateAddressError.HardwareAddr.String()
+	}
+
+	if err != nil {
+		response.Error.Detail = err.Error()
+		response.Message = fmt.Sprintf("%s: %v", message, err)
+	}
+
+	writeResponse(w, r, statusCode, response)
+}
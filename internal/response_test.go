@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestContentNegotiation(t *testing.T) {
+	cases := map[string]bool{
+		"": false,
+		"*/*": false,
+		"application/json": false,
+		"text/plain": true,
+		"text/plain, application/json": false,
+		"application/json;q=0.5, text/plain": true,
+		"text/plain;q=0.2, application/json;q=0.8": false,
+		"text/plain;q=0": false,
+	}
+
+	for accept, plainText := range cases {
+		req, err := http.NewRequest("GET", "/addresses", nil)
+		assert.NilError(t, err)
+		req.Header.Set("Accept", accept)
+
+		assert.Equal(t, prefersPlainText(req), plainText, "Accept: %q", accept)
+	}
+}
+
+func TestConflictErrorResponse(t *testing.T) {
+	req, err := http.NewRequest("POST", "/add", nil)
+	assert.NilError(t, err)
+
+	hardwareAddr, err := net.ParseMAC("02:00:00:00:00:01")
+	assert.NilError(t, err)
+
+	rr := httptest.NewRecorder()
+	writeError(rr, req, http.StatusConflict, ErrorCodeAddressConflict, "Failed to add cidr address to interface", &DuplicateAddressError{hardwareAddr}, Response{})
+
+	var response Response
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, rr.Code, http.StatusConflict)
+	assert.Equal(t, response.Error.Code, ErrorCodeAddressConflict)
+	assert.Equal(t, response.Error.HardwareAddress, "02:00:00:00:00:01")
+}
@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Re-applies the recorded addresses of an interface (or of all interfaces, if
+// the interface name is empty) and advertises them as configured by the policies
+func RestoreAddresses(store *Store, policies []AddressPolicy, interfaceName string) {
+	records := store.Records()
+	if interfaceName != "" {
+		records = store.RecordsOfInterface(interfaceName)
+	}
+
+	for _, record := range records {
+		// Expired leases are removed by the lease reaper
+		if record.Expired(time.Now()) {
+			continue
+		}
+
+		link, err := LinkByName(record.InterfaceName)
+		if err != nil {
+			zap.L().Warn("Failed to retreive interface for restoring managed address",
+				zap.String("interface-name", record.InterfaceName),
+				zap.String("address", record.Address),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		address, err := record.CIDRAddress()
+		if err != nil {
+			zap.L().Error("Failed to parse recorded cidr address",
+				zap.String("interface-name", record.InterfaceName),
+				zap.String("address", record.Address),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		// Adding an address also advertises it, if it was missing
+		if err := AddAddress(link, address, advertisementFor(PoliciesForLink(policies, link), record.InterfaceName, address)); err != nil {
+			zap.L().Error("Failed to restore managed address",
+				zap.String("interface-name", record.InterfaceName),
+				zap.String("address", record.Address),
+				zap.Error(err),
+			)
+			continue
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ocsp"
+)
+
+// Fail modes of OCSP checks, if the responder can't be reached or doesn't
+// give a definite answer
+const (
+	OCSPFailModeOpen = "open"
+	OCSPFailModeClosed = "closed"
+)
+
+const (
+	defaultCRLReloadInterval = 5 * time.Minute
+	defaultOCSPTimeout = 5 * time.Second
+	defaultOCSPCacheDuration = time.Hour
+	maxOCSPResponseSize = 1 << 20
+	// Failed checks are cached shortly, so an unreachable responder isn't
+	// queried on every request
+	ocspFailureCacheDuration = 30 * time.Second
+	// Tolerated difference between the clocks of the responder and the server
+	maxOCSPClockSkew = time.Minute
+)
+
+// Error returned, when a certificate of a client is revoked
+type RevokedError struct {
+	SerialNumber *big.Int
+	Source string
+}
+
+func (e *RevokedError) Error() string {
+	return fmt.Sprintf("certificate with serial number %s is revoked (according to %s)", e.SerialNumber.Text(16), e.Source)
+}
+
+// Validates the OCSP configuration
+func (oc *OCSPConfig) validate() error {
+	if oc == nil {
+		return nil
+	}
+
+	if oc.FailMode != "" && oc.FailMode != OCSPFailModeOpen && oc.FailMode != OCSPFailModeClosed {
+		return fmt.Errorf("The ocsp configuration has an invalid fail mode \"%s\" (expected \"open\" or \"closed\")", oc.FailMode)
+	}
+
+	if oc.ResponderURL != "" {
+		if u, err := url.Parse(oc.ResponderURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("The ocsp configuration has an invalid responder url \"%s\"", oc.ResponderURL)
+		}
+	}
+
+	if oc.Timeout.Duration < 0 || oc.CacheDuration.Duration < 0 {
+		return errors.New("The ocsp configuration has a negative timeout or cache duration")
+	}
+
+	return nil
+}
+
+// Checks whether failed OCSP checks reject the client (defaults to true)
+func (oc *OCSPConfig) IsFailClosed() bool {
+	return oc.FailMode != OCSPFailModeOpen
+}
+
+// Returns the timeout of OCSP requests
+func (oc *OCSPConfig) RequestTimeout() time.Duration {
+	if oc.Timeout.Duration == 0 {
+		return defaultOCSPTimeout
+	}
+	return oc.Timeout.Duration
+}
+
+// Returns how long OCSP responses without next update are cached (and the
+// maximum for all responses)
+func (oc *OCSPConfig) MaxCacheDuration() time.Duration {
+	if oc.CacheDuration.Duration == 0 {
+		return defaultOCSPCacheDuration
+	}
+	return oc.CacheDuration.Duration
+}
+
+// Returns the interval between reloads of the revocation lists
+func (c Config) CRLReloadEvery() time.Duration {
+	if c.CRLReloadInterval.Duration == 0 {
+		return defaultCRLReloadInterval
+	}
+	return c.CRLReloadInterval.Duration
+}
+
+// Holds a cached OCSP status of a certificate (or the error of a failed check)
+type ocspCacheEntry struct {
+	status int
+	err error
+	expiresAt time.Time
+}
+
+// Checks client certificates against revocation lists and OCSP responders
+type RevocationChecker struct {
+	CRLPaths []string
+	OCSP *OCSPConfig
+	// Guards the revocation lists and the OCSP cache
+	mutex sync.RWMutex
+	crls []*x509.RevocationList
+	ocspCache map[string]ocspCacheEntry
+	client *http.Client
+}
+
+// Creates a revocation checker for a configuration and reads its revocation
+// lists
+func NewRevocationChecker(config *Config) (*RevocationChecker, error) {
+	rc := &RevocationChecker{
+		CRLPaths: config.CRLPaths,
+		OCSP: config.OCSP,
+		ocspCache: make(map[string]ocspCacheEntry),
+	}
+
+	if rc.OCSP != nil {
+		rc.client = &http.Client{Timeout: rc.OCSP.RequestTimeout()}
+	}
+
+	if err := rc.LoadCRLs(); err != nil {
+		return nil, err
+	}
+
+	return rc, nil
+}
+
+// Reads a revocation list in PEM or DER format
+func readCRL(path string) (*x509.RevocationList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "X509 CRL" {
+			return nil, fmt.Errorf("unexpected pem block \"%s\" (expected \"X509 CRL\")", block.Type)
+		}
+		data = block.Bytes
+	}
+
+	return x509.ParseRevocationList(data)
+}
+
+// Reads the revocation lists again (if one of them can't be read, the
+// previous ones are kept)
+func (rc *RevocationChecker) LoadCRLs() error {
+	var crls []*x509.RevocationList
+	for _, path := range rc.CRLPaths {
+		crl, err := readCRL(path)
+		if err != nil {
+			zap.L().Error("Failed to read certificate revocation list",
+				zap.String("path", path),
+				zap.Error(err),
+			)
+			return err
+		}
+
+		if !crl.NextUpdate.IsZero() && crl.NextUpdate.Before(time.Now()) {
+			zap.L().Warn("Certificate revocation list is outdated",
+				zap.String("path", path),
+				zap.Time("next-update", crl.NextUpdate),
+			)
+		}
+
+		crls = append(crls, crl)
+	}
+
+	rc.mutex.Lock()
+	rc.crls = crls
+	rc.mutex.Unlock()
+
+	return nil
+}
+
+// Checks whether a certificate is revoked by a revocation list of its issuer
+func (rc *RevocationChecker) checkCRLs(certificate *x509.Certificate, issuer *x509.Certificate) error {
+	rc.mutex.RLock()
+	defer rc.mutex.RUnlock()
+
+	for _, crl := range rc.crls {
+		if !bytes.Equal(crl.RawIssuer, certificate.RawIssuer) || crl.CheckSignatureFrom(issuer) != nil {
+			continue
+		}
+
+		for _, entry := range crl.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(certificate.SerialNumber) == 0 {
+				return &RevokedError{certificate.SerialNumber, "certificate revocation list"}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns the key of a certificate in the OCSP cache
+func ocspCacheKey(certificate *x509.Certificate) string {
+	return string(certificate.RawIssuer) + " " + certificate.SerialNumber.String()
+}
+
+// Queries the OCSP responder for the status of a certificate
+func (rc *RevocationChecker) queryOCSP(certificate *x509.Certificate, issuer *x509.Certificate) (*ocsp.Response, error) {
+	responderURL := rc.OCSP.ResponderURL
+	if responderURL == "" {
+		if len(certificate.OCSPServer) == 0 {
+			return nil, errors.New("certificate has no ocsp responder")
+		}
+		responderURL = certificate.OCSPServer[0]
+	}
+
+	request, err := ocsp.CreateRequest(certificate, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := rc.client.Post(responderURL, "application/ocsp-request", bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ocsp responder returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxOCSPResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return ocsp.ParseResponseForCert(body, certificate, issuer)
+}
+
+// Checks whether an OCSP response gives a definite and current answer
+func checkOCSPResponse(response *ocsp.Response, now time.Time) error {
+	if response.Status == ocsp.Unknown {
+		return errors.New("ocsp responder doesn't know the certificate")
+	}
+	if response.ThisUpdate.After(now.Add(maxOCSPClockSkew)) {
+		return fmt.Errorf("ocsp response isn't valid before %s", response.ThisUpdate)
+	}
+	if !response.NextUpdate.IsZero() && response.NextUpdate.Before(now) {
+		return fmt.Errorf("ocsp response is outdated since %s", response.NextUpdate)
+	}
+	return nil
+}
+
+// Queries the OCSP responder for the status of a certificate and returns the
+// cache entry for it (definite answers are cached until their next update,
+// failures for a short time)
+func (rc *RevocationChecker) fetchOCSPStatus(certificate *x509.Certificate, issuer *x509.Certificate, now time.Time) ocspCacheEntry {
+	response, err := rc.queryOCSP(certificate, issuer)
+	if err == nil {
+		err = checkOCSPResponse(response, now)
+	}
+	if err != nil {
+		return ocspCacheEntry{err: err, expiresAt: now.Add(ocspFailureCacheDuration)}
+	}
+
+	entry := ocspCacheEntry{status: response.Status, expiresAt: now.Add(rc.OCSP.MaxCacheDuration())}
+	if !response.NextUpdate.IsZero() && response.NextUpdate.Before(entry.expiresAt) {
+		entry.expiresAt = response.NextUpdate
+	}
+	return entry
+}
+
+// Removes the expired entries from the OCSP cache, so it doesn't grow with
+// every certificate seen (the mutex must be held)
+func (rc *RevocationChecker) pruneOCSPCache(now time.Time) {
+	for key, entry := range rc.ocspCache {
+		if !now.Before(entry.expiresAt) {
+			delete(rc.ocspCache, key)
+		}
+	}
+}
+
+// Takes over the cached OCSP answers of a previous revocation checker, if
+// both query the responder the same way
+func (rc *RevocationChecker) adoptOCSPCache(previous *RevocationChecker) {
+	if rc == nil || previous == nil || rc.OCSP == nil || previous.OCSP == nil || *rc.OCSP != *previous.OCSP {
+		return
+	}
+
+	previous.mutex.RLock()
+	defer previous.mutex.RUnlock()
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	for key, entry := range previous.ocspCache {
+		rc.ocspCache[key] = entry
+	}
+}
+
+// Checks whether a certificate is revoked according to the OCSP responder
+func (rc *RevocationChecker) checkOCSP(certificate *x509.Certificate, issuer *x509.Certificate) error {
+	key := ocspCacheKey(certificate)
+	now := time.Now()
+
+	rc.mutex.RLock()
+	entry, cached := rc.ocspCache[key]
+	rc.mutex.RUnlock()
+
+	if !cached || !now.Before(entry.expiresAt) {
+		cached = false
+		entry = rc.fetchOCSPStatus(certificate, issuer, now)
+
+		rc.mutex.Lock()
+		rc.pruneOCSPCache(now)
+		rc.ocspCache[key] = entry
+		rc.mutex.Unlock()
+	}
+
+	if entry.err != nil {
+		if rc.OCSP.IsFailClosed() {
+			return fmt.Errorf("ocsp check failed: %w", entry.err)
+		}
+		if !cached {
+			zap.L().Warn("OCSP check failed, accepting certificate (fail-open)",
+				zap.String("serial-number", certificate.SerialNumber.Text(16)),
+				zap.Error(entry.err),
+			)
+		}
+		return nil
+	}
+
+	if entry.status == ocsp.Revoked {
+		return &RevokedError{certificate.SerialNumber, "ocsp responder"}
+	}
+
+	return nil
+}
+
+// Checks whether the client certificate of a verified chain (starting with the
+// client certificate and ending with the root) is revoked (a nil checker
+// doesn't check anything)
+func (rc *RevocationChecker) Check(chain []*x509.Certificate) error {
+	if rc == nil || len(chain) < 2 {
+		return nil
+	}
+
+	// Intermediates are only checked against the revocation lists
+	for i := 0; i < len(chain) - 1; i++ {
+		if err := rc.checkCRLs(chain[i], chain[i + 1]); err != nil {
+			return err
+		}
+	}
+
+	if rc.OCSP != nil {
+		return rc.checkOCSP(chain[0], chain[1])
+	}
+
+	return nil
+}
+
+// Returns the interval between reloads of the revocation lists of the server
+func (s *Server) crlReloadInterval() time.Duration {
+	s.configMutex.RLock()
+	defer s.configMutex.RUnlock()
+	if s.config == nil {
+		return defaultCRLReloadInterval
+	}
+	return s.config.CRLReloadEvery()
+}
+
+// Reloads the revocation lists of the server periodically, until the stop
+// channel is closed
+func (s *Server) RunCRLReloader(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(s.crlReloadInterval()):
+		}
+
+		if rc := s.revocationChecker(); rc != nil && len(rc.CRLPaths) > 0 {
+			rc.LoadCRLs()
+		}
+	}
+}
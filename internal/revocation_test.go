@@ -0,0 +1,260 @@
+package internal
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+	"gotest.tools/assert"
+)
+
+// Holds a certificate authority for revocation tests
+type testCA struct {
+	certificate *x509.Certificate
+	key crypto.Signer
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{CommonName: "test-ca"},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour),
+		IsCA: true,
+		BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	assert.NilError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	assert.NilError(t, err)
+
+	return &testCA{certificate, key}
+}
+
+func (ca *testCA) issue(t *testing.T, serialNumber int64) *x509.Certificate {
+	certificate, _ := ca.issueWithKey(t, serialNumber, x509.ExtKeyUsageClientAuth)
+	return certificate
+}
+
+func (ca *testCA) issueWithKey(t *testing.T, serialNumber int64, extKeyUsages ...x509.ExtKeyUsage) (*x509.Certificate, crypto.Signer) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serialNumber),
+		Subject: pkix.Name{CommonName: "client"},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour),
+		ExtKeyUsage: extKeyUsages,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, key.Public(), ca.key)
+	assert.NilError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	assert.NilError(t, err)
+
+	return certificate, key
+}
+
+func (ca *testCA) writeCRL(t *testing.T, path string, revokedSerialNumbers ...int64) {
+	template := &x509.RevocationList{
+		Number: big.NewInt(time.Now().UnixNano()),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+	for _, serialNumber := range revokedSerialNumbers {
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber: big.NewInt(serialNumber),
+			RevocationTime: time.Now().Add(-time.Minute),
+		})
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, template, ca.certificate, ca.key)
+	assert.NilError(t, err)
+	assert.NilError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0600))
+}
+
+func TestRevocationCRL(t *testing.T) {
+	ca := newTestCA(t)
+	good := ca.issue(t, 10)
+	revoked := ca.issue(t, 11)
+
+	crlPath := filepath.Join(t.TempDir(), "ca.crl")
+	ca.writeCRL(t, crlPath, 11)
+
+	rc, err := NewRevocationChecker(&Config{CRLPaths: []string{crlPath}})
+	assert.NilError(t, err)
+
+	assert.NilError(t, rc.Check([]*x509.Certificate{good, ca.certificate}))
+	assert.ErrorType(t, rc.Check([]*x509.Certificate{revoked, ca.certificate}), &RevokedError{})
+
+	// Revocation lists of other issuers are ignored
+	otherCA := newTestCA(t)
+	assert.NilError(t, rc.Check([]*x509.Certificate{otherCA.issue(t, 11), otherCA.certificate}))
+
+	// A reload picks up newly revoked certificates
+	ca.writeCRL(t, crlPath, 10, 11)
+	assert.NilError(t, rc.LoadCRLs())
+	assert.ErrorType(t, rc.Check([]*x509.Certificate{good, ca.certificate}), &RevokedError{})
+
+	// An unreadable revocation list keeps the previous ones
+	assert.NilError(t, os.WriteFile(crlPath, []byte("invalid"), 0600))
+	assert.Assert(t, rc.LoadCRLs() != nil)
+	assert.ErrorType(t, rc.Check([]*x509.Certificate{good, ca.certificate}), &RevokedError{})
+
+	_, err = NewRevocationChecker(&Config{CRLPaths: []string{filepath.Join(t.TempDir(), "missing.crl")}})
+	assert.Assert(t, err != nil)
+}
+
+// Starts an OCSP responder stub, that answers with the status of a serial
+// number (unknown serial numbers are answered as unknown)
+// Starts an OCSP responder answering with the statuses of the serial numbers
+// (unknown by default), that are valid for the next hour, unless other update
+// times are given for a serial number
+func startOCSPResponder(t *testing.T, ca *testCA, statuses map[int64]int, updates map[int64][2]time.Time, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+
+		body, err := io.ReadAll(r.Body)
+		assert.NilError(t, err)
+		request, err := ocsp.ParseRequest(body)
+		assert.NilError(t, err)
+
+		status, ok := statuses[request.SerialNumber.Int64()]
+		if !ok {
+			status = ocsp.Unknown
+		}
+
+		template := ocsp.Response{
+			Status: status,
+			SerialNumber: request.SerialNumber,
+			ThisUpdate: time.Now().Add(-time.Minute),
+			NextUpdate: time.Now().Add(time.Hour),
+			RevokedAt: time.Now().Add(-time.Minute),
+		}
+		if times, ok := updates[request.SerialNumber.Int64()]; ok {
+			template.ThisUpdate, template.NextUpdate = times[0], times[1]
+		}
+		response, err := ocsp.CreateResponse(ca.certificate, ca.certificate, template, ca.key)
+		assert.NilError(t, err)
+
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(response)
+	}))
+}
+
+func TestRevocationOCSP(t *testing.T) {
+	ca := newTestCA(t)
+	good := ca.issue(t, 20)
+	revoked := ca.issue(t, 21)
+	unknown := ca.issue(t, 22)
+	outdated := ca.issue(t, 23)
+	premature := ca.issue(t, 24)
+
+	var requests int32
+	responder := startOCSPResponder(t, ca, map[int64]int{20: ocsp.Good, 21: ocsp.Revoked, 23: ocsp.Good, 24: ocsp.Good}, map[int64][2]time.Time{
+		23: {time.Now().Add(-2 * time.Hour), time.Now().Add(-time.Hour)},
+		24: {time.Now().Add(time.Hour), time.Now().Add(2 * time.Hour)},
+	}, &requests)
+	defer responder.Close()
+
+	rc, err := NewRevocationChecker(&Config{OCSP: &OCSPConfig{ResponderURL: responder.URL}})
+	assert.NilError(t, err)
+
+	assert.NilError(t, rc.Check([]*x509.Certificate{good, ca.certificate}))
+	assert.ErrorType(t, rc.Check([]*x509.Certificate{revoked, ca.certificate}), &RevokedError{})
+	assert.Equal(t, atomic.LoadInt32(&requests), int32(2))
+
+	// Definite answers are cached
+	assert.NilError(t, rc.Check([]*x509.Certificate{good, ca.certificate}))
+	assert.ErrorType(t, rc.Check([]*x509.Certificate{revoked, ca.certificate}), &RevokedError{})
+	assert.Equal(t, atomic.LoadInt32(&requests), int32(2))
+
+	// Unknown certificates are rejected (fail-closed is the default)
+	assert.ErrorContains(t, rc.Check([]*x509.Certificate{unknown, ca.certificate}), "ocsp check failed")
+
+	// Responses, that are outdated or not valid yet, aren't trusted
+	assert.ErrorContains(t, rc.Check([]*x509.Certificate{outdated, ca.certificate}), "ocsp response is outdated")
+	assert.ErrorContains(t, rc.Check([]*x509.Certificate{premature, ca.certificate}), "ocsp response isn't valid before")
+
+	rcOpen, err := NewRevocationChecker(&Config{OCSP: &OCSPConfig{ResponderURL: responder.URL, FailMode: OCSPFailModeOpen}})
+	assert.NilError(t, err)
+	assert.NilError(t, rcOpen.Check([]*x509.Certificate{unknown, ca.certificate}))
+	assert.ErrorType(t, rcOpen.Check([]*x509.Certificate{revoked, ca.certificate}), &RevokedError{})
+
+	// Failed checks are cached for a short time
+	requestsBefore := atomic.LoadInt32(&requests)
+	assert.NilError(t, rcOpen.Check([]*x509.Certificate{unknown, ca.certificate}))
+	assert.ErrorContains(t, rc.Check([]*x509.Certificate{unknown, ca.certificate}), "ocsp check failed")
+	assert.Equal(t, atomic.LoadInt32(&requests), requestsBefore)
+
+	// An unreachable responder fails according to the fail mode
+	responder.Close()
+	rc, err = NewRevocationChecker(&Config{OCSP: &OCSPConfig{ResponderURL: responder.URL}})
+	assert.NilError(t, err)
+	assert.ErrorContains(t, rc.Check([]*x509.Certificate{good, ca.certificate}), "ocsp check failed")
+
+	rcOpen, err = NewRevocationChecker(&Config{OCSP: &OCSPConfig{ResponderURL: responder.URL, FailMode: OCSPFailModeOpen}})
+	assert.NilError(t, err)
+	assert.NilError(t, rcOpen.Check([]*x509.Certificate{good, ca.certificate}))
+}
+
+func TestOCSPCacheEviction(t *testing.T) {
+	ca := newTestCA(t)
+	good := ca.issue(t, 20)
+
+	var requests int32
+	responder := startOCSPResponder(t, ca, map[int64]int{20: ocsp.Good}, nil, &requests)
+	defer responder.Close()
+
+	config := &Config{OCSP: &OCSPConfig{ResponderURL: responder.URL}}
+	rc, err := NewRevocationChecker(config)
+	assert.NilError(t, err)
+
+	// Expired entries are removed, when another one is cached
+	rc.ocspCache["expired"] = ocspCacheEntry{status: ocsp.Good, expiresAt: time.Now().Add(-time.Second)}
+	assert.NilError(t, rc.Check([]*x509.Certificate{good, ca.certificate}))
+	assert.Equal(t, len(rc.ocspCache), 1)
+	assert.Equal(t, atomic.LoadInt32(&requests), int32(1))
+
+	// Reloading keeps the cache, unless the ocsp configuration changed
+	s := &Server{}
+	s.applyConfiguration(config, nil, nil, rc)
+
+	reloaded, err := NewRevocationChecker(config)
+	assert.NilError(t, err)
+	s.applyConfiguration(config, nil, nil, reloaded)
+	assert.NilError(t, s.revocationChecker().Check([]*x509.Certificate{good, ca.certificate}))
+	assert.Equal(t, atomic.LoadInt32(&requests), int32(1))
+
+	changedConfig := &Config{OCSP: &OCSPConfig{ResponderURL: responder.URL, FailMode: OCSPFailModeOpen}}
+	reloaded, err = NewRevocationChecker(changedConfig)
+	assert.NilError(t, err)
+	s.applyConfiguration(changedConfig, nil, nil, reloaded)
+	assert.NilError(t, s.revocationChecker().Check([]*x509.Certificate{good, ca.certificate}))
+	assert.Equal(t, atomic.LoadInt32(&requests), int32(2))
+}
+
+func TestInvalidOCSPFailMode(t *testing.T) {
+	_, err := ReadConfiguration("../test/config-ocsp-invalid-fail-mode.json")
+	assert.Error(t, err, "The ocsp configuration has an invalid fail mode \"maybe\" (expected \"open\" or \"closed\")")
+}
@@ -0,0 +1,524 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	"go.uber.org/zap"
+)
+
+type NetworkRoute = *netlink.Route
+
+// Holds the request data of a route operation
+type RouteRequestData struct {
+	Destination string `json:"destination"`
+	InterfaceName string `json:"interface_name"`
+	Gateway string `json:"gateway"`
+	Source string `json:"source"`
+	Table int `json:"table"`
+	Metric int `json:"metric"`
+}
+
+// Holds information about a route present on a network link
+type RouteInfo struct {
+	Destination string `json:"destination"`
+	InterfaceName string `json:"interface_name"`
+	Gateway string `json:"gateway,omitempty"`
+	Source string `json:"source,omitempty"`
+	Table int `json:"table"`
+	Metric int `json:"metric"`
+	Scope string `json:"scope"`
+}
+
+// Holds the list of routes returned by a list request
+type RouteList struct {
+	Routes []RouteInfo `json:"routes"`
+}
+
+// Renders the route list as plain text (one route per line)
+func (rl RouteList) PlainText() string {
+	var sb strings.Builder
+	for _, r := range rl.Routes {
+		fmt.Fprintf(&sb, "%s dev %s", r.Destination, r.InterfaceName)
+		if r.Gateway != "" {
+			fmt.Fprintf(&sb, " via %s", r.Gateway)
+		}
+		if r.Source != "" {
+			fmt.Fprintf(&sb, " src %s", r.Source)
+		}
+		fmt.Fprintf(&sb, " table %d metric %d\n", r.Table, r.Metric)
+	}
+	return sb.String()
+}
+
+// Parses a route to a destination network with an optional gateway, source
+// hint, routing table (defaults to the main table) and metric
+func ParseRoute(destination string, gateway string, source string, table int, metric int) (NetworkRoute, error) {
+	_, dst, err := net.ParseCIDR(destination)
+	if err != nil {
+		return nil, err
+	}
+
+	if table < 0 || int64(table) > int64(^uint32(0)) {
+		return nil, fmt.Errorf("invalid routing table %d", table)
+	}
+	if table == 0 {
+		table = unix.RT_TABLE_MAIN
+	}
+
+	if metric < 0 || int64(metric) > int64(^uint32(0)) {
+		return nil, fmt.Errorf("invalid metric %d", metric)
+	}
+
+	route := &netlink.Route{
+		Dst: dst,
+		Table: table,
+		Priority: metric,
+	}
+
+	if gateway != "" {
+		route.Gw = net.ParseIP(gateway)
+		if route.Gw == nil || (route.Gw.To4() == nil) != (dst.IP.To4() == nil) {
+			return nil, fmt.Errorf("invalid gateway \"%s\" (expected an address of the destination's family)", gateway)
+		}
+	} else if dst.IP.To4() != nil {
+		// Routes without gateway are directly connected (as with iproute2)
+		route.Scope = netlink.SCOPE_LINK
+	}
+
+	if source != "" {
+		route.Src = net.ParseIP(source)
+		if route.Src == nil || (route.Src.To4() == nil) != (dst.IP.To4() == nil) {
+			return nil, fmt.Errorf("invalid source \"%s\" (expected an address of the destination's family)", source)
+		}
+	}
+
+	return route, nil
+}
+
+// Returns the destination network of a route (the kernel omits it for default routes)
+func routeDestination(route NetworkRoute) *net.IPNet {
+	if route.Dst != nil {
+		return route.Dst
+	}
+
+	if route.Gw.To4() != nil || route.Src.To4() != nil {
+		return &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
+	}
+	return &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
+}
+
+// Checks whether a network contains an ip address
+func networksContain(networks []IPNetwork, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks whether a route policy applies to a client identity (a policy
+// without identities applies to every client)
+func (rp RoutePolicy) AppliesTo(identity ClientIdentity) bool {
+	return matchesAnyIdentity(rp.Identities, identity)
+}
+
+// Checks whether a route on an interface is allowed by a route policy (its
+// destination must be part of the policy's destination network, a policy
+// without tables only allows the main table and gateways and source hints
+// must be part of the allowed networks)
+func (rp RoutePolicy) Allows(interfaceName string, route NetworkRoute) bool {
+	dst := routeDestination(route)
+	dstOnes, dstBits := dst.Mask.Size()
+	policyOnes, policyBits := rp.Destination.Mask.Size()
+	if dstBits != policyBits || dstOnes < policyOnes || !rp.Destination.Contains(dst.IP) {
+		return false
+	}
+
+	if !rp.InterfaceNameRegex.MatchString(interfaceName) {
+		return false
+	}
+
+	if len(rp.Tables) == 0 {
+		if route.Table != unix.RT_TABLE_MAIN {
+			return false
+		}
+	} else if !containsInt(rp.Tables, route.Table) {
+		return false
+	}
+
+	if route.Gw != nil && !networksContain(rp.Gateways, route.Gw) {
+		return false
+	}
+
+	if route.Src != nil && !networksContain(rp.Sources, route.Src) {
+		return false
+	}
+
+	return true
+}
+
+// Checks whether a slice of integers contains a value
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the route policies, that apply to a client identity
+func RoutePoliciesForIdentity(policies []RoutePolicy, identity ClientIdentity) []RoutePolicy {
+	var identityPolicies []RoutePolicy
+	for _, p := range policies {
+		if p.AppliesTo(identity) {
+			identityPolicies = append(identityPolicies, p)
+		}
+	}
+	return identityPolicies
+}
+
+// Checks whether any of the route policies allows a route on an interface
+func routePoliciesAllow(policy []RoutePolicy, interfaceName string, route NetworkRoute) bool {
+	for _, p := range policy {
+		if p.Allows(interfaceName, route) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the routes present on a network link in a routing table (all tables
+// for table zero)
+func ListRoutes(link NetworkLink, family int, table int) ([]NetworkRoute, error) {
+	existingRoutes, err := link.Namespace.netlinkHandle().RouteListFiltered(family, &netlink.Route{
+		LinkIndex: (*link).Attrs().Index,
+		Table: table,
+	}, netlink.RT_FILTER_OIF | netlink.RT_FILTER_TABLE)
+	if err != nil {
+		zap.L().Error("Error while retreiving existing routes on interface",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	routes := make([]NetworkRoute, 0, len(existingRoutes))
+	for i := range existingRoutes {
+		// Local, broadcast and multicast routes are maintained by the kernel
+		if existingRoutes[i].Type == unix.RTN_UNICAST {
+			routes = append(routes, &existingRoutes[i])
+		}
+	}
+
+	return routes, nil
+}
+
+// Returns a route present on a network link, that has the same destination,
+// table, gateway and source hint as the given one (a metric of zero matches
+// any metric), or nil, if there is none
+func findRoute(link NetworkLink, route NetworkRoute) (NetworkRoute, error) {
+	family := netlink.FAMILY_V6
+	if route.Dst.IP.To4() != nil {
+		family = netlink.FAMILY_V4
+	}
+
+	existingRoutes, err := ListRoutes(link, family, route.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, existingRoute := range existingRoutes {
+		existingDst := routeDestination(existingRoute)
+		if existingDst.String() == route.Dst.String() &&
+			existingRoute.Gw.Equal(route.Gw) &&
+			existingRoute.Src.Equal(route.Src) &&
+			(route.Priority == 0 || existingRoute.Priority == route.Priority) {
+			return existingRoute, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Adds a route to a network link
+func AddRoute(link NetworkLink, route NetworkRoute) error {
+	existingRoute, err := findRoute(link, route)
+	if err != nil {
+		return err
+	}
+	if existingRoute != nil {
+		zap.L().Info("Route already exists on interface",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.Stringer("destination", route.Dst),
+		)
+		return nil
+	}
+
+	route.LinkIndex = (*link).Attrs().Index
+
+	err = link.Namespace.netlinkHandle().RouteAdd(route)
+	if err != nil {
+		zap.L().Error("Failed to add route to interface",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.Stringer("destination", route.Dst),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	zap.L().Info("Added route to interface",
+		zap.String("interface-name", (*link).Attrs().Name),
+		zap.Stringer("destination", route.Dst),
+		zap.Int("table", route.Table),
+	)
+
+	return nil
+}
+
+// Removes a route from a network link
+func DeleteRoute(link NetworkLink, route NetworkRoute) error {
+	existingRoute, err := findRoute(link, route)
+	if err != nil {
+		return err
+	}
+	if existingRoute == nil {
+		zap.L().Info("Route is already gone from interface",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.Stringer("destination", route.Dst),
+		)
+		return nil
+	}
+
+	err = link.Namespace.netlinkHandle().RouteDel(existingRoute)
+	if err != nil {
+		zap.L().Error("Failed to delete route from interface",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.Stringer("destination", route.Dst),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	zap.L().Info("Deleted route from interface",
+		zap.String("interface-name", (*link).Attrs().Name),
+		zap.Stringer("destination", route.Dst),
+		zap.Int("table", route.Table),
+	)
+
+	return nil
+}
+
+// Describes a route present on a network link
+func DescribeRoute(link NetworkLink, route NetworkRoute) RouteInfo {
+	info := RouteInfo{
+		Destination: routeDestination(route).String(),
+		InterfaceName: (*link).Attrs().Name,
+		Table: route.Table,
+		Metric: route.Priority,
+		Scope: addressScopeNames[int(route.Scope)],
+	}
+
+	if route.Gw != nil {
+		info.Gateway = route.Gw.String()
+	}
+	if route.Src != nil {
+		info.Source = route.Src.String()
+	}
+	if info.Scope == "" {
+		info.Scope = fmt.Sprintf("%d", route.Scope)
+	}
+
+	return info
+}
+
+// Handles an authenticated request for adding or deleting a route
+func (s *Server) handleRouteRequest(w http.ResponseWriter, r *http.Request, requestAction string, routePolicy []RoutePolicy) {
+	if !checkRequestMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var rd RouteRequestData
+	if !decodeRequestBody(w, r, requestAction, &rd) {
+		return
+	}
+
+	if rd.Destination == "" {
+		zap.L().Error("Validation of request body failed: Destination is missing in request",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Destination (\"destination\") is missing in request", nil, Response{})
+		return
+	}
+
+	if rd.InterfaceName == "" {
+		zap.L().Error("Validation of request body failed: Interface name is missing in request",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Interface name (\"interface_name\") is missing in request", nil, Response{})
+		return
+	}
+
+	route, err := ParseRoute(rd.Destination, rd.Gateway, rd.Source, rd.Table, rd.Metric)
+	if err != nil {
+		zap.L().Error("Failed to parse route",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+			zap.String("destination", rd.Destination),
+			zap.Error(err),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Failed to parse route", err, Response{
+			InterfaceName: rd.InterfaceName,
+		})
+		return
+	}
+
+	if !routePoliciesAllow(routePolicy, rd.InterfaceName, route) {
+		zap.L().Error("Rejected route for interface, because no matching policy was found",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+			zap.Stringer("destination", route.Dst),
+			zap.Int("table", route.Table),
+		)
+		writeError(w, r, http.StatusForbidden, ErrorCodePolicyDenied, "Rejected route for interface, because no matching policy was found", nil, Response{
+			InterfaceName: rd.InterfaceName,
+		})
+		return
+	}
+
+	link, err := LinkByName(rd.InterfaceName)
+	if err != nil {
+		zap.L().Error("Failed to retreive interface",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+			zap.String("interface-name", rd.InterfaceName),
+			zap.Error(err),
+		)
+		writeError(w, r, linkErrorStatus(err), linkErrorCode(err), "Failed to retreive interface", err, Response{
+			InterfaceName: rd.InterfaceName,
+		})
+		return
+	}
+
+	response := Response{
+		InterfaceName: (*link).Attrs().Name,
+		InterfaceIndex: (*link).Attrs().Index,
+		Data: DescribeRoute(link, route),
+	}
+
+	switch requestAction {
+	case "add":
+		if err := AddRoute(link, route); err != nil {
+			writeError(w, r, http.StatusInternalServerError, ErrorCodeNetlinkFailure, "Failed to add route to interface", err, response)
+			return
+		}
+		response.Message = "Successfully added route to interface"
+	case "delete":
+		if err := DeleteRoute(link, route); err != nil {
+			writeError(w, r, http.StatusInternalServerError, ErrorCodeNetlinkFailure, "Failed to delete route from interface", err, response)
+			return
+		}
+		response.Message = "Successfully deleted route from interface"
+	}
+
+	writeSuccess(w, r, response)
+}
+
+// Handles an authenticated request for listing the managed routes
+func (s *Server) handleListRoutesRequest(w http.ResponseWriter, r *http.Request, routePolicy []RoutePolicy) {
+	if !checkRequestMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	query := r.URL.Query()
+	interfaceName := query.Get("interface_name")
+
+	family, err := ParseAddressFamily(query.Get("family"))
+	if err != nil {
+		zap.L().Error("Validation of request query failed: Invalid address family",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("family", query.Get("family")),
+			zap.Error(err),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Failed to parse address family", err, Response{})
+		return
+	}
+
+	table := 0
+	if query.Get("table") != "" {
+		table, err = strconv.Atoi(query.Get("table"))
+		if err == nil && table <= 0 {
+			err = errors.New("routing table must be positive")
+		}
+		if err != nil {
+			zap.L().Error("Validation of request query failed: Invalid routing table",
+				zap.String("remote-addr", r.RemoteAddr),
+				zap.String("table", query.Get("table")),
+				zap.Error(err),
+			)
+			writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Failed to parse routing table", err, Response{})
+			return
+		}
+	}
+
+	var links []NetworkLink
+	if interfaceName != "" {
+		link, err := LinkByName(interfaceName)
+		if err != nil {
+			zap.L().Error("Failed to retreive interface",
+				zap.String("remote-addr", r.RemoteAddr),
+				zap.String("interface-name", interfaceName),
+				zap.Error(err),
+			)
+			writeError(w, r, linkErrorStatus(err), linkErrorCode(err), "Failed to retreive interface", err, Response{
+				InterfaceName: interfaceName,
+			})
+			return
+		}
+		links = []NetworkLink{link}
+	} else {
+		links, err = ListLinks()
+		if err != nil {
+			zap.L().Error("Failed to retreive interfaces",
+				zap.String("remote-addr", r.RemoteAddr),
+				zap.Error(err),
+			)
+			writeError(w, r, http.StatusInternalServerError, ErrorCodeNetlinkFailure, "Failed to retreive interfaces", err, Response{})
+			return
+		}
+	}
+
+	routeList := RouteList{Routes: []RouteInfo{}}
+	for _, link := range links {
+		routes, err := ListRoutes(link, family, table)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, ErrorCodeNetlinkFailure, "Failed to retreive routes of interface", err, Response{
+				InterfaceName: (*link).Attrs().Name,
+			})
+			return
+		}
+
+		for _, route := range routes {
+			// Only show routes, that could be managed by the client
+			if routePoliciesAllow(routePolicy, (*link).Attrs().Name, route) {
+				routeList.Routes = append(routeList.Routes, DescribeRoute(link, route))
+			}
+		}
+	}
+
+	writeSuccess(w, r, Response{
+		Message: fmt.Sprintf("Found %d managed routes", len(routeList.Routes)),
+		InterfaceName: interfaceName,
+		Data: routeList,
+	})
+}
@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestParseRoute(t *testing.T) {
+	route, err := ParseRoute("198.51.100.0/24", "", "", 0, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, route.Dst.String(), "198.51.100.0/24")
+	assert.Equal(t, route.Table, 254)
+	assert.Equal(t, int(route.Scope), 253)
+
+	route, err = ParseRoute("fd69:decd:7b66:8220::/64", "fd69:decd:7b66:8221::1", "fd69:decd:7b66:8221::2", 100, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, route.Gw.String(), "fd69:decd:7b66:8221::1")
+	assert.Equal(t, route.Src.String(), "fd69:decd:7b66:8221::2")
+	assert.Equal(t, route.Table, 100)
+	assert.Equal(t, route.Priority, 10)
+
+	_, err = ParseRoute("198.51.100.0", "", "", 0, 0)
+	assert.ErrorContains(t, err, "invalid CIDR address")
+
+	_, err = ParseRoute("198.51.100.0/24", "fd69:decd:7b66:8221::1", "", 0, 0)
+	assert.ErrorContains(t, err, "invalid gateway")
+
+	_, err = ParseRoute("198.51.100.0/24", "", "", -1, 0)
+	assert.ErrorContains(t, err, "invalid routing table")
+}
+
+func TestRoutePolicyAllows(t *testing.T) {
+	_, destination, err := net.ParseCIDR("198.51.100.0/24")
+	assert.NilError(t, err)
+	_, gateways, err := net.ParseCIDR("192.0.2.0/28")
+	assert.NilError(t, err)
+
+	policy := RoutePolicy{
+		Destination: IPNetwork{*destination},
+		InterfaceNameRegex: Regexp{*regexp.MustCompile("^eth0$")},
+		Gateways: []IPNetwork{IPNetwork{*gateways}},
+	}
+
+	for _, tc := range []struct {
+		destination string
+		gateway string
+		source string
+		table int
+		allowed bool
+	}{
+		{"198.51.100.0/24", "", "", 0, true},
+		{"198.51.100.10/32", "192.0.2.1", "", 0, true},
+		{"198.51.0.0/16", "", "", 0, false},
+		{"198.51.100.0/24", "192.0.2.20", "", 0, false},
+		{"198.51.100.0/24", "", "198.51.100.1", 0, false},
+		{"198.51.100.0/24", "", "", 100, false},
+	} {
+		route, err := ParseRoute(tc.destination, tc.gateway, tc.source, tc.table, 0)
+		assert.NilError(t, err)
+		assert.Equal(t, policy.Allows("eth0", route), tc.allowed, tc.destination)
+	}
+
+	route, err := ParseRoute("198.51.100.0/24", "", "", 0, 0)
+	assert.NilError(t, err)
+	assert.Assert(t, !policy.Allows("eth1", route))
+
+	policy.Tables = []int{100}
+	assert.Assert(t, !policy.Allows("eth0", route))
+	route.Table = 100
+	assert.Assert(t, policy.Allows("eth0", route))
+}
+
+func TestAddListAndDeleteRoute(t *testing.T) {
+	assert.Assert(t, os.Getenv("NET_LINK") != "")
+
+	_, destination, err := net.ParseCIDR("198.51.100.0/24")
+	assert.NilError(t, err)
+
+	server := &Server{
+		RoutePolicies: []RoutePolicy{
+			{
+				Destination: IPNetwork{*destination},
+				InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")},
+				Tables: []int{100},
+			},
+		},
+	}
+
+	rd := RouteRequestData{
+		Destination: "198.51.100.0/25",
+		InterfaceName: os.Getenv("NET_LINK"),
+		Table: 100,
+	}
+
+	status, response := sendPostRequest(t, server, "/routes/add", rd)
+	assert.Equal(t, status, http.StatusOK, response.Message)
+
+	// Adding it again is a no-op
+	status, _ = sendPostRequest(t, server, "/routes/add", rd)
+	assert.Equal(t, status, http.StatusOK)
+
+	listRoutes := func() []RouteInfo {
+		req, err := http.NewRequest("GET", "/routes?table=100&interface_name=" + os.Getenv("NET_LINK"), nil)
+		assert.NilError(t, err)
+
+		rr := httptest.NewRecorder()
+		server.handleRequest(rr, req)
+		assert.Equal(t, rr.Code, http.StatusOK)
+
+		var response struct {
+			Response
+			Data RouteList `json:"data"`
+		}
+		assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		return response.Data.Routes
+	}
+
+	routes := listRoutes()
+	assert.Equal(t, len(routes), 1)
+	assert.Equal(t, routes[0].Destination, "198.51.100.0/25")
+	assert.Equal(t, routes[0].Table, 100)
+	assert.Equal(t, routes[0].Scope, "link")
+
+	// The main table isn't allowed by the policy
+	status, response = sendPostRequest(t, server, "/routes/add", RouteRequestData{
+		Destination: "198.51.100.0/25",
+		InterfaceName: os.Getenv("NET_LINK"),
+	})
+	assert.Equal(t, status, http.StatusForbidden)
+	assert.Equal(t, response.Error.Code, ErrorCodePolicyDenied)
+
+	status, _ = sendPostRequest(t, server, "/routes/delete", rd)
+	assert.Equal(t, status, http.StatusOK)
+	assert.Equal(t, len(listRoutes()), 0)
+
+	// Deleting it again is a no-op
+	status, _ = sendPostRequest(t, server, "/routes/delete", rd)
+	assert.Equal(t, status, http.StatusOK)
+}
@@ -6,24 +6,126 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"net/netip"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 )
 
+// Holds the state shared by the request handlers
+type Server struct {
+	AddressPolicies []AddressPolicy
+	RoutePolicies []RoutePolicy
+	ProxyPolicies []ProxyPolicy
+	NeighbourPolicies []NeighbourPolicy
+	Store *Store
+	Events *EventLog
+	// Serializes allocations, releases and lease changes
+	mutex sync.Mutex
+	// Addresses picked by allocations, that are being added
+	reserved map[string]map[netip.Addr]bool
+	// Guards the policies and the TLS material, which are swapped on reload
+	configMutex sync.RWMutex
+	configFilePath string
+	config *Config
+	certificate *tls.Certificate
+	clientCACertificatePool *x509.CertPool
+	revocation *RevocationChecker
+	watcher *Watcher
+}
+
 type RequestData struct {
 	Address string `json:"address"`
 	InterfaceName string `json:"interface_name"`
+	LeaseDuration int `json:"lease_duration"`
+	Netns string `json:"netns"`
+	AddressOptions
+}
+
+// Holds the list of addresses returned by a list request
+type AddressList struct {
+	Addresses []AddressInfo `json:"addresses"`
+}
+
+// Renders the address list as plain text (one address per line)
+func (al AddressList) PlainText() string {
+	var sb strings.Builder
+	for _, a := range al.Addresses {
+		fmt.Fprintf(&sb, "%s %s scope %s\n", a.InterfaceName, a.Address, a.Scope)
+	}
+	return sb.String()
+}
+
+// Maps an error of a network link lookup to an error code
+func linkErrorCode(err error) ErrorCode {
+	if IsLinkNotFound(err) {
+		return ErrorCodeLinkNotFound
+	}
+	return ErrorCodeNetlinkFailure
+}
+
+// Maps an error of a network link lookup to a http status code (a missing
+// interface is an error of the client)
+func linkErrorStatus(err error) int {
+	if IsLinkNotFound(err) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
 }
 
-// Checks the authenticity of a request
-func authenticateRequest(w http.ResponseWriter, r *http.Request, clientCACertificatePool *x509.CertPool) bool {
+// Maps an error of an address operation to an error code
+func addressErrorCode(err error) ErrorCode {
+	var advertiseError *AdvertiseError
+	if errors.As(err, &advertiseError) {
+		return ErrorCodeAdvertiseFailed
+	}
+	var storeError *StoreError
+	if errors.As(err, &storeError) {
+		return ErrorCodeStoreFailure
+	}
+	var duplicateAddressError *DuplicateAddressError
+	if errors.As(err, &duplicateAddressError) {
+		return ErrorCodeAddressConflict
+	}
+	var addressOptionConflictError *AddressOptionConflictError
+	if errors.As(err, &addressOptionConflictError) {
+		return ErrorCodeAddressConflict
+	}
+	var dadTimeoutError *DADTimeoutError
+	if errors.As(err, &dadTimeoutError) {
+		return ErrorCodeDADTimeout
+	}
+	var addressLimitError *AddressLimitError
+	if errors.As(err, &addressLimitError) {
+		return ErrorCodeAddressLimitExceeded
+	}
+	return ErrorCodeNetlinkFailure
+}
+
+// Maps an error of an address operation to a http status code
+func addressErrorStatus(err error) int {
+	switch addressErrorCode(err) {
+	case ErrorCodeAddressConflict:
+		return http.StatusConflict
+	case ErrorCodeAddressLimitExceeded:
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// Checks the authenticity of a request (including the revocation status of
+// the client certificate)
+func authenticateRequest(w http.ResponseWriter, r *http.Request, clientCACertificatePool *x509.CertPool, revocation *RevocationChecker, options TLSOptions) bool {
 	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
 		zap.L().Error("Rejecting request, because no client certificate was send",
 			zap.String("remote-addr", r.RemoteAddr),
 		)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, ErrorCodeUnauthorized, "Unauthorized", nil, Response{})
 		return false
 	}
 
@@ -33,22 +135,46 @@ func authenticateRequest(w http.ResponseWriter, r *http.Request, clientCACertifi
 		Roots: clientCACertificatePool,
 		Intermediates: x509.NewCertPool(),
 	}
+	if options.verifiesClientAuthUsage() {
+		opts.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
 
 	for _, clientIntermediateCertificate := range r.TLS.PeerCertificates[1:] {
 		opts.Intermediates.AddCert(clientIntermediateCertificate)
 	}
 
-	if _, err := clientCertificate.Verify(opts); err != nil {
+	chains, err := clientCertificate.Verify(opts)
+	if err != nil {
 		zap.L().Error("Rejecting request, because verification of client certificate failed",
 			zap.String("remote-addr", r.RemoteAddr),
 			zap.Error(err),
 		)
-		http.Error(w, "Access denied", http.StatusForbidden)
+		writeError(w, r, http.StatusForbidden, ErrorCodeAccessDenied, "Access denied", nil, Response{})
+		return false
+	}
+
+	if options.RequireClientAuthEKU && !hasClientAuthUsage(clientCertificate) {
+		zap.L().Error("Rejecting request, because the client certificate isn't meant for client authentication",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.Stringer("identity", IdentityFromCertificate(clientCertificate)),
+		)
+		writeError(w, r, http.StatusForbidden, ErrorCodeAccessDenied, "Access denied", nil, Response{})
+		return false
+	}
+
+	if err := revocation.Check(chains[0]); err != nil {
+		zap.L().Error("Rejecting request, because revocation check of client certificate failed",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.Stringer("identity", IdentityFromCertificate(clientCertificate)),
+			zap.Error(err),
+		)
+		writeError(w, r, http.StatusForbidden, ErrorCodeAccessDenied, "Access denied", nil, Response{})
 		return false
 	}
 
 	zap.L().Debug("Accepting request with valid client certificate",
 		zap.String("remote-addr", r.RemoteAddr),
+		zap.Stringer("identity", IdentityFromCertificate(clientCertificate)),
 		zap.String("method", r.Method),
 		zap.String("path", r.URL.Path),
 	)
@@ -56,47 +182,108 @@ func authenticateRequest(w http.ResponseWriter, r *http.Request, clientCACertifi
 }
 
 // Handles an authenticated request
-func handleRequest(w http.ResponseWriter, r *http.Request, policy []AddressPolicy) {
+func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
+	identity := requestIdentity(r)
+
 	zap.L().Debug("Handling request",
 		zap.String("remote-addr", r.RemoteAddr),
+		zap.Stringer("identity", identity),
 		zap.String("method", r.Method),
 		zap.String("path", r.URL.Path),
 	)
 
-	var requestAction string
+	// The policies are taken once, so a reload doesn't change them mid-request
+	s.configMutex.RLock()
+	addressPolicies, routePolicies, proxyPolicies, neighbourPolicies := s.AddressPolicies, s.RoutePolicies, s.ProxyPolicies, s.NeighbourPolicies
+	s.configMutex.RUnlock()
+
+	// Only the policies bound to the identity of the client are considered
+	policy := PoliciesForIdentity(addressPolicies, identity)
+
+	// Requests, that can't target another network namespace, only operate in
+	// the server's own one
+	ownPolicy := PoliciesForNamespace(policy, "")
+
+	routePolicy := RoutePoliciesForIdentity(routePolicies, identity)
+	proxyPolicy := ProxyPoliciesForIdentity(proxyPolicies, identity)
+	neighbourPolicy := NeighbourPoliciesForIdentity(neighbourPolicies, identity)
+
 	switch r.URL.Path {
+	case "/addresses":
+		if r.Method == http.MethodPut {
+			s.handleDesiredStateRequest(w, r, ownPolicy)
+		} else {
+			s.handleListAddressesRequest(w, r, policy)
+		}
 	case "/add":
-		requestAction = "add"
+		s.handleAddressRequest(w, r, "add", policy)
 	case "/delete":
-		requestAction = "delete"
+		s.handleAddressRequest(w, r, "delete", policy)
+	case "/allocate":
+		s.handleAllocateRequest(w, r, policy)
+	case "/release":
+		s.handleReleaseRequest(w, r, policy)
+	case "/renew":
+		s.handleRenewRequest(w, r, ownPolicy)
+	case "/advertise":
+		s.handleAdvertiseRequest(w, r, policy)
+	case "/routes":
+		s.handleListRoutesRequest(w, r, routePolicy)
+	case "/routes/add":
+		s.handleRouteRequest(w, r, "add", routePolicy)
+	case "/routes/delete":
+		s.handleRouteRequest(w, r, "delete", routePolicy)
+	case "/proxy":
+		s.handleListProxyEntriesRequest(w, r, proxyPolicy)
+	case "/proxy/add":
+		s.handleProxyRequest(w, r, "add", proxyPolicy)
+	case "/proxy/delete":
+		s.handleProxyRequest(w, r, "delete", proxyPolicy)
+	case "/neighbours":
+		s.handleListNeighboursRequest(w, r, neighbourPolicy)
+	case "/neighbours/add":
+		s.handleNeighbourRequest(w, r, "add", neighbourPolicy)
+	case "/neighbours/delete":
+		s.handleNeighbourRequest(w, r, "delete", neighbourPolicy)
+	case "/policy/check":
+		s.handlePolicyCheckRequest(w, r, policy)
+	case "/batch":
+		s.handleBatchRequest(w, r, ownPolicy)
+	case "/events":
+		s.handleEventsRequest(w, r, ownPolicy)
 	default:
 		zap.L().Error("Requested path not found",
 			zap.String("remote-addr", r.RemoteAddr),
 			zap.String("path", r.URL.Path),
 		)
-		http.Error(w, "Path not found", http.StatusNotFound)
-		return
+		writeError(w, r, http.StatusNotFound, ErrorCodePathNotFound, "Path not found", nil, Response{})
 	}
+}
 
-	if r.Method != http.MethodPost {
+// Checks the method of a request
+func checkRequestMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
 		zap.L().Error("Invalid request method",
 			zap.String("remote-addr", r.RemoteAddr),
 			zap.String("path", r.URL.Path),
 			zap.String("method", r.Method),
 		)
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
+		writeError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "Method Not Allowed", nil, Response{})
+		return false
 	}
 
-	var rd RequestData
+	return true
+}
 
+// Decodes the json body of a request
+func decodeRequestBody(w http.ResponseWriter, r *http.Request, requestAction string, v interface{}) bool {
 	if r.Body == nil {
 		zap.L().Error("Request body is empty",
 			zap.String("remote-addr", r.RemoteAddr),
 			zap.String("action", requestAction),
 		)
-		http.Error(w, "Request body is empty", http.StatusBadRequest)
-		return
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Request body is empty", nil, Response{})
+		return false
 	}
 
 	contentType := r.Header.Get("Content-Type")
@@ -106,18 +293,32 @@ func handleRequest(w http.ResponseWriter, r *http.Request, policy []AddressPolic
 			zap.String("action", requestAction),
 			zap.String("content-type", contentType),
 		)
-		http.Error(w, "Invalid content type (expected \"application/json\")", http.StatusBadRequest)
-		return
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Invalid content type (expected \"application/json\")", nil, Response{})
+		return false
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&rd)
+	err := json.NewDecoder(r.Body).Decode(v)
 	if err != nil {
 		zap.L().Error("Invalid request body format",
 			zap.String("remote-addr", r.RemoteAddr),
 			zap.String("action", requestAction),
 			zap.Error(err),
 		)
-		http.Error(w, fmt.Sprintf("Failed to parse request body: %v", err), http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Failed to parse request body", err, Response{})
+		return false
+	}
+
+	return true
+}
+
+// Handles an authenticated request for adding or deleting an address
+func (s *Server) handleAddressRequest(w http.ResponseWriter, r *http.Request, requestAction string, policy []AddressPolicy) {
+	if !checkRequestMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var rd RequestData
+	if !decodeRequestBody(w, r, requestAction, &rd) {
 		return
 	}
 
@@ -125,9 +326,8 @@ func handleRequest(w http.ResponseWriter, r *http.Request, policy []AddressPolic
 		zap.L().Error("Validation of request body failed: Address is missing in request",
 			zap.String("remote-addr", r.RemoteAddr),
 			zap.String("action", requestAction),
-			zap.Error(err),
 		)
-		http.Error(w, "Address (\"address\") is missing in request", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Address (\"address\") is missing in request", nil, Response{})
 		return
 	}
 
@@ -135,9 +335,8 @@ func handleRequest(w http.ResponseWriter, r *http.Request, policy []AddressPolic
 		zap.L().Error("Validation of request body failed: Interface name is missing in request",
 			zap.String("remote-addr", r.RemoteAddr),
 			zap.String("action", requestAction),
-			zap.Error(err),
 		)
-		http.Error(w, "Interface name (\"interface_name\") is missing in request", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Interface name (\"interface_name\") is missing in request", nil, Response{})
 		return
 	}
 
@@ -149,42 +348,72 @@ func handleRequest(w http.ResponseWriter, r *http.Request, policy []AddressPolic
 			zap.String("address", rd.Address),
 			zap.Error(err),
 		)
-		http.Error(w, fmt.Sprintf("Failed to parse cidr address: %v", err), http.StatusInternalServerError)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeAddressParseError, "Failed to parse cidr address", err, Response{
+			InterfaceName: rd.InterfaceName,
+		})
 		return
 	}
 
-	policyPassed := false
-	for _, p := range policy {
-		if p.Allows(rd.InterfaceName, address) {
-			policyPassed = true
-		}
+	ns, policy, ok := openRequestNamespace(w, r, requestAction, policy, rd.Netns, Response{
+		Address: address.IPNet.String(),
+		InterfaceName: rd.InterfaceName,
+		Netns: rd.Netns,
+	})
+	if !ok {
+		return
 	}
-
-	if !policyPassed {
-		zap.L().Error("Rejected cidr address for interface, because no matching policy was found",
-			zap.String("remote-addr", r.RemoteAddr),
-			zap.String("action", requestAction),
-			zap.String("address", rd.Address),
-		)
-		http.Error(w, "Rejected cidr address for interface, because no matching policy was found", http.StatusForbidden)
+	defer ns.Close()
+
+	if decision := checkAddressPolicies(r, requestAction, policiesBeforeLink(policy), rd.InterfaceName, address); !decision.Allowed {
+		writeError(w, r, http.StatusForbidden, ErrorCodePolicyDenied, "Rejected cidr address for interface, because " + decision.Reason(), nil, Response{
+			Address: address.IPNet.String(),
+			InterfaceName: rd.InterfaceName,
+			Netns: rd.Netns,
+		})
 		return
 	}
 
-	link, err := LinkByName(rd.InterfaceName)
+	link, err := ns.LinkByName(rd.InterfaceName)
 	if err != nil {
 		zap.L().Error("Failed to retreive interface",
 			zap.String("remote-addr", r.RemoteAddr),
 			zap.String("action", requestAction),
 			zap.String("interface-name", rd.InterfaceName),
+			zap.String("netns", rd.Netns),
 			zap.Error(err),
 		)
-		http.Error(w, fmt.Sprintf("Failed to retreive interface: %v", err), http.StatusInternalServerError)
+		writeError(w, r, linkErrorStatus(err), linkErrorCode(err), "Failed to retreive interface", err, Response{
+			Address: address.IPNet.String(),
+			InterfaceName: rd.InterfaceName,
+			Netns: rd.Netns,
+		})
+		return
+	}
+
+	response := Response{
+		Address: address.IPNet.String(),
+		InterfaceName: (*link).Attrs().Name,
+		InterfaceIndex: (*link).Attrs().Index,
+		Netns: rd.Netns,
+	}
+
+	policy, ok = checkLinkPolicies(w, r, requestAction, policy, link, address, response)
+	if !ok {
 		return
 	}
 
 	switch requestAction {
 	case "add":
-		err = AddAddress(link, address)
+		if !applyAddressOptions(w, r, requestAction, policy, rd.AddressOptions, address, response) {
+			return
+		}
+
+		expiresAt, ok := s.leaseExpiry(w, r, requestAction, rd.LeaseDuration, rd.AddressOptions, response)
+		if !ok {
+			return
+		}
+
+		err = s.addAddress(link, address, policy, expiresAt, requestIdentity(r).String())
 		if err != nil {
 			zap.L().Error("Failed to add cidr address to interface",
 				zap.String("remote-addr", r.RemoteAddr),
@@ -193,12 +422,18 @@ func handleRequest(w http.ResponseWriter, r *http.Request, policy []AddressPolic
 				zap.String("address", rd.Address),
 				zap.Error(err),
 			)
-			http.Error(w, fmt.Sprintf("Failed to add cidr address to interface: %v", err), http.StatusInternalServerError)
+			writeError(w, r, addressErrorStatus(err), addressErrorCode(err), "Failed to add cidr address to interface", err, response)
 			return
 		}
-		fmt.Fprintf(w, "Successfully added address to interface\n")
+		response.Message = "Successfully added address to interface"
+		if expiresAt != nil {
+			response.Data = Lease{ExpiresAt: *expiresAt}
+		}
+		writeSuccess(w, r, response)
 	case "delete":
-		err = DeleteAddress(link, address)
+		s.mutex.Lock()
+		err = s.deleteAddress(link, address)
+		s.mutex.Unlock()
 		if err != nil {
 			zap.L().Error("Failed to delete cidr address from interface",
 				zap.String("remote-addr", r.RemoteAddr),
@@ -207,21 +442,340 @@ func handleRequest(w http.ResponseWriter, r *http.Request, policy []AddressPolic
 				zap.String("address", rd.Address),
 				zap.Error(err),
 			)
-			http.Error(w, fmt.Sprintf("Failed to delete cidr address from interface: %v", err), http.StatusInternalServerError)
+			writeError(w, r, http.StatusInternalServerError, addressErrorCode(err), "Failed to delete cidr address from interface", err, response)
+			return
+		}
+		response.Message = "Successfully deleted address from interface"
+		writeSuccess(w, r, response)
+	}
+}
+
+// Adds a cidr address to a network link on behalf of a client within the
+// address limits of the policies and records it in the store with the expiry
+// of its lease (nil for addresses without lease) and its owner. The mutex of
+// the server must not be held: it's only taken for checking the limits and
+// adding the address, but not while probing for other hosts using it or
+// waiting for the duplicate address detection
+func (s *Server) addAddress(link NetworkLink, address CIDRAddress, policy []AddressPolicy, expiresAt *time.Time, owner string) error {
+	policies := PoliciesForLink(PoliciesForNamespace(s.addressPolicies(), link.Namespace.String()), link)
+	advertisement := advertisementFor(policies, (*link).Attrs().Name, address)
+
+	s.mutex.Lock()
+	err := s.checkAddressLimits(link, address, policy, owner)
+	s.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := probeNewAddress(link, address, advertisement); err != nil {
+		return err
+	}
+
+	// Other requests may have reached a limit while probing
+	s.mutex.Lock()
+	added, err := s.claimAddress(link, address, policy, expiresAt, owner)
+	s.mutex.Unlock()
+	if err != nil || !added {
+		return err
+	}
+
+	err = settleAddress(link, address, advertisement)
+	if isDADFailure(err) {
+		// The record is removed first, so the watcher doesn't re-assert the address
+		s.mutex.Lock()
+		if link.Namespace == nil {
+			s.Store.Remove((*link).Attrs().Name, address)
+		}
+		removeFailedAddress(link, address)
+		s.mutex.Unlock()
+	}
+
+	// The address is present, even if it couldn't be advertised
+	return err
+}
+
+// Adds a cidr address to a network link within the address limits of the
+// policies and records it (the mutex of the server must be held) and returns,
+// whether it was added (false, if it was already present)
+func (s *Server) claimAddress(link NetworkLink, address CIDRAddress, policy []AddressPolicy, expiresAt *time.Time, owner string) (bool, error) {
+	if err := s.checkAddressLimits(link, address, policy, owner); err != nil {
+		return false, err
+	}
+
+	added, err := claimAddress(link, address)
+	if err != nil {
+		return false, err
+	}
+
+	// The store only holds addresses of the server's network namespace
+	if link.Namespace != nil {
+		return added, nil
+	}
+
+	// Addresses with a finite lifetime are removed by the kernel and must not be
+	// re-asserted or restored (even if they were recorded without lifetime)
+	if hasFiniteLifetime(address) {
+		if err := s.Store.Remove((*link).Attrs().Name, address); err != nil {
+			zap.L().Error("Failed to remove address from state store",
+				zap.String("interface-name", (*link).Attrs().Name),
+				zap.String("address", address.String()),
+				zap.Error(err),
+			)
+			return added, &StoreError{err}
+		}
+		return added, nil
+	}
+
+	if err := s.Store.Put((*link).Attrs().Name, address, expiresAt, owner); err != nil {
+		zap.L().Error("Failed to record address in state store",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.String("address", address.String()),
+			zap.Error(err),
+		)
+		return false, &StoreError{err}
+	}
+
+	return added, nil
+}
+
+// Checks whether a cidr address has a finite valid lifetime
+func hasFiniteLifetime(address CIDRAddress) bool {
+	return address.ValidLft > 0 && uint32(address.ValidLft) != math.MaxUint32
+}
+
+// Removes a cidr address from a network link and its record from the store
+func (s *Server) deleteAddress(link NetworkLink, address CIDRAddress) error {
+	if link.Namespace != nil {
+		return DeleteAddress(link, address)
+	}
+
+	// The record is removed first, so the watcher doesn't re-assert the address
+	record, recorded := s.Store.Record((*link).Attrs().Name, address)
+	if err := s.Store.Remove((*link).Attrs().Name, address); err != nil {
+		zap.L().Error("Failed to remove address from state store",
+			zap.String("interface-name", (*link).Attrs().Name),
+			zap.String("address", address.String()),
+			zap.Error(err),
+		)
+		return &StoreError{err}
+	}
+
+	if err := DeleteAddress(link, address); err != nil {
+		if recorded {
+			s.Store.PutRecord(record)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Applies the options to a cidr address, if they are valid and allowed by any
+// of the address policies allowing the address, or writes an error response
+func applyAddressOptions(w http.ResponseWriter, r *http.Request, requestAction string, policy []AddressPolicy, options AddressOptions, address CIDRAddress, response Response) bool {
+	if err := options.Apply(response.InterfaceName, address); err != nil {
+		zap.L().Error("Validation of request body failed: Invalid address options",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+			zap.Error(err),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Invalid address options", err, response)
+		return false
+	}
+
+	for _, p := range policy {
+		if p.Allows(response.InterfaceName, address) && p.AllowsOptions(options) {
+			return true
+		}
+	}
+
+	zap.L().Error("Rejected address options for interface, because no matching policy allows them",
+		zap.String("remote-addr", r.RemoteAddr),
+		zap.String("action", requestAction),
+		zap.String("address", address.IPNet.String()),
+	)
+	writeError(w, r, http.StatusForbidden, ErrorCodePolicyDenied, "Rejected address options for interface, because no matching policy allows them", nil, response)
+	return false
+}
+
+// Checks whether the address policies allow an interface name and address
+func policiesAllow(policy []AddressPolicy, interfaceName string, address CIDRAddress) bool {
+	return DecideAddress(policy, interfaceName, address).Allowed
+}
+
+// Evaluates the address policies for the address of a request and logs the
+// decision with the policy, that produced it
+func checkAddressPolicies(r *http.Request, requestAction string, policy []AddressPolicy, interfaceName string, address CIDRAddress) PolicyDecision {
+	decision := DecideAddress(policy, interfaceName, address)
+
+	if decision.Allowed {
+		zap.L().Info("Accepted cidr address for interface, because " + decision.Reason(),
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+			zap.String("interface-name", interfaceName),
+			zap.String("address", address.IPNet.String()),
+			zap.String("policy", decision.Policy),
+		)
+	} else {
+		zap.L().Error("Rejected cidr address for interface, because " + decision.Reason(),
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("action", requestAction),
+			zap.String("interface-name", interfaceName),
+			zap.String("address", address.IPNet.String()),
+			zap.String("policy", decision.Policy),
+			zap.String("outcome", decision.Outcome),
+		)
+	}
+
+	return decision
+}
+
+// Evaluates the address policies for the address of a request again with the
+// link matchers of the policies, once the interface is resolved, and returns
+// the policies applying to it, or writes an error response
+func checkLinkPolicies(w http.ResponseWriter, r *http.Request, requestAction string, policy []AddressPolicy, link NetworkLink, address CIDRAddress, response Response) ([]AddressPolicy, bool) {
+	if !hasLinkMatchers(policy) {
+		return policy, true
+	}
+
+	policy = PoliciesForLink(policy, link)
+	if decision := checkAddressPolicies(r, requestAction, policy, (*link).Attrs().Name, address); !decision.Allowed {
+		writeError(w, r, http.StatusForbidden, ErrorCodePolicyDenied, "Rejected cidr address for interface, because " + decision.Reason(), nil, response)
+		return nil, false
+	}
+
+	return policy, true
+}
+
+// Handles an authenticated request for listing the managed addresses
+func (s *Server) handleListAddressesRequest(w http.ResponseWriter, r *http.Request, policy []AddressPolicy) {
+	if !checkRequestMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	query := r.URL.Query()
+	interfaceName := query.Get("interface_name")
+	netnsName := query.Get("netns")
+
+	family, err := ParseAddressFamily(query.Get("family"))
+	if err != nil {
+		zap.L().Error("Validation of request query failed: Invalid address family",
+			zap.String("remote-addr", r.RemoteAddr),
+			zap.String("family", query.Get("family")),
+			zap.Error(err),
+		)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "Failed to parse address family", err, Response{})
+		return
+	}
+
+	ns, policy, ok := openRequestNamespace(w, r, "list", policy, netnsName, Response{
+		InterfaceName: interfaceName,
+		Netns: netnsName,
+	})
+	if !ok {
+		return
+	}
+	defer ns.Close()
+
+	var links []NetworkLink
+	if interfaceName != "" {
+		link, err := ns.LinkByName(interfaceName)
+		if err != nil {
+			zap.L().Error("Failed to retreive interface",
+				zap.String("remote-addr", r.RemoteAddr),
+				zap.String("interface-name", interfaceName),
+				zap.String("netns", netnsName),
+				zap.Error(err),
+			)
+			writeError(w, r, linkErrorStatus(err), linkErrorCode(err), "Failed to retreive interface", err, Response{
+				InterfaceName: interfaceName,
+				Netns: netnsName,
+			})
+			return
+		}
+		links = []NetworkLink{link}
+	} else {
+		links, err = ns.ListLinks()
+		if err != nil {
+			zap.L().Error("Failed to retreive interfaces",
+				zap.String("remote-addr", r.RemoteAddr),
+				zap.String("netns", netnsName),
+				zap.Error(err),
+			)
+			writeError(w, r, http.StatusInternalServerError, ErrorCodeNetlinkFailure, "Failed to retreive interfaces", err, Response{
+				Netns: netnsName,
+			})
 			return
 		}
-		fmt.Fprintf(w, "Successfully deleted address from interface\n")
 	}
+
+	addressList := AddressList{Addresses: []AddressInfo{}}
+	for _, link := range links {
+		addresses, err := ListAddresses(link, family)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, ErrorCodeNetlinkFailure, "Failed to retreive addresses of interface", err, Response{
+				InterfaceName: (*link).Attrs().Name,
+			})
+			return
+		}
+
+		linkPolicy := PoliciesForLink(policy, link)
+		for _, address := range addresses {
+			// Only show addresses, that could be managed by the client
+			if policiesAllow(linkPolicy, (*link).Attrs().Name, address) {
+				addressList.Addresses = append(addressList.Addresses, DescribeAddress(link, address))
+			}
+		}
+	}
+
+	writeSuccess(w, r, Response{
+		Message: fmt.Sprintf("Found %d managed addresses", len(addressList.Addresses)),
+		InterfaceName: interfaceName,
+		Netns: netnsName,
+		Data: addressList,
+	})
+}
+
+// Handles an authenticated request for listing the recent events
+func (s *Server) handleEventsRequest(w http.ResponseWriter, r *http.Request, policy []AddressPolicy) {
+	if !checkRequestMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	eventList := EventList{Events: []Event{}}
+	for _, event := range s.Events.Events() {
+		// Only show events of addresses, that could be managed by the client
+		address, err := ParseAddress(event.Address)
+		if err != nil || !policiesAllow(policy, event.InterfaceName, address) {
+			continue
+		}
+		eventList.Events = append(eventList.Events, event)
+	}
+
+	writeSuccess(w, r, Response{
+		Message: fmt.Sprintf("Found %d events", len(eventList.Events)),
+		Data: eventList,
+	})
 }
 
 // Handles a health request
 func handleHealthzRequest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "Method Not Allowed", nil, Response{})
 		return
 	}
 
-	fmt.Fprintf(w, "Server is healthy and ready to serve\n")
+	writeSuccess(w, r, Response{Message: "Server is healthy and ready to serve"})
+}
+
+// Handles a request on the health check listener, which serves nothing else
+func handleHealthzOnlyRequest(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/healthz" {
+		writeError(w, r, http.StatusNotFound, ErrorCodePathNotFound, "Path not found", nil, Response{})
+		return
+	}
+
+	handleHealthzRequest(w, r)
 }
 
 // Builds the client ca certificate pool
@@ -258,35 +812,106 @@ func RunServer(configFilePath string) error {
 		os.Exit(1)
 	}
 
-	// Read client ca certificate pool
-	var clientCACertificatePool *x509.CertPool
-	clientCACertificatePool, err = buildClientCACertificatPool(config.ClientCACertificatePath)
+	// Read server certificate and client ca certificate pool
+	certificate, clientCACertificatePool, err := loadTLSMaterial(config)
 	if err != nil {
 		return err
 	}
 
+	// Read certificate revocation lists
+	revocation, err := NewRevocationChecker(config)
+	if err != nil {
+		return err
+	}
+
+	// Open state store and restore the managed addresses
+	var store *Store
+	if config.StateDirectoryPath != "" {
+		store, err = OpenStore(config.StateDirectoryPath)
+		if err != nil {
+			zap.L().Error("Failed to open state store",
+				zap.String("path", config.StateDirectoryPath),
+				zap.Error(err),
+			)
+			return err
+		}
+
+		RestoreAddresses(store, config.AddressPolicies, "")
+	}
+
+	s := &Server{
+		Store: store,
+		Events: NewEventLog(),
+		configFilePath: configFilePath,
+	}
+	s.applyConfiguration(config, certificate, clientCACertificatePool, revocation)
+
+	// Watch for managed addresses, that vanish out-of-band, and reap expired leases
+	if store != nil {
+		watcher := &Watcher{
+			Store: store,
+			AddressPolicies: config.AddressPolicies,
+			Events: s.Events,
+			Mutex: &s.mutex,
+		}
+		s.watcher = watcher
+
+		go func() {
+			if err := watcher.Run(nil); err != nil {
+				zap.L().Error("Failed to watch interfaces for enforcing managed addresses",
+					zap.Error(err),
+				)
+			}
+		}()
+
+		go s.RunLeaseReaper(nil)
+	}
+
+	// Reload the configuration on SIGHUP and whenever one of its files changes
+	go s.RunReloader(nil)
+	go s.RunCRLReloader(nil)
+
 	// Setup server
 	server := &http.Server{
 		Addr: fmt.Sprintf(":%d", config.Port),
-		TLSConfig: &tls.Config{
-			ClientAuth: tls.RequestClientCert,
-		},
+		TLSConfig: s.listenerTLSConfig(true),
 		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if r.URL.Path == "/healthz" {
 				handleHealthzRequest(w, r)
 			} else {
-				if authenticateRequest(w, r, clientCACertificatePool) {
-					handleRequest(w, r, config.AddressPolicies)
+				if authenticateRequest(w, r, s.clientCAs(), s.revocationChecker(), s.tlsOptions()) {
+					s.handleRequest(w, r)
 				}
 			}
 		}),
 	}
 
+	// Serve health checks without client certificates on a separate listener,
+	// as the handshake of the server may require them
+	if config.HealthzPort != 0 {
+		healthzServer := &http.Server{
+			Addr: fmt.Sprintf(":%d", config.HealthzPort),
+			TLSConfig: s.listenerTLSConfig(false),
+			Handler: http.HandlerFunc(handleHealthzOnlyRequest),
+		}
+
+		go func() {
+			zap.L().Info("Starting health check listener",
+				zap.Uint16("port", config.HealthzPort),
+			)
+			if err := healthzServer.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				zap.L().Error("Health check listener terminated with error",
+					zap.Error(err),
+				)
+			}
+		}()
+	}
+
 	// Run server
 	zap.L().Info("Starting server",
 		zap.Uint16("port", config.Port),
 	)
-	err = server.ListenAndServeTLS(config.ServerCertificatePath, config.ServerKeyPath)
+	err = server.ListenAndServeTLS("", "")
 	if errors.Is(err, http.ErrServerClosed) {
 		return nil
 	} else if err != nil {
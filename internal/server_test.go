@@ -2,6 +2,9 @@ package internal
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -9,6 +12,7 @@ import (
 	"os"
 	"testing"
 
+	"golang.org/x/sys/unix"
 	"gotest.tools/assert"
 	"go.uber.org/zap"
 )
@@ -31,7 +35,7 @@ func TestNotExisting(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		handleRequest(w, r, []AddressPolicy{})
+		(&Server{AddressPolicies: []AddressPolicy{}}).handleRequest(w, r)
 	}))
 	defer server.Close()
 
@@ -46,10 +50,12 @@ func TestInvalidMethod(t *testing.T) {
 		t.Fatalf("Could not create request: %v", err)
 	}
 
+	req.Header.Set("Accept", "text/plain")
+
 	rr := httptest.NewRecorder()
 
 	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		handleRequest(w, r, []AddressPolicy{})
+		(&Server{AddressPolicies: []AddressPolicy{}}).handleRequest(w, r)
 	}))
 	defer server.Close()
 
@@ -67,12 +73,13 @@ func TestInvalidContentType(t *testing.T) {
 		t.Fatalf("Could not create request: %v", err)
 	}
 
+	req.Header.Set("Accept", "text/plain")
 	req.Header.Set("Content-Type", "text/html")
 
 	rr := httptest.NewRecorder()
 
 	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		handleRequest(w, r, []AddressPolicy{})
+		(&Server{AddressPolicies: []AddressPolicy{}}).handleRequest(w, r)
 	}))
 	defer server.Close()
 
@@ -87,10 +94,12 @@ func TestNilBody(t *testing.T) {
 		t.Fatalf("Could not create request: %v", err)
 	}
 
+	req.Header.Set("Accept", "text/plain")
+
 	rr := httptest.NewRecorder()
 
 	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		handleRequest(w, r, []AddressPolicy{})
+		(&Server{AddressPolicies: []AddressPolicy{}}).handleRequest(w, r)
 	}))
 	defer server.Close()
 
@@ -108,12 +117,13 @@ func TestEmptyBody(t *testing.T) {
 		t.Fatalf("Could not create request: %v", err)
 	}
 
+	req.Header.Set("Accept", "text/plain")
 	req.Header.Set("Content-Type", "application/json")
 
 	rr := httptest.NewRecorder()
 
 	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		handleRequest(w, r, []AddressPolicy{})
+		(&Server{AddressPolicies: []AddressPolicy{}}).handleRequest(w, r)
 	}))
 	defer server.Close()
 
@@ -132,6 +142,7 @@ func TestAddAddressWithPolicyMismatch(t *testing.T) {
 		t.Fatalf("Could not create request: %v", err)
 	}
 
+	req.Header.Set("Accept", "text/plain")
 	req.Header.Set("Content-Type", "application/json")
 
 	rr := httptest.NewRecorder()
@@ -143,11 +154,11 @@ func TestAddAddressWithPolicyMismatch(t *testing.T) {
 	assert.NilError(t, err)
 
 	policies := []AddressPolicy{
-		AddressPolicy{ IPNetwork{*policyIPNetwork}, Regexp{*policyInterfaceNameRegexp} },
+		AddressPolicy{IPNetwork: IPNetwork{*policyIPNetwork}, InterfaceNameRegex: Regexp{*policyInterfaceNameRegexp}},
 	}
 
 	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		handleRequest(w, r, policies)
+		(&Server{AddressPolicies: policies}).handleRequest(w, r)
 	}))
 	defer server.Close()
 
@@ -169,6 +180,7 @@ func TestAddAndDeleteAddressWithPolicyMatch(t *testing.T) {
 		t.Fatalf("Could not create request: %v", err)
 	}
 
+	req.Header.Set("Accept", "text/plain")
 	req.Header.Set("Content-Type", "application/json")
 
 	rr := httptest.NewRecorder()
@@ -180,11 +192,11 @@ func TestAddAndDeleteAddressWithPolicyMatch(t *testing.T) {
 	assert.NilError(t, err)
 
 	policies := []AddressPolicy{
-		AddressPolicy{ IPNetwork{*policyIPNetwork}, Regexp{*policyInterfaceNameRegexp} },
+		AddressPolicy{IPNetwork: IPNetwork{*policyIPNetwork}, InterfaceNameRegex: Regexp{*policyInterfaceNameRegexp}},
 	}
 
 	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		handleRequest(w, r, policies)
+		(&Server{AddressPolicies: policies}).handleRequest(w, r)
 	}))
 	defer server.Close()
 
@@ -197,6 +209,7 @@ func TestAddAndDeleteAddressWithPolicyMatch(t *testing.T) {
 		t.Fatalf("Could not create request: %v", err)
 	}
 
+	req.Header.Set("Accept", "text/plain")
 	req.Header.Set("Content-Type", "application/json")
 
 	rr = httptest.NewRecorder()
@@ -206,6 +219,55 @@ func TestAddAndDeleteAddressWithPolicyMatch(t *testing.T) {
 	assert.Equal(t, rr.Body.String(), "Successfully deleted address from interface\n")
 }
 
+func TestAddAndDeleteAddressWithStore(t *testing.T) {
+	assert.Assert(t, os.Getenv("NET_LINK") != "")
+
+	requestData := []byte("{\"address\":\"192.0.2.1/24\", \"interface_name\":\"" + os.Getenv("NET_LINK") + "\"}")
+
+	req, err := http.NewRequest("POST", "/add", bytes.NewBuffer(requestData))
+	if err != nil {
+		t.Fatalf("Could not create request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+
+	_, policyIPNetwork, err := net.ParseCIDR("192.0.2.0/24")
+	assert.NilError(t, err)
+
+	store, err := OpenStore(t.TempDir())
+	assert.NilError(t, err)
+
+	s := &Server{
+		AddressPolicies: []AddressPolicy{
+			AddressPolicy{IPNetwork: IPNetwork{*policyIPNetwork}, InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")}},
+		},
+		Store: store,
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(s.handleRequest))
+	defer server.Close()
+
+	server.Config.Handler.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Equal(t, len(store.RecordsOfInterface(os.Getenv("NET_LINK"))), 1)
+	assert.Equal(t, store.Records()[0].Address, "192.0.2.1/24")
+
+	req, err = http.NewRequest("POST", "/delete", bytes.NewBuffer(requestData))
+	if err != nil {
+		t.Fatalf("Could not create request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	rr = httptest.NewRecorder()
+
+	server.Config.Handler.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Equal(t, len(store.Records()), 0)
+}
+
 func TestAddAddressToNonExistingInterfaceWithPolicyMatch(t *testing.T) {
 	requestData := []byte("{\"address\":\"fd69:decd:7b66:8220:b37a:817a:cabd:35c0/64\", \"interface_name\":\"abcd\"}")
 
@@ -214,6 +276,7 @@ func TestAddAddressToNonExistingInterfaceWithPolicyMatch(t *testing.T) {
 		t.Fatalf("Could not create request: %v", err)
 	}
 
+	req.Header.Set("Accept", "text/plain")
 	req.Header.Set("Content-Type", "application/json")
 
 	rr := httptest.NewRecorder()
@@ -225,16 +288,16 @@ func TestAddAddressToNonExistingInterfaceWithPolicyMatch(t *testing.T) {
 	assert.NilError(t, err)
 
 	policies := []AddressPolicy{
-		AddressPolicy{ IPNetwork{*policyIPNetwork}, Regexp{*policyInterfaceNameRegexp} },
+		AddressPolicy{IPNetwork: IPNetwork{*policyIPNetwork}, InterfaceNameRegex: Regexp{*policyInterfaceNameRegexp}},
 	}
 
 	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		handleRequest(w, r, policies)
+		(&Server{AddressPolicies: policies}).handleRequest(w, r)
 	}))
 	defer server.Close()
 
 	server.Config.Handler.ServeHTTP(rr, req)
-	assert.Equal(t, rr.Code, http.StatusInternalServerError)
+	assert.Equal(t, rr.Code, http.StatusNotFound)
 	assert.Equal(t, rr.Body.String(), "Failed to retreive interface: Link not found\n")
 }
 
@@ -246,6 +309,7 @@ func TestDeleteAddressToNonExistingInterfaceWithPolicyMatch(t *testing.T) {
 		t.Fatalf("Could not create request: %v", err)
 	}
 
+	req.Header.Set("Accept", "text/plain")
 	req.Header.Set("Content-Type", "application/json")
 
 	rr := httptest.NewRecorder()
@@ -257,25 +321,303 @@ func TestDeleteAddressToNonExistingInterfaceWithPolicyMatch(t *testing.T) {
 	assert.NilError(t, err)
 
 	policies := []AddressPolicy{
-		AddressPolicy{ IPNetwork{*policyIPNetwork}, Regexp{*policyInterfaceNameRegexp} },
+		AddressPolicy{IPNetwork: IPNetwork{*policyIPNetwork}, InterfaceNameRegex: Regexp{*policyInterfaceNameRegexp}},
 	}
 
 	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		handleRequest(w, r, policies)
+		(&Server{AddressPolicies: policies}).handleRequest(w, r)
 	}))
 	defer server.Close()
 
 	server.Config.Handler.ServeHTTP(rr, req)
-	assert.Equal(t, rr.Code, http.StatusInternalServerError)
+	assert.Equal(t, rr.Code, http.StatusNotFound)
 	assert.Equal(t, rr.Body.String(), "Failed to retreive interface: Link not found\n")
 }
 
+func TestListAddressesWithPolicyMatch(t *testing.T) {
+	req, err := http.NewRequest("GET", "/addresses?interface_name=lo&family=ipv4", nil)
+	if err != nil {
+		t.Fatalf("Could not create request: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	_, policyIPNetwork, err := net.ParseCIDR("127.0.0.0/8")
+	assert.NilError(t, err)
+
+	policyInterfaceNameRegexp, err := regexp.Compile("^lo$")
+	assert.NilError(t, err)
+
+	policies := []AddressPolicy{
+		AddressPolicy{IPNetwork: IPNetwork{*policyIPNetwork}, InterfaceNameRegex: Regexp{*policyInterfaceNameRegexp}},
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		(&Server{AddressPolicies: policies}).handleRequest(w, r)
+	}))
+	defer server.Close()
+
+	server.Config.Handler.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Equal(t, rr.Header().Get("Content-Type"), "application/json")
+
+	var response struct {
+		Response
+		Data AddressList `json:"data"`
+	}
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, response.Version, ResponseVersion)
+	assert.Equal(t, response.Success, true)
+	assert.Equal(t, len(response.Data.Addresses), 1)
+	assert.Equal(t, response.Data.Addresses[0].Address, "127.0.0.1/8")
+	assert.Equal(t, response.Data.Addresses[0].InterfaceName, "lo")
+}
+
+func TestListAddressesWithPolicyMismatch(t *testing.T) {
+	req, err := http.NewRequest("GET", "/addresses?interface_name=lo", nil)
+	if err != nil {
+		t.Fatalf("Could not create request: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	_, policyIPNetwork, err := net.ParseCIDR("192.0.2.0/24")
+	assert.NilError(t, err)
+
+	policyInterfaceNameRegexp, err := regexp.Compile(".*")
+	assert.NilError(t, err)
+
+	policies := []AddressPolicy{
+		AddressPolicy{IPNetwork: IPNetwork{*policyIPNetwork}, InterfaceNameRegex: Regexp{*policyInterfaceNameRegexp}},
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		(&Server{AddressPolicies: policies}).handleRequest(w, r)
+	}))
+	defer server.Close()
+
+	server.Config.Handler.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Equal(t, rr.Body.String(), "{\"version\":1,\"success\":true,\"message\":\"Found 0 managed addresses\",\"interface_name\":\"lo\",\"data\":{\"addresses\":[]}}\n")
+}
+
+func TestListAddressesWithInvalidFamily(t *testing.T) {
+	req, err := http.NewRequest("GET", "/addresses?family=ipx", nil)
+	if err != nil {
+		t.Fatalf("Could not create request: %v", err)
+	}
+
+	req.Header.Set("Accept", "text/plain")
+
+	rr := httptest.NewRecorder()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		(&Server{AddressPolicies: []AddressPolicy{}}).handleRequest(w, r)
+	}))
+	defer server.Close()
+
+	server.Config.Handler.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusBadRequest)
+	assert.Equal(t, rr.Body.String(), "Failed to parse address family: invalid address family (expected \"ipv4\" or \"ipv6\")\n")
+}
+
+func TestAddAddressWithPolicyMismatchAsJSON(t *testing.T) {
+	requestData := []byte("{\"address\":\"fd69:decd:7b66:8220:b37a:817a:cabd:35c0/64\", \"interface_name\":\"lo\"}")
+
+	req, err := http.NewRequest("POST", "/add", bytes.NewBuffer(requestData))
+	if err != nil {
+		t.Fatalf("Could not create request: %v", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+
+	_, policyIPNetwork, err := net.ParseCIDR("fd69:decd:7b66:8220::/64")
+	assert.NilError(t, err)
+
+	policyInterfaceNameRegexp, err := regexp.Compile("^eth0$")
+	assert.NilError(t, err)
+
+	policies := []AddressPolicy{
+		AddressPolicy{IPNetwork: IPNetwork{*policyIPNetwork}, InterfaceNameRegex: Regexp{*policyInterfaceNameRegexp}},
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		(&Server{AddressPolicies: policies}).handleRequest(w, r)
+	}))
+	defer server.Close()
+
+	server.Config.Handler.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusForbidden)
+	assert.Equal(t, rr.Header().Get("Content-Type"), "application/json")
+
+	var response Response
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, response.Version, ResponseVersion)
+	assert.Equal(t, response.Success, false)
+	assert.Equal(t, response.Error.Code, ErrorCodePolicyDenied)
+	assert.Equal(t, response.Address, "fd69:decd:7b66:8220:b37a:817a:cabd:35c0/64")
+	assert.Equal(t, response.InterfaceName, "lo")
+}
+
+func TestAddAddressToNonExistingInterfaceAsJSON(t *testing.T) {
+	requestData := []byte("{\"address\":\"fd69:decd:7b66:8220:b37a:817a:cabd:35c0/64\", \"interface_name\":\"abcd\"}")
+
+	req, err := http.NewRequest("POST", "/add", bytes.NewBuffer(requestData))
+	if err != nil {
+		t.Fatalf("Could not create request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+
+	_, policyIPNetwork, err := net.ParseCIDR("fd69:decd:7b66:8220::/64")
+	assert.NilError(t, err)
+
+	policyInterfaceNameRegexp, err := regexp.Compile(".*")
+	assert.NilError(t, err)
+
+	policies := []AddressPolicy{
+		AddressPolicy{IPNetwork: IPNetwork{*policyIPNetwork}, InterfaceNameRegex: Regexp{*policyInterfaceNameRegexp}},
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		(&Server{AddressPolicies: policies}).handleRequest(w, r)
+	}))
+	defer server.Close()
+
+	server.Config.Handler.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusNotFound)
+
+	var response Response
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, response.Success, false)
+	assert.Equal(t, response.Error.Code, ErrorCodeLinkNotFound)
+	assert.Equal(t, response.Error.Detail, "Link not found")
+	assert.Equal(t, response.Message, "Failed to retreive interface: Link not found")
+	assert.Equal(t, response.InterfaceName, "abcd")
+}
+
+func TestInvalidAddressAsJSON(t *testing.T) {
+	requestData := []byte("{\"address\":\"abcd\", \"interface_name\":\"lo\"}")
+
+	req, err := http.NewRequest("POST", "/add", bytes.NewBuffer(requestData))
+	if err != nil {
+		t.Fatalf("Could not create request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		(&Server{AddressPolicies: []AddressPolicy{}}).handleRequest(w, r)
+	}))
+	defer server.Close()
+
+	server.Config.Handler.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusBadRequest)
+
+	var response Response
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, response.Error.Code, ErrorCodeAddressParseError)
+}
+
+func TestListAddressesWithIdentityMismatch(t *testing.T) {
+	req, err := http.NewRequest("GET", "/addresses?interface_name=lo&family=ipv4", nil)
+	if err != nil {
+		t.Fatalf("Could not create request: %v", err)
+	}
+
+	req.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{testClientCertificate(t)},
+	}
+
+	rr := httptest.NewRecorder()
+
+	_, policyIPNetwork, err := net.ParseCIDR("127.0.0.0/8")
+	assert.NilError(t, err)
+
+	policyInterfaceNameRegexp, err := regexp.Compile("^lo$")
+	assert.NilError(t, err)
+
+	policies := []AddressPolicy{
+		AddressPolicy{IPNetwork: IPNetwork{*policyIPNetwork}, InterfaceNameRegex: Regexp{*policyInterfaceNameRegexp}, Identities: []IdentityMatcher{ParseIdentityMatcher("cn:team-b")}},
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		(&Server{AddressPolicies: policies}).handleRequest(w, r)
+	}))
+	defer server.Close()
+
+	server.Config.Handler.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusOK)
+
+	var response struct {
+		Response
+		Data AddressList `json:"data"`
+	}
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, len(response.Data.Addresses), 0)
+
+	policies[0].Identities = append(policies[0].Identities, ParseIdentityMatcher("uri:spiffe://example.org/team-a/worker"))
+
+	rr = httptest.NewRecorder()
+
+	server.Config.Handler.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, len(response.Data.Addresses), 1)
+}
+
+func TestListEvents(t *testing.T) {
+	req, err := http.NewRequest("GET", "/events", nil)
+	if err != nil {
+		t.Fatalf("Could not create request: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	_, policyIPNetwork, err := net.ParseCIDR("192.0.2.0/24")
+	assert.NilError(t, err)
+
+	s := &Server{
+		AddressPolicies: []AddressPolicy{
+			AddressPolicy{IPNetwork: IPNetwork{*policyIPNetwork}, InterfaceNameRegex: Regexp{*regexp.MustCompile("^eth0$")}},
+		},
+		Events: NewEventLog(),
+	}
+	s.Events.Publish(Event{Type: EventTypeAddressRemoved, InterfaceName: "eth0", Address: "192.0.2.1/24"})
+	s.Events.Publish(Event{Type: EventTypeAddressRemoved, InterfaceName: "eth1", Address: "192.0.2.1/24"})
+	s.Events.Publish(Event{Type: EventTypeAddressRemoved, InterfaceName: "eth0", Address: "198.51.100.1/24"})
+
+	server := httptest.NewTLSServer(http.HandlerFunc(s.handleRequest))
+	defer server.Close()
+
+	server.Config.Handler.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusOK)
+
+	var response struct {
+		Response
+		Data EventList `json:"data"`
+	}
+	assert.NilError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, len(response.Data.Events), 1)
+	assert.Equal(t, response.Data.Events[0].InterfaceName, "eth0")
+	assert.Equal(t, response.Data.Events[0].Address, "192.0.2.1/24")
+}
+
 func TestInvalidMethodOnHealthz(t *testing.T) {
 	req, err := http.NewRequest("POST", "/healthz", nil)
 	if err != nil {
 		t.Fatalf("Could not create request: %v", err)
 	}
 
+	req.Header.Set("Accept", "text/plain")
+
 	rr := httptest.NewRecorder()
 
 	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -294,6 +636,8 @@ func TestHealthz(t *testing.T) {
 		t.Fatalf("Could not create request: %v", err)
 	}
 
+	req.Header.Set("Accept", "text/plain")
+
 	rr := httptest.NewRecorder()
 
 	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -306,3 +650,154 @@ func TestHealthz(t *testing.T) {
 	assert.Equal(t, rr.Body.String(), "Server is healthy and ready to serve\n")
 }
 
+
+func TestAddAddressWithOptionsAndPolicy(t *testing.T) {
+	assert.Assert(t, os.Getenv("NET_LINK") != "")
+
+	link, err := LinkByName(os.Getenv("NET_LINK"))
+	assert.NilError(t, err)
+
+	_, policyIPNetwork, err := net.ParseCIDR("192.0.2.0/24")
+	assert.NilError(t, err)
+
+	store, err := OpenStore(t.TempDir())
+	assert.NilError(t, err)
+
+	s := &Server{
+		AddressPolicies: []AddressPolicy{
+			AddressPolicy{IPNetwork: IPNetwork{*policyIPNetwork}, InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")}},
+			AddressPolicy{IPNetwork: IPNetwork{*policyIPNetwork}, InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")}, Identities: []IdentityMatcher{{Kind: "cn", Value: "admin"}}, AllowedFlags: []string{"noprefixroute"}, AllowLabel: true},
+		},
+		Store: store,
+	}
+
+	rd := RequestData{
+		Address: "192.0.2.1/24",
+		InterfaceName: os.Getenv("NET_LINK"),
+		AddressOptions: AddressOptions{Flags: []string{"noprefixroute"}, Label: os.Getenv("NET_LINK") + ":vip"},
+	}
+
+	// Only the policy of the admin identity allows the options
+	code, response := sendPostRequest(t, s, "/add", rd)
+	assert.Equal(t, code, http.StatusForbidden)
+	assert.Equal(t, response.Error.Code, ErrorCodePolicyDenied)
+	assertAddressExists(t, link, "192.0.2.1/24", false)
+
+	s.AddressPolicies[1].Identities = nil
+	code, _ = sendPostRequest(t, s, "/add", rd)
+	assert.Equal(t, code, http.StatusOK)
+	assertAddressExists(t, link, "192.0.2.1/24", true)
+
+	records := store.Records()
+	assert.Equal(t, len(records), 1)
+	assert.DeepEqual(t, records[0].Options, &rd.AddressOptions)
+
+	code, _ = sendPostRequest(t, s, "/delete", RequestData{Address: rd.Address, InterfaceName: rd.InterfaceName})
+	assert.Equal(t, code, http.StatusOK)
+	assertAddressExists(t, link, "192.0.2.1/24", false)
+}
+
+func TestAddExistingAddressWithOptions(t *testing.T) {
+	assert.Assert(t, os.Getenv("NET_LINK") != "")
+
+	link, err := LinkByName(os.Getenv("NET_LINK"))
+	assert.NilError(t, err)
+
+	_, policyIPv4Network, err := net.ParseCIDR("192.0.2.0/24")
+	assert.NilError(t, err)
+	_, policyIPv6Network, err := net.ParseCIDR("fd69:decd:7b66:8220::/64")
+	assert.NilError(t, err)
+
+	store, err := OpenStore(t.TempDir())
+	assert.NilError(t, err)
+
+	s := &Server{
+		AddressPolicies: []AddressPolicy{
+			AddressPolicy{IPNetwork: IPNetwork{*policyIPv4Network}, InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")}, AllowedFlags: []string{"noprefixroute"}, AllowLabel: true, AllowLifetimes: true},
+			AddressPolicy{IPNetwork: IPNetwork{*policyIPv6Network}, InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")}, AllowedFlags: []string{"nodad", "noprefixroute"}},
+		},
+		Store: store,
+	}
+
+	rd := RequestData{Address: "fd69:decd:7b66:8220::1/64", InterfaceName: os.Getenv("NET_LINK"), AddressOptions: AddressOptions{Flags: []string{"nodad"}}}
+	defer sendPostRequest(t, s, "/delete", RequestData{Address: rd.Address, InterfaceName: rd.InterfaceName})
+
+	code, _ := sendPostRequest(t, s, "/add", rd)
+	assert.Equal(t, code, http.StatusOK)
+
+	// The flags of a present IPv6 address are replaced
+	rd.AddressOptions = AddressOptions{Flags: []string{"nodad", "noprefixroute"}}
+	code, _ = sendPostRequest(t, s, "/add", rd)
+	assert.Equal(t, code, http.StatusOK)
+
+	address, err := ParseAddress(rd.Address)
+	assert.NilError(t, err)
+	existingAddress, err := findAddress(link, address)
+	assert.NilError(t, err)
+	assert.Assert(t, existingAddress.Flags & unix.IFA_F_NOPREFIXROUTE != 0)
+	assert.DeepEqual(t, store.Records()[0].Options, &rd.AddressOptions)
+
+	rd = RequestData{Address: "192.0.2.1/24", InterfaceName: os.Getenv("NET_LINK")}
+	defer sendPostRequest(t, s, "/delete", rd)
+
+	code, _ = sendPostRequest(t, s, "/add", rd)
+	assert.Equal(t, code, http.StatusOK)
+
+	// The label and the flags of a present IPv4 address can't be changed in place
+	rd.AddressOptions = AddressOptions{Label: os.Getenv("NET_LINK") + ":vip"}
+	code, response := sendPostRequest(t, s, "/add", rd)
+	assert.Equal(t, code, http.StatusConflict)
+	assert.Equal(t, response.Error.Code, ErrorCodeAddressConflict)
+
+	rd.AddressOptions = AddressOptions{Flags: []string{"noprefixroute"}}
+	code, response = sendPostRequest(t, s, "/add", rd)
+	assert.Equal(t, code, http.StatusConflict)
+	assert.Equal(t, response.Error.Code, ErrorCodeAddressConflict)
+
+	// A finite lifetime is applied and removes the permanent record, so the
+	// address isn't restored
+	validLifetime := 300
+	rd.AddressOptions = AddressOptions{ValidLifetime: &validLifetime}
+	code, _ = sendPostRequest(t, s, "/add", rd)
+	assert.Equal(t, code, http.StatusOK)
+
+	address, err = ParseAddress(rd.Address)
+	assert.NilError(t, err)
+	assert.Assert(t, !store.Contains(rd.InterfaceName, address))
+
+	existingAddress, err = findAddress(link, address)
+	assert.NilError(t, err)
+	assert.Assert(t, existingAddress.ValidLft > 0 && existingAddress.ValidLft <= validLifetime)
+}
+
+func TestAddAddressDeniedByPolicy(t *testing.T) {
+	_, allowedIPNetwork, err := net.ParseCIDR("198.51.100.0/24")
+	assert.NilError(t, err)
+	_, deniedIPNetwork, err := net.ParseCIDR("198.51.100.0/28")
+	assert.NilError(t, err)
+
+	server := &Server{
+		AddressPolicies: []AddressPolicy{
+			{
+				IPNetwork: IPNetwork{*allowedIPNetwork},
+				InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")},
+			},
+			{
+				Name: "reserved",
+				Action: PolicyActionDeny,
+				IPNetwork: IPNetwork{*deniedIPNetwork},
+				InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")},
+			},
+		},
+	}
+
+	for _, path := range []string{"/add", "/delete"} {
+		status, response := sendPostRequest(t, server, path, RequestData{
+			Address: "198.51.100.1/24",
+			InterfaceName: "lo",
+		})
+		assert.Equal(t, status, http.StatusForbidden)
+		assert.Equal(t, response.Error.Code, ErrorCodePolicyDenied)
+		assert.Equal(t, response.Message, "Rejected cidr address for interface, because it's denied by policy \"reserved\"")
+	}
+}
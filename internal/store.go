@@ -0,0 +1,290 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Name of the file, that holds the managed addresses in the state directory
+const storeFileName = "addresses.json"
+
+// Durable store of the addresses, that were configured through the api
+// (a nil store doesn't record anything)
+type Store struct {
+	mutex sync.Mutex
+	path string
+	records []AddressRecord
+}
+
+// Error returned, when an address operation couldn't be recorded in the store
+type StoreError struct {
+	Err error
+}
+
+func (e *StoreError) Error() string {
+	return fmt.Sprintf("failed to update state store: %v", e.Err)
+}
+
+func (e *StoreError) Unwrap() error {
+	return e.Err
+}
+
+// Holds a managed address of an interface
+type AddressRecord struct {
+	InterfaceName string `json:"interface_name"`
+	Address string `json:"address"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Options *AddressOptions `json:"options,omitempty"`
+	Owner string `json:"owner,omitempty"`
+}
+
+// Returns the recorded cidr address with its options applied
+func (ar AddressRecord) CIDRAddress() (CIDRAddress, error) {
+	address, err := ParseAddress(ar.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	if ar.Options != nil {
+		if err := ar.Options.Apply(ar.InterfaceName, address); err != nil {
+			return nil, err
+		}
+	}
+
+	return address, nil
+}
+
+// Checks whether the lease of a record is expired (records without lease never expire)
+func (ar AddressRecord) Expired(now time.Time) bool {
+	return ar.ExpiresAt != nil && !ar.ExpiresAt.After(now)
+}
+
+// Holds the content of the store file
+type storeFile struct {
+	Version int `json:"version"`
+	Addresses []AddressRecord `json:"addresses"`
+}
+
+// Opens the store in a state directory and loads the recorded addresses
+func OpenStore(stateDirectoryPath string) (*Store, error) {
+	if err := os.MkdirAll(stateDirectoryPath, 0700); err != nil {
+		return nil, err
+	}
+
+	store := &Store{
+		path: filepath.Join(stateDirectoryPath, storeFileName),
+	}
+
+	data, err := os.ReadFile(store.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var sf storeFile
+	if err := json.Unmarshal(data, &sf); err != nil {
+		return nil, err
+	}
+	store.records = sf.Addresses
+
+	zap.L().Info("Loaded managed addresses from state store",
+		zap.String("path", store.path),
+		zap.Int("count", len(store.records)),
+	)
+
+	return store, nil
+}
+
+// Returns a copy of all recorded addresses
+func (s *Store) Records() []AddressRecord {
+	if s == nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	records := make([]AddressRecord, len(s.records))
+	copy(records, s.records)
+	return records
+}
+
+// Returns the recorded addresses of an interface
+func (s *Store) RecordsOfInterface(interfaceName string) []AddressRecord {
+	var records []AddressRecord
+	for _, record := range s.Records() {
+		if record.InterfaceName == interfaceName {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// Checks whether an address of an interface is recorded
+func (s *Store) Contains(interfaceName string, address CIDRAddress) bool {
+	if s == nil {
+		return false
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.indexOf(interfaceName, address) >= 0
+}
+
+// Returns the record of an address of an interface
+func (s *Store) Record(interfaceName string, address CIDRAddress) (AddressRecord, bool) {
+	if s == nil {
+		return AddressRecord{}, false
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.indexOf(interfaceName, address)
+	if i < 0 {
+		return AddressRecord{}, false
+	}
+	return s.records[i], true
+}
+
+// Records an address of an interface with its options, the expiry of its
+// lease (nil for addresses without lease) and the identity of the client, that
+// added it, or updates an existing record
+func (s *Store) Put(interfaceName string, address CIDRAddress, expiresAt *time.Time, owner string) error {
+	return s.PutRecord(AddressRecord{
+		InterfaceName: interfaceName,
+		Address: address.IPNet.String(),
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+		Options: PersistentAddressOptions(address),
+		Owner: owner,
+	})
+}
+
+// Records an address or updates an existing record (keeping its creation time
+// and owner)
+func (s *Store) PutRecord(record AddressRecord) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := range s.records {
+		if s.records[i].InterfaceName != record.InterfaceName || s.records[i].Address != record.Address {
+			continue
+		}
+
+		record.CreatedAt = s.records[i].CreatedAt
+		if s.records[i].Owner != "" {
+			record.Owner = s.records[i].Owner
+		}
+		if reflect.DeepEqual(s.records[i], record) {
+			return nil
+		}
+
+		// A record, that couldn't be saved, must not short-circuit a retry
+		previous := s.records[i]
+		s.records[i] = record
+		if err := s.save(); err != nil {
+			s.records[i] = previous
+			return err
+		}
+		return nil
+	}
+
+	s.records = append(s.records, record)
+	if err := s.save(); err != nil {
+		s.records = s.records[:len(s.records) - 1]
+		return err
+	}
+
+	return nil
+}
+
+// Removes the record of an address of an interface
+func (s *Store) Remove(interfaceName string, address CIDRAddress) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.indexOf(interfaceName, address)
+	if i < 0 {
+		return nil
+	}
+
+	records := s.records
+	s.records = append(append([]AddressRecord{}, records[:i]...), records[i+1:]...)
+	if err := s.save(); err != nil {
+		s.records = records
+		return err
+	}
+
+	return nil
+}
+
+// Returns the index of the record of an address of an interface (or -1)
+func (s *Store) indexOf(interfaceName string, address CIDRAddress) int {
+	for i, record := range s.records {
+		if record.InterfaceName == interfaceName && record.Address == address.IPNet.String() {
+			return i
+		}
+	}
+	return -1
+}
+
+// Writes the records atomically to the store file
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(storeFile{Version: 1, Addresses: s.records}, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(s.path), storeFileName + ".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return err
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpFile.Name(), s.path); err != nil {
+		return err
+	}
+
+	// Make the rename durable
+	directory, err := os.Open(filepath.Dir(s.path))
+	if err != nil {
+		return err
+	}
+	defer directory.Close()
+
+	return directory.Sync()
+}
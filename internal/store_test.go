@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestStorePersistence(t *testing.T) {
+	stateDirectoryPath := filepath.Join(t.TempDir(), "state")
+
+	store, err := OpenStore(stateDirectoryPath)
+	assert.NilError(t, err)
+	assert.Equal(t, len(store.Records()), 0)
+
+	address1, err := ParseAddress("fd69:decd:7b66:8220::1/64")
+	assert.NilError(t, err)
+
+	address2, err := ParseAddress("192.0.2.1/24")
+	assert.NilError(t, err)
+
+	assert.NilError(t, store.Put("eth0", address1, nil, ""))
+	assert.NilError(t, store.Put("eth0", address1, nil, ""))
+	assert.NilError(t, store.Put("eth1", address2, nil, ""))
+	assert.Equal(t, len(store.Records()), 2)
+
+	store, err = OpenStore(stateDirectoryPath)
+	assert.NilError(t, err)
+
+	records := store.Records()
+	assert.Equal(t, len(records), 2)
+	assert.Equal(t, records[0].InterfaceName, "eth0")
+	assert.Equal(t, records[0].Address, "fd69:decd:7b66:8220::1/64")
+	assert.Equal(t, records[1].InterfaceName, "eth1")
+	assert.Equal(t, records[1].Address, "192.0.2.1/24")
+	assert.Equal(t, len(store.RecordsOfInterface("eth1")), 1)
+
+	assert.NilError(t, store.Remove("eth0", address1))
+	assert.NilError(t, store.Remove("eth0", address2))
+
+	store, err = OpenStore(stateDirectoryPath)
+	assert.NilError(t, err)
+	assert.Equal(t, len(store.Records()), 1)
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(stateDirectoryPath)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 1)
+}
+
+func TestStoreSaveFailure(t *testing.T) {
+	stateDirectoryPath := filepath.Join(t.TempDir(), "state")
+
+	store, err := OpenStore(stateDirectoryPath)
+	assert.NilError(t, err)
+
+	address1, err := ParseAddress("fd69:decd:7b66:8220::1/64")
+	assert.NilError(t, err)
+
+	address2, err := ParseAddress("192.0.2.1/24")
+	assert.NilError(t, err)
+
+	assert.NilError(t, store.Put("eth0", address1, nil, ""))
+
+	// The records stay as they were, if they can't be saved
+	assert.NilError(t, os.RemoveAll(stateDirectoryPath))
+	expiresAt := time.Now().UTC().Add(time.Minute)
+	assert.Assert(t, store.Put("eth0", address1, &expiresAt, "") != nil)
+	assert.Assert(t, store.Put("eth1", address2, nil, "") != nil)
+	assert.Assert(t, store.Remove("eth0", address1) != nil)
+	assert.Equal(t, len(store.Records()), 1)
+	record, recorded := store.Record("eth0", address1)
+	assert.Assert(t, recorded)
+	assert.Assert(t, record.ExpiresAt == nil)
+
+	// Updating the record again saves it
+	assert.NilError(t, os.Mkdir(stateDirectoryPath, 0700))
+	assert.NilError(t, store.Put("eth0", address1, &expiresAt, ""))
+
+	store, err = OpenStore(stateDirectoryPath)
+	assert.NilError(t, err)
+	record, recorded = store.Record("eth0", address1)
+	assert.Assert(t, recorded)
+	assert.Assert(t, record.ExpiresAt != nil)
+}
+
+func TestNilStore(t *testing.T) {
+	var store *Store
+
+	address, err := ParseAddress("192.0.2.1/24")
+	assert.NilError(t, err)
+
+	assert.NilError(t, store.Put("eth0", address, nil, ""))
+	assert.NilError(t, store.Remove("eth0", address))
+	assert.Equal(t, len(store.Records()), 0)
+}
+
+func TestInvalidStoreFile(t *testing.T) {
+	stateDirectoryPath := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(stateDirectoryPath, storeFileName), []byte("{"), 0600))
+
+	_, err := OpenStore(stateDirectoryPath)
+	assert.ErrorContains(t, err, "unexpected end of JSON input")
+}
+
+func TestRestoreAddresses(t *testing.T) {
+	assert.Assert(t, os.Getenv("NET_LINK") != "")
+
+	link, err := LinkByName(os.Getenv("NET_LINK"))
+	assert.NilError(t, err)
+
+	store, err := OpenStore(t.TempDir())
+	assert.NilError(t, err)
+
+	address, err := ParseAddress("192.0.2.1/24")
+	assert.NilError(t, err)
+	assert.NilError(t, store.Put(os.Getenv("NET_LINK"), address, nil, ""))
+
+	RestoreAddresses(store, nil, "")
+	assertAddressExists(t, link, "192.0.2.1/24", true)
+
+	assert.NilError(t, DeleteAddress(link, address))
+}
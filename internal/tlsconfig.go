@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+)
+
+// Modes of requesting client certificates in the TLS handshake
+const (
+	ClientAuthRequest = "request"
+	ClientAuthRequireAndVerify = "require_and_verify"
+)
+
+// Minimum TLS versions by their name
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Elliptic curves for the key exchange by their name
+var tlsCurves = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256": tls.CurveP256,
+	"P384": tls.CurveP384,
+	"P521": tls.CurveP521,
+}
+
+// Returns the id of a secure cipher suite by its name
+func cipherSuiteByName(name string) (uint16, bool) {
+	for _, cs := range tls.CipherSuites() {
+		if cs.Name == name {
+			return cs.ID, true
+		}
+	}
+	return 0, false
+}
+
+// Validates the TLS options
+func (o TLSOptions) validate() error {
+	if o.ClientAuth != "" && o.ClientAuth != ClientAuthRequest && o.ClientAuth != ClientAuthRequireAndVerify {
+		return fmt.Errorf("The tls configuration has an invalid client auth \"%s\" (expected \"request\" or \"require_and_verify\")", o.ClientAuth)
+	}
+
+	if _, ok := tlsVersions[o.MinVersion]; o.MinVersion != "" && !ok {
+		return fmt.Errorf("The tls configuration has an invalid minimum version \"%s\" (expected \"1.0\", \"1.1\", \"1.2\" or \"1.3\")", o.MinVersion)
+	}
+
+	for _, name := range o.CipherSuites {
+		if _, ok := cipherSuiteByName(name); !ok {
+			return fmt.Errorf("The tls configuration has an unknown or insecure cipher suite \"%s\"", name)
+		}
+	}
+
+	for _, name := range o.Curves {
+		if _, ok := tlsCurves[name]; !ok {
+			return fmt.Errorf("The tls configuration has an unknown curve \"%s\" (expected \"X25519\", \"P256\", \"P384\" or \"P521\")", name)
+		}
+	}
+
+	return nil
+}
+
+// Checks whether client certificates are verified in the TLS handshake
+func (o TLSOptions) IsRequireAndVerify() bool {
+	return o.ClientAuth == ClientAuthRequireAndVerify
+}
+
+// Checks whether client certificates must be valid for client authentication
+// (which the TLS handshake enforces, if it verifies them)
+func (o TLSOptions) verifiesClientAuthUsage() bool {
+	return o.RequireClientAuthEKU || o.IsRequireAndVerify()
+}
+
+// Applies the TLS options to a TLS configuration (client certificates are
+// verified against the client ca certificate pool, if required)
+func (o TLSOptions) apply(config *tls.Config, clientCACertificatePool *x509.CertPool) {
+	if version, ok := tlsVersions[o.MinVersion]; ok {
+		config.MinVersion = version
+	}
+
+	for _, name := range o.CipherSuites {
+		if id, ok := cipherSuiteByName(name); ok {
+			config.CipherSuites = append(config.CipherSuites, id)
+		}
+	}
+
+	for _, name := range o.Curves {
+		config.CurvePreferences = append(config.CurvePreferences, tlsCurves[name])
+	}
+
+	if o.IsRequireAndVerify() {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.ClientCAs = clientCACertificatePool
+	}
+}
+
+// Checks whether a certificate explicitly allows client authentication via
+// its extended key usage
+func hasClientAuthUsage(certificate *x509.Certificate) bool {
+	for _, usage := range certificate.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageClientAuth || usage == x509.ExtKeyUsageAny {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the current TLS options of the server
+func (s *Server) tlsOptions() TLSOptions {
+	s.configMutex.RLock()
+	defer s.configMutex.RUnlock()
+	if s.config == nil {
+		return TLSOptions{}
+	}
+	return s.config.TLS
+}
+
+// Returns the TLS configuration for a handshake with the current options of
+// the server, cloned from the base configuration of the listener (client
+// certificates are only requested, if withClientAuth is set)
+func (s *Server) handshakeConfig(base *tls.Config, withClientAuth bool) *tls.Config {
+	s.configMutex.RLock()
+	defer s.configMutex.RUnlock()
+
+	config := base.Clone()
+	config.GetConfigForClient = nil
+	config.GetCertificate = s.getCertificate
+
+	var options TLSOptions
+	if s.config != nil {
+		options = s.config.TLS
+	}
+
+	if withClientAuth {
+		config.ClientAuth = tls.RequestClientCert
+		options.apply(config, s.clientCACertificatePool)
+	} else {
+		options.ClientAuth = ""
+		options.apply(config, nil)
+	}
+
+	return config
+}
+
+// Returns the TLS configuration of a listener, that applies the current
+// options of the server on every handshake (client certificates are only
+// requested, if withClientAuth is set)
+func (s *Server) listenerTLSConfig(withClientAuth bool) *tls.Config {
+	// Every handshake clones the base, so it keeps the protocols for ALPN and
+	// the session ticket keys
+	base := &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		return s.handshakeConfig(base, withClientAuth), nil
+	}
+	return base
+}
@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestTLSOptions(t *testing.T) {
+	assert.ErrorContains(t, TLSOptions{ClientAuth: "always"}.validate(), "invalid client auth \"always\"")
+	assert.ErrorContains(t, TLSOptions{MinVersion: "1.4"}.validate(), "invalid minimum version \"1.4\"")
+	assert.ErrorContains(t, TLSOptions{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}.validate(), "unknown or insecure cipher suite")
+	assert.ErrorContains(t, TLSOptions{Curves: []string{"P224"}}.validate(), "unknown curve \"P224\"")
+
+	options := TLSOptions{
+		ClientAuth: ClientAuthRequireAndVerify,
+		MinVersion: "1.3",
+		CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"},
+		Curves: []string{"X25519", "P256"},
+	}
+	assert.NilError(t, options.validate())
+
+	pool := x509.NewCertPool()
+	config := &tls.Config{}
+	options.apply(config, pool)
+	assert.Equal(t, config.MinVersion, uint16(tls.VersionTLS13))
+	assert.DeepEqual(t, config.CipherSuites, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384})
+	assert.DeepEqual(t, config.CurvePreferences, []tls.CurveID{tls.X25519, tls.CurveP256})
+	assert.Equal(t, config.ClientAuth, tls.RequireAndVerifyClientCert)
+	assert.Equal(t, config.ClientCAs, pool)
+}
+
+// Starts a TLS server, that authenticates requests with the handshake
+// configuration of a server
+func startAuthenticatingServer(t *testing.T, ca *testCA, options TLSOptions) *httptest.Server {
+	serverCertificate, serverKey := ca.issueWithKey(t, 2, x509.ExtKeyUsageServerAuth)
+	certificate := &tls.Certificate{Certificate: [][]byte{serverCertificate.Raw}, PrivateKey: serverKey}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.certificate)
+
+	s := &Server{}
+	s.applyConfiguration(&Config{TLS: options}, certificate, pool, nil)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authenticateRequest(w, r, s.clientCAs(), s.revocationChecker(), s.tlsOptions()) {
+			writeSuccess(w, r, Response{Message: "Authenticated"})
+		}
+	}))
+	server.TLS = s.listenerTLSConfig(true)
+	server.StartTLS()
+	return server
+}
+
+// Sends a request to a server with an optional client certificate
+func sendAuthenticatedRequest(server *httptest.Server, certificate *x509.Certificate, key interface{}) (int, error) {
+	config := &tls.Config{InsecureSkipVerify: true}
+	if certificate != nil {
+		config.Certificates = []tls.Certificate{{Certificate: [][]byte{certificate.Raw}, PrivateKey: key}}
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	resp, err := client.Get(server.URL + "/")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func TestRequireAndVerifyClientCert(t *testing.T) {
+	ca := newTestCA(t)
+	server := startAuthenticatingServer(t, ca, TLSOptions{ClientAuth: ClientAuthRequireAndVerify})
+	defer server.Close()
+
+	certificate, key := ca.issueWithKey(t, 10, x509.ExtKeyUsageClientAuth)
+	status, err := sendAuthenticatedRequest(server, certificate, key)
+	assert.NilError(t, err)
+	assert.Equal(t, status, http.StatusOK)
+
+	// Clients without certificate don't complete the handshake
+	_, err = sendAuthenticatedRequest(server, nil, nil)
+	assert.Assert(t, err != nil)
+
+	// Neither do clients with certificates of other issuers or usages
+	otherCertificate, otherKey := newTestCA(t).issueWithKey(t, 10, x509.ExtKeyUsageClientAuth)
+	_, err = sendAuthenticatedRequest(server, otherCertificate, otherKey)
+	assert.Assert(t, err != nil)
+
+	serverCertificate, serverKey := ca.issueWithKey(t, 11, x509.ExtKeyUsageServerAuth)
+	_, err = sendAuthenticatedRequest(server, serverCertificate, serverKey)
+	assert.Assert(t, err != nil)
+}
+
+func TestRequireClientAuthEKU(t *testing.T) {
+	ca := newTestCA(t)
+	server := startAuthenticatingServer(t, ca, TLSOptions{RequireClientAuthEKU: true})
+	defer server.Close()
+
+	certificate, key := ca.issueWithKey(t, 10, x509.ExtKeyUsageClientAuth)
+	status, err := sendAuthenticatedRequest(server, certificate, key)
+	assert.NilError(t, err)
+	assert.Equal(t, status, http.StatusOK)
+
+	// Certificates without extended key usage are rejected as well
+	certificate, key = ca.issueWithKey(t, 11)
+	status, err = sendAuthenticatedRequest(server, certificate, key)
+	assert.NilError(t, err)
+	assert.Equal(t, status, http.StatusForbidden)
+
+	certificate, key = ca.issueWithKey(t, 12, x509.ExtKeyUsageServerAuth)
+	status, err = sendAuthenticatedRequest(server, certificate, key)
+	assert.NilError(t, err)
+	assert.Equal(t, status, http.StatusForbidden)
+
+	status, err = sendAuthenticatedRequest(server, nil, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, status, http.StatusUnauthorized)
+}
+
+func TestHealthzOnlyRequest(t *testing.T) {
+	req, err := http.NewRequest("GET", "/healthz", nil)
+	assert.NilError(t, err)
+	rr := httptest.NewRecorder()
+	handleHealthzOnlyRequest(rr, req)
+	assert.Equal(t, rr.Code, http.StatusOK)
+
+	req, err = http.NewRequest("GET", "/addresses", nil)
+	assert.NilError(t, err)
+	rr = httptest.NewRecorder()
+	handleHealthzOnlyRequest(rr, req)
+	assert.Equal(t, rr.Code, http.StatusNotFound)
+}
+
+func TestListenerTLSConfig(t *testing.T) {
+	ca := newTestCA(t)
+	serverCertificate, serverKey := ca.issueWithKey(t, 2, x509.ExtKeyUsageServerAuth)
+
+	s := &Server{}
+	s.applyConfiguration(&Config{}, &tls.Certificate{Certificate: [][]byte{serverCertificate.Raw}, PrivateKey: serverKey}, x509.NewCertPool(), nil)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+
+	server := &http.Server{
+		TLSConfig: s.listenerTLSConfig(false),
+		Handler: http.HandlerFunc(handleHealthzOnlyRequest),
+	}
+	go server.ServeTLS(listener, "", "")
+	defer server.Close()
+
+	// Handshakes negotiate HTTP/2 and resume the sessions of earlier ones (TLS
+	// 1.2 delivers the session ticket within the handshake)
+	config := &tls.Config{
+		InsecureSkipVerify: true,
+		MaxVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		ClientSessionCache: tls.NewLRUClientSessionCache(1),
+	}
+	for i := 0; i < 2; i++ {
+		conn, err := tls.Dial("tcp", listener.Addr().String(), config)
+		assert.NilError(t, err)
+		state := conn.ConnectionState()
+		conn.Close()
+
+		assert.Equal(t, state.NegotiatedProtocol, "h2")
+		assert.Equal(t, state.DidResume, i > 0)
+	}
+}
@@ -0,0 +1,309 @@
+package internal
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	"go.uber.org/zap"
+)
+
+// Watches the network links and addresses for managed addresses, that vanished
+// out-of-band, and enforces them according to the address policies
+type Watcher struct {
+	Store *Store
+	AddressPolicies []AddressPolicy
+	Events *EventLog
+	// Serializes re-adding addresses with the requests of the server (which
+	// remove the record of an address before deleting it)
+	Mutex *sync.Mutex
+	// Guards the address policies, which are swapped on reload, and the
+	// addresses being re-asserted
+	mutex sync.RWMutex
+	// Vanished addresses, that were already alerted about (until they come back)
+	alerted map[string]bool
+	// Vanished addresses, that are being re-added in the background
+	reasserting map[string]bool
+}
+
+// Returns the key of an address of a network link in the alerted addresses
+func alertKey(linkIndex int, ipNet net.IPNet) string {
+	return fmt.Sprintf("%d %s", linkIndex, ipNet.String())
+}
+
+// Replaces the address policies of the watcher
+func (w *Watcher) SetAddressPolicies(policies []AddressPolicy) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.AddressPolicies = policies
+}
+
+// Returns the current address policies of the watcher
+func (w *Watcher) addressPolicies() []AddressPolicy {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	return w.AddressPolicies
+}
+
+// Returns the enforce mode for a managed address (re-asserting wins, if
+// multiple policies allow the address)
+func enforceMode(policies []AddressPolicy, interfaceName string, address CIDRAddress) string {
+	mode := EnforceModeAlert
+	for _, p := range policies {
+		if p.Allows(interfaceName, address) && p.EnforceMode() == EnforceModeReassert {
+			mode = EnforceModeReassert
+		}
+	}
+	return mode
+}
+
+// Checks whether a link update reports a link, that is up and running
+func isLinkUp(update netlink.LinkUpdate) bool {
+	return update.Header.Type == unix.RTM_NEWLINK &&
+		update.IfInfomsg.Flags & unix.IFF_UP != 0 &&
+		update.IfInfomsg.Flags & unix.IFF_RUNNING != 0
+}
+
+// Checks whether a network link is up and running
+func isNetworkLinkUp(link NetworkLink) bool {
+	return (*link).Attrs().RawFlags & unix.IFF_UP != 0 && (*link).Attrs().RawFlags & unix.IFF_RUNNING != 0
+}
+
+// Enforces the managed addresses of an interface, that are missing (only
+// called by the watcher's goroutine)
+func (w *Watcher) enforce(link NetworkLink) {
+	interfaceName := (*link).Attrs().Name
+	policies := PoliciesForLink(w.addressPolicies(), link)
+
+	for _, record := range w.Store.RecordsOfInterface(interfaceName) {
+		// Expired leases are removed by the lease reaper
+		if record.Expired(time.Now()) {
+			continue
+		}
+
+		address, err := record.CIDRAddress()
+		if err != nil {
+			zap.L().Error("Failed to parse recorded cidr address",
+				zap.String("interface-name", interfaceName),
+				zap.String("address", record.Address),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		addressExists, err := AddressExists(link, address)
+		if err != nil {
+			continue
+		}
+
+		key := alertKey((*link).Attrs().Index, *address.IPNet)
+		if addressExists {
+			delete(w.alerted, key)
+			continue
+		}
+
+		mode := enforceMode(policies, interfaceName, address)
+
+		// Every address update of the interface would repeat the alert otherwise
+		if mode != EnforceModeReassert {
+			if w.alerted[key] {
+				continue
+			}
+			if w.alerted == nil {
+				w.alerted = make(map[string]bool)
+			}
+			w.alerted[key] = true
+		} else if !w.startReassert(key) {
+			// The address is already being re-added
+			continue
+		}
+
+		zap.L().Warn("Managed address vanished from interface",
+			zap.String("interface-name", interfaceName),
+			zap.String("address", record.Address),
+			zap.String("enforce", mode),
+		)
+		w.Events.Publish(Event{
+			Type: EventTypeAddressRemoved,
+			InterfaceName: interfaceName,
+			Address: record.Address,
+			Message: "Managed address vanished from interface",
+		})
+
+		if mode != EnforceModeReassert {
+			continue
+		}
+
+		// Re-adding probes the address, waits for the duplicate address detection
+		// and advertises it, which must not block the handling of further updates
+		go w.reassert(link, address, advertisementFor(policies, interfaceName, address))
+	}
+}
+
+// Marks a vanished address as being re-asserted and returns, whether it wasn't
+// already
+func (w *Watcher) startReassert(key string) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.reasserting[key] {
+		return false
+	}
+	if w.reasserting == nil {
+		w.reasserting = make(map[string]bool)
+	}
+	w.reasserting[key] = true
+	return true
+}
+
+// Unmarks a vanished address as being re-asserted
+func (w *Watcher) finishReassert(key string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	delete(w.reasserting, key)
+}
+
+// Re-adds a vanished managed address to a network link and advertises it
+// again and returns, whether it was added (false, if it was deleted, released
+// or added by someone else meanwhile)
+func (w *Watcher) readdAddress(link NetworkLink, address CIDRAddress, advertisement Advertisement) (bool, error) {
+	if err := probeNewAddress(link, address, advertisement); err != nil {
+		return false, err
+	}
+
+	// The record is checked again, as requests may have removed it meanwhile
+	w.Mutex.Lock()
+	added := false
+	record, recorded := w.Store.Record((*link).Attrs().Name, address)
+	var err error
+	if recorded && !record.Expired(time.Now()) {
+		added, err = claimAddress(link, address)
+	}
+	w.Mutex.Unlock()
+	if err != nil || !added {
+		return false, err
+	}
+
+	err = settleAddress(link, address, advertisement)
+	if isDADFailure(err) {
+		w.Mutex.Lock()
+		removeFailedAddress(link, address)
+		w.Mutex.Unlock()
+	}
+	return true, err
+}
+
+// Re-asserts a vanished managed address and publishes the outcome (runs on
+// its own goroutine)
+func (w *Watcher) reassert(link NetworkLink, address CIDRAddress, advertisement Advertisement) {
+	interfaceName := (*link).Attrs().Name
+	defer w.finishReassert(alertKey((*link).Attrs().Index, *address.IPNet))
+
+	added, err := w.readdAddress(link, address, advertisement)
+	if err != nil {
+		zap.L().Error("Failed to re-assert managed address",
+			zap.String("interface-name", interfaceName),
+			zap.String("address", address.String()),
+			zap.Error(err),
+		)
+		w.Events.Publish(Event{
+			Type: EventTypeReassertFailed,
+			InterfaceName: interfaceName,
+			Address: address.IPNet.String(),
+			Message: err.Error(),
+		})
+		return
+	}
+	if !added {
+		return
+	}
+
+	w.Events.Publish(Event{
+		Type: EventTypeAddressReasserted,
+		InterfaceName: interfaceName,
+		Address: address.IPNet.String(),
+		Message: "Re-added and advertised managed address",
+	})
+}
+
+// Returns the error for a closed subscription, unless the watcher was stopped
+func closedSubscriptionError(done <-chan struct{}, subscription string) error {
+	select {
+	case <-done:
+		return nil
+	default:
+		return fmt.Errorf("%s subscription was closed", subscription)
+	}
+}
+
+// Runs the watcher (blocks until done is closed and fails, if a subscription
+// is closed before)
+func (w *Watcher) Run(done <-chan struct{}) error {
+	linkUpdates := make(chan netlink.LinkUpdate)
+	if err := netlink.LinkSubscribe(linkUpdates, done); err != nil {
+		return err
+	}
+
+	addressUpdates := make(chan netlink.AddrUpdate)
+	if err := netlink.AddrSubscribe(addressUpdates, done); err != nil {
+		return err
+	}
+
+	linksUp := make(map[int]bool)
+	links, err := ListLinks()
+	if err != nil {
+		return err
+	}
+	for _, link := range links {
+		linksUp[(*link).Attrs().Index] = isNetworkLinkUp(link)
+	}
+
+	for {
+		select {
+		case update, ok := <-linkUpdates:
+			if !ok {
+				return closedSubscriptionError(done, "link")
+			}
+
+			index := update.Attrs().Index
+			if update.Header.Type == unix.RTM_DELLINK {
+				delete(linksUp, index)
+				continue
+			}
+
+			wasUp := linksUp[index]
+			linksUp[index] = isLinkUp(update)
+
+			if linksUp[index] && !wasUp {
+				zap.L().Info("Interface came up, checking managed addresses",
+					zap.String("interface-name", update.Attrs().Name),
+				)
+				w.enforce(&Link{update.Link, nil})
+			}
+		case update, ok := <-addressUpdates:
+			if !ok {
+				return closedSubscriptionError(done, "address")
+			}
+
+			// An address, that came back, is alerted about again, once it vanishes
+			if update.NewAddr {
+				delete(w.alerted, alertKey(update.LinkIndex, update.LinkAddress))
+				continue
+			}
+
+			// Addresses of links, that are down, are enforced when they come up
+			if !linksUp[update.LinkIndex] {
+				continue
+			}
+
+			link, err := netlink.LinkByIndex(update.LinkIndex)
+			if err != nil {
+				continue
+			}
+			w.enforce(&Link{link, nil})
+		}
+	}
+}
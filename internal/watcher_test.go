@@ -0,0 +1,215 @@
+package internal
+
+import (
+	"net"
+	"os"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func watcherTestPolicy(t *testing.T, enforce string) AddressPolicy {
+	_, policyIPNetwork, err := net.ParseCIDR("192.0.2.0/24")
+	assert.NilError(t, err)
+
+	return AddressPolicy{IPNetwork: IPNetwork{*policyIPNetwork}, InterfaceNameRegex: Regexp{*regexp.MustCompile(".*")}, Enforce: enforce}
+}
+
+// Waits until an event of a type was published
+func waitForEvent(events *EventLog, eventType EventType) bool {
+	for i := 0; i < 50; i++ {
+		for _, event := range events.Events() {
+			if event.Type == eventType {
+				return true
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return false
+}
+
+func TestEnforceMode(t *testing.T) {
+	address, err := ParseAddress("192.0.2.1/24")
+	assert.NilError(t, err)
+
+	assert.Equal(t, enforceMode([]AddressPolicy{watcherTestPolicy(t, "")}, "eth0", address), EnforceModeReassert)
+	assert.Equal(t, enforceMode([]AddressPolicy{watcherTestPolicy(t, "alert")}, "eth0", address), EnforceModeAlert)
+	assert.Equal(t, enforceMode([]AddressPolicy{watcherTestPolicy(t, "alert"), watcherTestPolicy(t, "reassert")}, "eth0", address), EnforceModeReassert)
+	assert.Equal(t, enforceMode([]AddressPolicy{}, "eth0", address), EnforceModeAlert)
+}
+
+func testWatcher(t *testing.T, enforce string, reasserted bool) {
+	assert.Assert(t, os.Getenv("NET_LINK") != "")
+
+	link, err := LinkByName(os.Getenv("NET_LINK"))
+	assert.NilError(t, err)
+
+	address, err := ParseAddress("192.0.2.1/24")
+	assert.NilError(t, err)
+	assert.NilError(t, AddAddress(link, address, Advertisement{}))
+
+	store, err := OpenStore(t.TempDir())
+	assert.NilError(t, err)
+	assert.NilError(t, store.Put(os.Getenv("NET_LINK"), address, nil, ""))
+
+	watcher := &Watcher{
+		Store: store,
+		AddressPolicies: []AddressPolicy{watcherTestPolicy(t, enforce)},
+		Events: NewEventLog(),
+		Mutex: &sync.Mutex{},
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go watcher.Run(done)
+	time.Sleep(100 * time.Millisecond)
+
+	assert.NilError(t, DeleteAddress(link, address))
+	assert.Assert(t, waitForEvent(watcher.Events, EventTypeAddressRemoved))
+
+	if reasserted {
+		assert.Assert(t, waitForEvent(watcher.Events, EventTypeAddressReasserted))
+	}
+	assertAddressExists(t, link, "192.0.2.1/24", reasserted)
+
+	// Stop enforcing before cleaning up
+	assert.NilError(t, store.Remove(os.Getenv("NET_LINK"), address))
+	assert.NilError(t, DeleteAddress(link, address))
+}
+
+func TestWatcherReassertsAddress(t *testing.T) {
+	testWatcher(t, EnforceModeReassert, true)
+}
+
+func TestWatcherAlertsAboutAddress(t *testing.T) {
+	testWatcher(t, EnforceModeAlert, false)
+}
+
+// Returns the number of events of a type, that were published
+func countEvents(events *EventLog, eventType EventType) int {
+	count := 0
+	for _, event := range events.Events() {
+		if event.Type == eventType {
+			count++
+		}
+	}
+	return count
+}
+
+func TestWatcherAlertsOnce(t *testing.T) {
+	assert.Assert(t, os.Getenv("NET_LINK") != "")
+
+	link, err := LinkByName(os.Getenv("NET_LINK"))
+	assert.NilError(t, err)
+
+	address, err := ParseAddress("192.0.2.1/24")
+	assert.NilError(t, err)
+	assert.NilError(t, AddAddress(link, address, Advertisement{}))
+
+	otherAddress, err := ParseAddress("192.0.2.2/24")
+	assert.NilError(t, err)
+
+	store, err := OpenStore(t.TempDir())
+	assert.NilError(t, err)
+	assert.NilError(t, store.Put(os.Getenv("NET_LINK"), address, nil, ""))
+
+	watcher := &Watcher{
+		Store: store,
+		AddressPolicies: []AddressPolicy{watcherTestPolicy(t, EnforceModeAlert)},
+		Events: NewEventLog(),
+		Mutex: &sync.Mutex{},
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go watcher.Run(done)
+	time.Sleep(100 * time.Millisecond)
+
+	assert.NilError(t, DeleteAddress(link, address))
+	assert.Assert(t, waitForEvent(watcher.Events, EventTypeAddressRemoved))
+
+	// Other address updates of the interface don't repeat the alert
+	for i := 0; i < 3; i++ {
+		assert.NilError(t, AddAddress(link, otherAddress, Advertisement{}))
+		assert.NilError(t, DeleteAddress(link, otherAddress))
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, countEvents(watcher.Events, EventTypeAddressRemoved), 1)
+
+	// The address is alerted about again, once it came back and vanished again
+	assert.NilError(t, AddAddress(link, address, Advertisement{}))
+	time.Sleep(100 * time.Millisecond)
+	assert.NilError(t, DeleteAddress(link, address))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, countEvents(watcher.Events, EventTypeAddressRemoved), 2)
+
+	// Stop enforcing before cleaning up
+	assert.NilError(t, store.Remove(os.Getenv("NET_LINK"), address))
+}
+
+func TestClosedSubscriptionError(t *testing.T) {
+	assert.Error(t, closedSubscriptionError(nil, "link"), "link subscription was closed")
+
+	done := make(chan struct{})
+	close(done)
+	assert.NilError(t, closedSubscriptionError(done, "link"))
+}
+
+func TestWatcherReassertsInBackground(t *testing.T) {
+	assert.Assert(t, os.Getenv("NET_LINK") != "")
+
+	link, err := LinkByName(os.Getenv("NET_LINK"))
+	assert.NilError(t, err)
+
+	address, err := ParseAddress("192.0.2.1/24")
+	assert.NilError(t, err)
+	otherAddress, err := ParseAddress("192.0.2.2/24")
+	assert.NilError(t, err)
+
+	store, err := OpenStore(t.TempDir())
+	assert.NilError(t, err)
+	for _, a := range []CIDRAddress{address, otherAddress} {
+		assert.NilError(t, AddAddress(link, a, Advertisement{}))
+		assert.NilError(t, store.Put(os.Getenv("NET_LINK"), a, nil, ""))
+	}
+
+	watcher := &Watcher{
+		Store: store,
+		AddressPolicies: []AddressPolicy{watcherTestPolicy(t, EnforceModeReassert)},
+		Events: NewEventLog(),
+		Mutex: &sync.Mutex{},
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go watcher.Run(done)
+	time.Sleep(100 * time.Millisecond)
+
+	// Further updates are handled, while a re-assertion waits for the mutex
+	watcher.Mutex.Lock()
+	assert.NilError(t, DeleteAddress(link, address))
+	assert.NilError(t, DeleteAddress(link, otherAddress))
+	for i := 0; i < 50 && countEvents(watcher.Events, EventTypeAddressRemoved) < 2; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	assert.Equal(t, countEvents(watcher.Events, EventTypeAddressRemoved), 2)
+
+	// Addresses, whose records were removed meanwhile, aren't re-added
+	assert.NilError(t, store.Remove(os.Getenv("NET_LINK"), address))
+	watcher.Mutex.Unlock()
+
+	assert.Assert(t, waitForEvent(watcher.Events, EventTypeAddressReasserted))
+	assertAddressExists(t, link, "192.0.2.2/24", true)
+	assertAddressExists(t, link, "192.0.2.1/24", false)
+	assert.Equal(t, countEvents(watcher.Events, EventTypeAddressReasserted), 1)
+
+	// Stop enforcing before cleaning up
+	assert.NilError(t, store.Remove(os.Getenv("NET_LINK"), otherAddress))
+	assert.NilError(t, DeleteAddress(link, otherAddress))
+}